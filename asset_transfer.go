@@ -5,33 +5,51 @@
 package main
 
 import (
-	"bytes"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"github.com/guozhe001/supply-finance-chaincode-go/canonicaljson"
 	"github.com/guozhe001/supply-finance-chaincode-go/chaincode"
+	"github.com/guozhe001/supply-finance-chaincode-go/events"
+	"github.com/guozhe001/supply-finance-chaincode-go/middleware"
 	"log"
+	"strconv"
 	"time"
 
 	"github.com/golang/protobuf/ptypes"
 	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
-	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
 const (
-	typeAssetForSale     = "S"
-	typeAssetBid         = "B"
-	typeAssetSaleReceipt = "SR"
-	typeAssetBuyReceipt  = "BR"
-	statusEnable         = "enable"
-	statusDelete         = "delete"
+	typeAssetForSale       = "S"
+	typeAssetBid           = "B"
+	typeAssetSaleReceipt   = "SR"
+	typeAssetBuyReceipt    = "BR"
+	statusEnable           = "enable"
+	statusDelete           = "delete"
+	statusPledgeOffered    = "pledge-offered"    // 待资金方接受质押
+	statusPledged          = "pledged"           // 已质押给资金方
+	statusGuaranteeOffered = "guarantee-offered" // 待担保方接受担保
+	statusGuaranteed       = "guaranteed"        // 已由担保方担保
+	// CouchDB indexes shipped under META-INF/statedb/couchdb/indexes
+	indexOwner  = "indexOwner"
+	indexStatus = "indexStatus"
+	indexIssuer = "indexIssuer"
 )
 
 type SmartContract struct {
 	contractapi.Contract
 }
 
+// newSmartContract returns the asset transfer contract with its transaction context handler registered,
+// every transaction of the contract runs with a new TransactionContext
+func newSmartContract() *SmartContract {
+	contract := new(SmartContract)
+	contract.TransactionContextHandler = new(TransactionContext)
+	return contract
+}
+
 // Asset struct and properties must be exported (start with capitals) to work with contract api metadata
 type Asset struct {
 	ObjectType        string `json:"objectType"` // ObjectType is used to distinguish different object types in the same chaincode namespace
@@ -40,6 +58,20 @@ type Asset struct {
 	PublicDescription string `json:"publicDescription"`
 	Status            string `json:"status"`
 	ParentID          string `json:"parentID"`
+	IssuerOrg         string `json:"issuerOrg"`
+	// OwnerID optionally restricts the asset to a single client of the owner org, see getClientOwnerID
+	OwnerID string `json:"ownerID,omitempty" metadata:"ownerID,optional"`
+	// FinancierOrg is the org an asset is pledged to
+	FinancierOrg string `json:"financierOrg,omitempty" metadata:"financierOrg,optional"`
+	// GuarantorOrgs are the orgs guaranteeing an asset
+	GuarantorOrgs []string `json:"guarantorOrgs,omitempty" metadata:"guarantorOrgs,optional"`
+	// AcceptedGuarantorOrgs are the guarantors that accepted a guarantee which is not complete yet
+	AcceptedGuarantorOrgs []string `json:"acceptedGuarantorOrgs,omitempty" metadata:"acceptedGuarantorOrgs,optional"`
+	// PropertiesRoot is the hex encoded Merkle root over the individual private properties, see propertiesTree
+	PropertiesRoot string `json:"propertiesRoot,omitempty" metadata:"propertiesRoot,optional"`
+	// PropertiesHash is the hex encoded SHA-256 of the plaintext properties, only recorded once they are
+	// encrypted at rest, see putAssetProperties
+	PropertiesHash string `json:"propertiesHash,omitempty" metadata:"propertiesHash,optional"`
 }
 
 type receipt struct {
@@ -58,468 +90,654 @@ type AssetProperties struct {
 	Salt       string    `json:"salt"`
 }
 
-// CreateAsset creates an asset and sets it as owned by the client's org
-func (s *SmartContract) CreateAsset(ctx contractapi.TransactionContextInterface, assetID, publicDescription string) error {
+// CreateAsset creates an asset and sets it as owned by the client's org. It returns the asset ID, allocated
+// from the org's sequence when no asset ID is passed, see NextAssetID. A retried request returns the
+// asset ID of the original one.
+func (s *SmartContract) CreateAsset(ctx TransactionContextInterface, assetID, publicDescription string) (string, error) {
+	req, err := beginRequest(ctx, "CreateAsset", assetID, publicDescription)
+	if err != nil {
+		return "", err
+	}
+	if req.replayed {
+		var createdID string
+		err = req.replay(&createdID)
+		if err != nil {
+			return "", err
+		}
+		return createdID, nil
+	}
+
 	// 获取临时数据库的数据，返回一个map[string][]byte
-	transientMap, err := ctx.GetStub().GetTransient()
+	transientMap, err := ctx.GetTransient()
 	if err != nil {
-		return fmt.Errorf("error getting transient: %v", err)
+		return "", fmt.Errorf("error getting transient: %v", err)
 	}
 
 	// Asset properties must be retrieved from the transient field as they are private
 	immutablePropertiesJSON, ok := transientMap["asset_properties"]
-	fmt.Println("immutablePropertiesJSON:", immutablePropertiesJSON)
 	if !ok {
-		return fmt.Errorf("asset_properties key not found in the transient map")
+		return "", errTransientKeyMissing.new("asset_properties")
 	}
 
-	return createAsset(ctx, immutablePropertiesJSON, assetID, publicDescription, "")
-}
-
-// CreateAsset creates an asset and sets it as owned by the client's org
-func createAsset(ctx contractapi.TransactionContextInterface, immutablePropertiesJSON []byte, assetID, publicDescription string,
-	parentID string) error {
 	// Get client org id and verify it matches peer org id.
 	// In this scenario, client is only authorized to read/write private data from its own peer.
-	clientOrgID, err := getClientOrgID(ctx, true)
-	fmt.Println("clientOrgID:", clientOrgID)
+	clientOrgID, err := ctx.GetClientOrgID(true)
 	if err != nil {
-		return fmt.Errorf("failed to get verified OrgID: %v", err)
+		return "", err
 	}
 
-	asset := Asset{
-		ObjectType:        "asset",
-		ID:                assetID,
-		OwnerOrg:          clientOrgID,
-		PublicDescription: publicDescription,
-		Status:            statusEnable,
-		ParentID:          parentID,
+	immutablePropertiesJSON, err = canonicalPayload("asset_properties", immutablePropertiesJSON)
+	if err != nil {
+		return "", err
 	}
-	fmt.Println("asset:", asset)
-	assetBytes, err := json.Marshal(asset)
+
+	if assetID == "" {
+		allocator, err := newAssetIDAllocator(ctx, clientOrgID)
+		if err != nil {
+			return "", err
+		}
+		assetID, err = allocator.allocate(ctx)
+		if err != nil {
+			return "", err
+		}
+		err = allocator.save(ctx)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	asset, err := createAsset(ctx, clientOrgID, immutablePropertiesJSON, assetID, publicDescription, "", "", "")
 	if err != nil {
-		return fmt.Errorf("failed to create asset JSON: %v", err)
+		return "", err
 	}
 
-	err = ctx.GetStub().PutState(asset.ID, assetBytes)
+	// The creator is the issuer of the asset and may sign its properties right away
+	if signature, ok := transientMap[transientIssuerSignature]; ok {
+		propertiesHash := sha256.Sum256(immutablePropertiesJSON)
+		err = putIssuerSignature(ctx, asset, propertiesHash[:], string(signature))
+		if err != nil {
+			return "", err
+		}
+	}
+	err = emitAssetEvent(ctx, events.AssetCreated, asset)
+	if err != nil {
+		return "", err
+	}
+	err = req.complete(ctx, assetID)
 	if err != nil {
-		return fmt.Errorf("failed to put asset in public data: %v", err)
+		return "", err
 	}
+	return assetID, nil
+}
 
-	// Set the endorsement policy such that an owner org peer is required to endorse future updates
-	err = setAssetStateBasedEndorsement(ctx, asset.ID, clientOrgID)
+// createAsset creates an asset owned by ownerOrg, with its private properties in the owner org's collection
+func createAsset(ctx TransactionContextInterface, ownerOrg string, immutablePropertiesJSON []byte, assetID, publicDescription string,
+	parentID string, issuerOrg string, ownerID string) (*Asset, error) {
+	// 资产ID不能重复，否则会覆盖已有的资产
+	exists, err := assetExists(ctx, assetID)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, errAssetExists.new(assetID)
+	}
+	// 资产的发行方就是最初创建资产的组织，拆分出的资产沿用原资产的发行方
+	if issuerOrg == "" {
+		issuerOrg = ownerOrg
+	}
+	_, err = validateAssetProperties(ctx, immutablePropertiesJSON, assetID, issuerOrg)
 	if err != nil {
-		return fmt.Errorf("failed setting state based endorsement for owner: %v", err)
+		return nil, err
+	}
+	root, err := propertiesRoot(immutablePropertiesJSON)
+	if err != nil {
+		return nil, err
+	}
+	asset := Asset{
+		ObjectType:        "asset",
+		ID:                assetID,
+		OwnerOrg:          ownerOrg,
+		PublicDescription: publicDescription,
+		Status:            statusEnable,
+		ParentID:          parentID,
+		IssuerOrg:         issuerOrg,
+		OwnerID:           ownerID,
+		PropertiesRoot:    root,
 	}
 
 	// Persist private immutable asset properties to owner's private data collection
-	collection := buildCollectionName(clientOrgID)
-	fmt.Println("collection:", collection)
-	err = ctx.GetStub().PutPrivateData(collection, asset.ID, immutablePropertiesJSON)
+	collection := ctx.ImplicitCollection(ownerOrg)
+	_, err = putAssetProperties(ctx, collection, &asset, immutablePropertiesJSON)
 	if err != nil {
-		return fmt.Errorf("failed to put Asset private details: %v", err)
+		return nil, err
 	}
-	return nil
+	ctx.Logger().Debug("asset properties stored", "assetID", assetID, "ownerOrg", ownerOrg, "collection", collection.Name)
+
+	// The endorsement policy of the asset's status is set along with the asset,
+	// such that an owner org peer is required to endorse future updates
+	err = putAsset(ctx, nil, &asset)
+	if err != nil {
+		return nil, err
+	}
+	return &asset, nil
 }
 
-// // verifyAssetProperties 验证资产属性的信息
-// func verifyAssetProperties(immutablePropertiesJSON []byte, asset Asset) error {
-// 	assetProperties, err := getAssetProperties(immutablePropertiesJSON)
-// 	if err != nil {
-// 		return err
-// 	}
-// 	// 资产的属性ID和资产ID相同
-// 	if asset.ID != assetProperties.ID {
-// 		return fmt.Errorf("资产ID和资产属性ID必须相同")
-// 	}
-// 	// 资产的发行者就是资产的创建者，所有人都可以发行，但是别人认不认可这个组织发行的资产是另一回事
-// 	if asset.OwnerOrg != assetProperties.Issuer {
-// 		return fmt.Errorf("资产的发行方必须是当前创建资产的组织")
-// 	}
-// 	// 理论上这里应该还有更多的校验，比如说创建时间和失效时间的验证
-// 	return nil
-// }
 // ChangePublicDescription updates the assets public description. Only the current owner can update the public description
-func (s *SmartContract) ChangePublicDescription(ctx contractapi.TransactionContextInterface, assetID string, newDescription string) error {
+func (s *SmartContract) ChangePublicDescription(ctx TransactionContextInterface, assetID string, newDescription string) error {
 	asset, err := s.ReadAsset(ctx, assetID)
 	if err != nil {
-		return fmt.Errorf("failed to get asset: %v", err)
+		return err
+	}
+	updatedAsset, err := changeOriginAssetInfo(ctx, *asset, "", newDescription)
+	if err != nil {
+		return err
 	}
-	return changeOriginAssetInfo(ctx, *asset, "", newDescription)
+	return emitAssetEvent(ctx, events.AssetDescriptionChanged, updatedAsset)
 }
 
 // AgreeToSell adds seller's asking price to seller's implicit private data collection
-func (s *SmartContract) AgreeToSell(ctx contractapi.TransactionContextInterface, assetID string) error {
+func (s *SmartContract) AgreeToSell(ctx TransactionContextInterface, assetID string) error {
 	asset, err := s.ReadAsset(ctx, assetID)
 	if err != nil {
 		return err
 	}
 
-	clientOrgID, err := getClientOrgID(ctx, true)
+	// Verify that the client's org owns the asset or lists it on behalf of the owner.
+	// The asking price is kept in the collection of the org that lists the asset.
+	delegation, err := authorizeAssetAction(ctx, asset, rightList)
 	if err != nil {
-		return fmt.Errorf("failed to get verified OrgID: %v", err)
+		return err
 	}
 
-	// Verify that this clientOrgId actually owns the asset.
-	if clientOrgID != asset.OwnerOrg {
-		return fmt.Errorf("a client from %s cannot sell an asset owned by %s", clientOrgID, asset.OwnerOrg)
+	price, err := agreeToPrice(ctx, assetID, typeAssetForSale)
+	if err != nil {
+		return err
 	}
-
-	return agreeToPrice(ctx, assetID, typeAssetForSale)
+	event, err := newAssetEvent(ctx, events.AssetListed, asset)
+	if err != nil {
+		return err
+	}
+	if delegation != nil {
+		event.OnBehalfOf = delegation.OwnerOrg
+	}
+	err = sealEventPayload(ctx, event, price)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, event)
 }
 
 // AgreeToBuy adds buyer's bid price to buyer's implicit private data collection
-func (s *SmartContract) AgreeToBuy(ctx contractapi.TransactionContextInterface, assetID string) error {
-	return agreeToPrice(ctx, assetID, typeAssetBid)
+func (s *SmartContract) AgreeToBuy(ctx TransactionContextInterface, assetID string) error {
+	asset, err := s.ReadAsset(ctx, assetID)
+	if err != nil {
+		return err
+	}
+
+	price, err := agreeToPrice(ctx, assetID, typeAssetBid)
+	if err != nil {
+		return err
+	}
+	return emitSealedAssetEvent(ctx, events.AssetBid, asset, price)
 }
 
-// agreeToPrice adds a bid or ask price to caller's implicit private data collection
-func agreeToPrice(ctx contractapi.TransactionContextInterface, assetID string, priceType string) error {
+// agreeToPrice adds a bid or ask price to caller's implicit private data collection and returns the agreed price JSON
+func agreeToPrice(ctx TransactionContextInterface, assetID string, priceType string) ([]byte, error) {
 	// In this scenario, client is only authorized to read/write private data from its own peer.
-	clientOrgID, err := getClientOrgID(ctx, true)
+	clientOrgID, err := ctx.GetClientOrgID(true)
 	if err != nil {
-		return fmt.Errorf("failed to get verified OrgID: %v", err)
+		return nil, err
 	}
 
-	transMap, err := ctx.GetStub().GetTransient()
+	transMap, err := ctx.GetTransient()
 	if err != nil {
-		return fmt.Errorf("error getting transient: %v", err)
+		return nil, fmt.Errorf("error getting transient: %v", err)
 	}
 
 	// Asset price must be retrieved from the transient field as they are private
 	price, ok := transMap["asset_price"]
 	if !ok {
-		return fmt.Errorf("asset_price key not found in the transient map")
+		return nil, errTransientKeyMissing.new("asset_price")
+	}
+	price, err = canonicalPayload("asset_price", price)
+	if err != nil {
+		return nil, err
+	}
+	_, err = validatePrice(ctx, price, assetID)
+	if err != nil {
+		return nil, err
 	}
 
-	collection := buildCollectionName(clientOrgID)
+	collection := ctx.ImplicitCollection(clientOrgID)
 
 	// Persist the agreed to price in a collection sub-namespace based on priceType key prefix,
 	// to avoid collisions between private asset properties, sell price, and buy price
 	assetPriceKey, err := ctx.GetStub().CreateCompositeKey(priceType, []string{assetID})
 	if err != nil {
-		return fmt.Errorf("failed to create composite key: %v", err)
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
 	}
 
-	// The Price hash will be verified later, therefore always pass and persist price bytes as is,
+	// The Price hash will be verified later, therefore persist the canonical price bytes,
 	// so that there is no risk of nondeterministic marshaling.
-	err = ctx.GetStub().PutPrivateData(collection, assetPriceKey, price)
+	err = collection.Put(assetPriceKey, price)
 	if err != nil {
-		return fmt.Errorf("failed to put asset bid: %v", err)
+		return nil, fmt.Errorf("failed to put asset bid: %v", err)
 	}
 
-	return nil
+	return price, nil
 }
 
 // VerifyAssetProperties  Allows a buyer to validate the properties of
-// an asset against the owner's implicit private data collection
-func (s *SmartContract) VerifyAssetProperties(ctx contractapi.TransactionContextInterface, assetID string) (bool, error) {
-	transMap, err := ctx.GetStub().GetTransient()
+// an asset against the owner's implicit private data collection.
+// Properties the issuer did not sign verify as well, VerifyAssetIssuerSignature tells them apart.
+func (s *SmartContract) VerifyAssetProperties(ctx TransactionContextInterface, assetID string) (bool, error) {
+	_, err := s.verifyAssetProperties(ctx, assetID)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// VerifyAssetIssuerSignature validates the properties of an asset like VerifyAssetProperties and reports
+// whether they were signed by the issuer, and with which of its keys
+func (s *SmartContract) VerifyAssetIssuerSignature(ctx TransactionContextInterface, assetID string) (*IssuerSignatureVerification, error) {
+	return s.verifyAssetProperties(ctx, assetID)
+}
+
+// verifyAssetProperties checks the properties passed in the transient map match the on-chain hash of a tradable
+// asset and the issuer signature, if any
+func (s *SmartContract) verifyAssetProperties(ctx TransactionContextInterface, assetID string) (*IssuerSignatureVerification, error) {
+	transMap, err := ctx.GetTransient()
 	if err != nil {
-		return false, fmt.Errorf("error getting transient: %v", err)
+		return nil, fmt.Errorf("error getting transient: %v", err)
 	}
 
 	/// Asset properties must be retrieved from the transient field as they are private
 	immutablePropertiesJSON, ok := transMap["asset_properties"]
 	if !ok {
-		return false, fmt.Errorf("asset_properties key not found in the transient map")
+		return nil, errTransientKeyMissing.new("asset_properties")
 	}
 
 	asset, err := s.ReadAsset(ctx, assetID)
 	if err != nil {
-		return false, fmt.Errorf("failed to get asset: %v", err)
+		return nil, err
 	}
 
 	// 添加资产状态的验证
 	if (*asset).Status != statusEnable {
-		return false, fmt.Errorf("资产不可以，不允许交易: %v", err)
+		return nil, errAssetNotTradable.new(asset.ID, asset.Status)
 	}
 
-	collectionOwner := buildCollectionName(asset.OwnerOrg)
-	immutablePropertiesOnChainHash, err := ctx.GetStub().GetPrivateDataHash(collectionOwner, assetID)
+	immutablePropertiesOnChainHash, err := getPropertiesHash(ctx, asset)
 	if err != nil {
-		return false, fmt.Errorf("failed to read asset private properties hash from seller's collection: %v", err)
+		return nil, err
 	}
-	if immutablePropertiesOnChainHash == nil {
-		return false, fmt.Errorf("asset private properties hash does not exist: %s", assetID)
-	}
-
-	hash := sha256.New()
-	hash.Write(immutablePropertiesJSON)
-	calculatedPropertiesHash := hash.Sum(nil)
 
 	// verify that the hash of the passed immutable properties matches the on-chain hash
-	if !bytes.Equal(immutablePropertiesOnChainHash, calculatedPropertiesHash) {
-		return false, fmt.Errorf("hash %x for passed immutable properties %s does not match on-chain hash %x",
-			calculatedPropertiesHash,
-			immutablePropertiesJSON,
-			immutablePropertiesOnChainHash,
-		)
+	matches, err := hashMatches("asset_properties", immutablePropertiesOnChainHash, immutablePropertiesJSON)
+	if err != nil {
+		return nil, err
+	}
+	if !matches {
+		return nil, errPropertiesHashMismatch.new(immutablePropertiesOnChainHash)
 	}
 
-	return true, nil
+	// the properties must also be the ones the issuer signed
+	canonicalProperties, err := canonicalPayload("asset_properties", immutablePropertiesJSON)
+	if err != nil {
+		return nil, err
+	}
+	return verifyIssuerSignature(ctx, asset, canonicalProperties)
 }
 
 // TransferAsset checks transfer conditions and then transfers asset state to buyer.
-// TransferAsset can only be called by current owner
-func (s *SmartContract) TransferAsset(ctx contractapi.TransactionContextInterface, assetID string, buyerOrgID string) error {
-	clientOrgID, err := getClientOrgID(ctx, false)
+// TransferAsset can only be called by current owner. A retried request succeeds without transferring again.
+func (s *SmartContract) TransferAsset(ctx TransactionContextInterface, assetID string, buyerOrgID string) error {
+	req, err := beginRequest(ctx, "TransferAsset", assetID, buyerOrgID)
+	if err != nil {
+		return err
+	}
+	if req.replayed {
+		return nil
+	}
+
+	clientOrgID, err := ctx.GetClientOrgID(false)
 	if err != nil {
-		return fmt.Errorf("failed to get verified OrgID: %v", err)
+		return err
 	}
 
-	transMap, err := ctx.GetStub().GetTransient()
+	transMap, err := ctx.GetTransient()
 	if err != nil {
 		return fmt.Errorf("error getting transient data: %v", err)
 	}
 
 	immutablePropertiesJSON, ok := transMap["asset_properties"]
 	if !ok {
-		return fmt.Errorf("asset_properties key not found in the transient map")
+		return errTransientKeyMissing.new("asset_properties")
 	}
 
 	priceJSON, ok := transMap["asset_price"]
 	if !ok {
-		return fmt.Errorf("asset_price key not found in the transient map")
+		return errTransientKeyMissing.new("asset_price")
 	}
 
-	var agreement Agreement
-	err = json.Unmarshal(priceJSON, &agreement)
+	agreement, err := validatePrice(ctx, priceJSON, assetID)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal price JSON: %v", err)
+		return err
 	}
 
 	asset, err := s.ReadAsset(ctx, assetID)
 	if err != nil {
-		return fmt.Errorf("failed to get asset: %v", err)
+		return err
 	}
 
 	// 添加资产状态的验证
 	if (*asset).Status != statusEnable {
-		return fmt.Errorf("资产不可以，不允许交易")
+		return errAssetNotTradable.new(asset.ID, asset.Status)
 	}
 
-	err = verifyTransferConditions(ctx, asset, immutablePropertiesJSON, clientOrgID, buyerOrgID, priceJSON)
+	delegation, err := verifyTransferConditions(ctx, asset, immutablePropertiesJSON, clientOrgID, buyerOrgID, priceJSON)
 	if err != nil {
-		return fmt.Errorf("failed transfer verification: %v", err)
+		return err
 	}
+	ownerOrgID := asset.OwnerOrg
 
-	err = transferAssetState(ctx, asset, immutablePropertiesJSON, clientOrgID, buyerOrgID, agreement.Price)
+	canonicalProperties, err := canonicalPayload("asset_properties", immutablePropertiesJSON)
 	if err != nil {
-		return fmt.Errorf("failed asset transfer: %v", err)
+		return err
+	}
+	err = transferAssetState(ctx, asset, canonicalProperties, clientOrgID, buyerOrgID, agreement)
+	if err != nil {
+		return err
 	}
 
-	return nil
-
+	event, err := newAssetEvent(ctx, events.AssetTransferred, asset)
+	if err != nil {
+		return err
+	}
+	event.PreviousOwnerOrg = ownerOrgID
+	if delegation != nil {
+		event.OnBehalfOf = delegation.OwnerOrg
+	}
+	err = sealEventPayload(ctx, event, priceJSON)
+	if err != nil {
+		return err
+	}
+	err = emitEvent(ctx, event)
+	if err != nil {
+		return err
+	}
+	return req.complete(ctx, nil)
 }
 
-// SplitAsset 拆分资产为两个资产，传入的amount是拆分后的其中一个资产的金额
-func (s *SmartContract) SplitAsset(ctx contractapi.TransactionContextInterface, assetID string, amount int) error {
+// SplitAsset 拆分资产为两个资产，传入的amount是拆分后的其中一个资产的金额，返回拆分出的两个资产ID。
+// 重试的请求返回原请求拆分出的资产ID
+func (s *SmartContract) SplitAsset(ctx TransactionContextInterface, assetID string, amount int) ([]string, error) {
+	req, err := beginRequest(ctx, "SplitAsset", assetID, strconv.Itoa(amount))
+	if err != nil {
+		return nil, err
+	}
+	if req.replayed {
+		var childIDs []string
+		err = req.replay(&childIDs)
+		if err != nil {
+			return nil, err
+		}
+		return childIDs, nil
+	}
+
 	asset, err := s.ReadAsset(ctx, assetID)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	immutableProperties, err := getAssetPrivateProperties(ctx, assetID)
+	delegation, err := authorizeAssetAction(ctx, asset, rightSplit)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	// 先校验资产状态，不可拆分的资产不读取资产属性，也不分配资产ID
+	if asset.Status != statusEnable {
+		return nil, errAssetNotModifiable.new(asset.ID, asset.Status)
+	}
+	// 代理方无法读取资产拥有方的私有数据，资产属性由代理方通过transient传入并校验hash
+	var immutableProperties []byte
+	if delegation == nil {
+		immutableProperties, err = getAssetPrivateProperties(ctx, assetID)
+	} else {
+		immutableProperties, err = getDelegatedAssetProperties(ctx, asset)
+	}
+	if err != nil {
+		return nil, err
 	}
 	assetProperties, err := getAssetProperties(immutableProperties)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if assetProperties.Amount <= amount {
-		return fmt.Errorf("资产ID的金额为%d小于想要拆分的金额为%d，不允许拆分", assetProperties.Amount, amount)
+		return nil, errSplitAmountTooLarge.new(assetProperties.Amount, amount)
 	}
-	if err := splitAsset(ctx, assetProperties, assetID+"1", amount, *asset); err != nil {
-		return err
+	// 拆分出的资产从资产拥有方的序列中分配新的资产ID，发行方不参与拆分
+	allocator, err := newAssetIDAllocator(ctx, asset.OwnerOrg)
+	if err != nil {
+		return nil, err
 	}
-	if err := splitAsset(ctx, assetProperties, assetID+"2", assetProperties.Amount-amount, *asset); err != nil {
-		return err
+	firstID, err := allocator.allocate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	secondID, err := allocator.allocate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = allocator.save(ctx)
+	if err != nil {
+		return nil, err
+	}
+	first, err := splitAsset(ctx, assetProperties, firstID, amount, *asset)
+	if err != nil {
+		return nil, err
+	}
+	second, err := splitAsset(ctx, assetProperties, secondID, assetProperties.Amount-amount, *asset)
+	if err != nil {
+		return nil, err
 	}
 	// 拆分之后删除旧资产
-	collection := buildCollectionName((*asset).OwnerOrg)
-	err = ctx.GetStub().DelPrivateData(collection, asset.ID)
+	err = ctx.ImplicitCollection(asset.OwnerOrg).Delete(asset.ID)
 	if err != nil {
-		return fmt.Errorf("failed to delete Asset private details from org: %v", err)
+		return nil, fmt.Errorf("failed to delete Asset private details from org: %v", err)
 	}
 	// 修改公共资产信息
-	changeOriginAssetInfo(ctx, *asset, statusDelete, "已拆分")
-	return nil
+	splitOrigin, err := updateAssetInfo(ctx, *asset, statusDelete, "已拆分")
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := newAssetEvent(ctx, events.AssetSplit, splitOrigin)
+	if err != nil {
+		return nil, err
+	}
+	event.ChildIDs = []string{first.ID, second.ID}
+	if delegation != nil {
+		event.OnBehalfOf = delegation.OwnerOrg
+	}
+	err = emitEvent(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+	err = req.complete(ctx, event.ChildIDs)
+	if err != nil {
+		return nil, err
+	}
+	return event.ChildIDs, nil
 }
 
 // 根据transient获取的assetProperties的字节数组获取AssetProperties
 func getAssetProperties(immutablePropertiesJSON []byte) (AssetProperties, error) {
 	var assetProperties AssetProperties
 	if err := json.Unmarshal(immutablePropertiesJSON, &assetProperties); err != nil {
-		return assetProperties, fmt.Errorf("failed to unmarshal price JSON: %v", err)
+		return assetProperties, errInvalidJSON.new("asset_properties")
 	}
 	return assetProperties, nil
 }
 
 // ChangePublicDescription updates the assets public description. Only the current owner can update the public description
-func changeOriginAssetInfo(ctx contractapi.TransactionContextInterface, asset Asset, status string, newDescription string) error {
+func changeOriginAssetInfo(ctx TransactionContextInterface, asset Asset, status string, newDescription string) (*Asset, error) {
 	// No need to check client org id matches peer org id, rely on the asset ownership check instead.
-	clientOrgID, err := getClientOrgID(ctx, false)
+	clientOrgID, err := ctx.GetClientOrgID(false)
 	if err != nil {
-		return fmt.Errorf("failed to get verified OrgID: %v", err)
+		return nil, err
 	}
 
 	// Auth check to ensure that client's org actually owns the asset
 	if clientOrgID != asset.OwnerOrg {
-		return fmt.Errorf("a client from %s cannot update the description of a asset owned by %s", clientOrgID, asset.OwnerOrg)
+		return nil, errNotOwnerOrg.new(clientOrgID, "update the description of", asset.OwnerOrg)
 	}
+	err = verifyClientOwnerID(ctx, &asset, "update")
+	if err != nil {
+		return nil, err
+	}
+	return updateAssetInfo(ctx, asset, status, newDescription)
+}
 
+// updateAssetInfo updates the status and public description of an asset, the caller checks the client may do so
+func updateAssetInfo(ctx TransactionContextInterface, asset Asset, status string, newDescription string) (*Asset, error) {
 	// 添加资产状态的验证
 	if asset.Status != statusEnable {
-		return fmt.Errorf("资产不可用，不允许修改")
+		return nil, errAssetNotModifiable.new(asset.ID, asset.Status)
 	}
+	previous := asset
 	if status != "" {
 		asset.Status = status
 	}
 	if newDescription != "" {
 		asset.PublicDescription = newDescription
 	}
-	updatedAssetJSON, err := json.Marshal(asset)
+
+	err := putAsset(ctx, &previous, &asset)
 	if err != nil {
-		return fmt.Errorf("failed to marshal asset: %v", err)
+		return nil, err
 	}
-
-	return ctx.GetStub().PutState(asset.ID, updatedAssetJSON)
+	return &asset, nil
 }
 
 // splitAsset 从原始资产属性拆分成指定ID和金额的资产
-func splitAsset(ctx contractapi.TransactionContextInterface, originAssetProperties AssetProperties, newAssetID string, newAmount int,
-	asset Asset) error {
+func splitAsset(ctx TransactionContextInterface, originAssetProperties AssetProperties, newAssetID string, newAmount int,
+	asset Asset) (*Asset, error) {
 	originAssetProperties.Amount = newAmount
 	originAssetProperties.ID = newAssetID
-	immutablePropertiesJSON, err := json.Marshal(originAssetProperties)
+	immutablePropertiesJSON, err := canonicaljson.Marshal(originAssetProperties)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return createAsset(ctx, immutablePropertiesJSON, newAssetID, asset.PublicDescription, asset.ID)
+	return createAsset(ctx, asset.OwnerOrg, immutablePropertiesJSON, newAssetID, asset.PublicDescription, asset.ID, asset.IssuerOrg, asset.OwnerID)
 }
 
 // verifyTransferConditions checks that client org currently owns asset and that both parties have agreed on price
-func verifyTransferConditions(ctx contractapi.TransactionContextInterface,
+func verifyTransferConditions(ctx TransactionContextInterface,
 	asset *Asset,
 	immutablePropertiesJSON []byte,
 	clientOrgID string,
 	buyerOrgID string,
-	priceJSON []byte) error {
+	priceJSON []byte) (*Delegation, error) {
 
-	// CHECK1: Auth check to ensure that client's org actually owns the asset
+	// CHECK1: Auth check to ensure that client's org actually owns the asset, or sells it on behalf of the owner
 
-	if clientOrgID != asset.OwnerOrg {
-		return fmt.Errorf("a client from %s cannot transfer a asset owned by %s", clientOrgID, asset.OwnerOrg)
+	delegation, err := authorizeAssetAction(ctx, asset, rightSell)
+	if err != nil {
+		return nil, err
 	}
 
 	// CHECK2: Verify that the hash of the passed immutable properties matches the on-chain hash
 
-	collectionSeller := buildCollectionName(clientOrgID)
-	immutablePropertiesOnChainHash, err := ctx.GetStub().GetPrivateDataHash(collectionSeller, asset.ID)
+	immutablePropertiesOnChainHash, err := getPropertiesHash(ctx, asset)
 	if err != nil {
-		return fmt.Errorf("failed to read asset private properties hash from seller's collection: %v", err)
+		return nil, err
 	}
-	if immutablePropertiesOnChainHash == nil {
-		return fmt.Errorf("asset private properties hash does not exist: %s", asset.ID)
-	}
-
-	hash := sha256.New()
-	hash.Write(immutablePropertiesJSON)
-	calculatedPropertiesHash := hash.Sum(nil)
 
 	// verify that the hash of the passed immutable properties matches the on-chain hash
-	if !bytes.Equal(immutablePropertiesOnChainHash, calculatedPropertiesHash) {
-		return fmt.Errorf("hash %x for passed immutable properties %s does not match on-chain hash %x",
-			calculatedPropertiesHash,
-			immutablePropertiesJSON,
-			immutablePropertiesOnChainHash,
-		)
+	matches, err := hashMatches("asset_properties", immutablePropertiesOnChainHash, immutablePropertiesJSON)
+	if err != nil {
+		return nil, err
+	}
+	if !matches {
+		return nil, errPropertiesHashMismatch.new(immutablePropertiesOnChainHash)
 	}
 
-	// CHECK3: Verify that seller and buyer agreed on the same price
+	// CHECK3: Verify that seller and buyer agreed on the same price, the seller being the org that listed the asset
+	collectionSeller := ctx.ImplicitCollection(clientOrgID)
 
 	// Get sellers asking price
 	assetForSaleKey, err := ctx.GetStub().CreateCompositeKey(typeAssetForSale, []string{asset.ID})
 	if err != nil {
-		return fmt.Errorf("failed to create composite key: %v", err)
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
 	}
-	sellerPriceHash, err := ctx.GetStub().GetPrivateDataHash(collectionSeller, assetForSaleKey)
+	sellerPriceHash, err := collectionSeller.Hash(assetForSaleKey)
 	if err != nil {
-		return fmt.Errorf("failed to get seller price hash: %v", err)
+		return nil, fmt.Errorf("failed to get seller price hash: %v", err)
 	}
 	if sellerPriceHash == nil {
-		return fmt.Errorf("seller price for %s does not exist", asset.ID)
+		return nil, errSellerPriceNotFound.new(asset.ID)
 	}
 
 	// Get buyers bid price
-	collectionBuyer := buildCollectionName(buyerOrgID)
+	collectionBuyer := ctx.ImplicitCollection(buyerOrgID)
 	assetBidKey, err := ctx.GetStub().CreateCompositeKey(typeAssetBid, []string{asset.ID})
 	if err != nil {
-		return fmt.Errorf("failed to create composite key: %v", err)
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
 	}
 	// TODO 疑问：这个方法是由资产拥有者调用的，那么资产拥有者怎么可以获取资产买方的出价信息呢？如果是从公共状态获取购买方的出价hash是没问题的，但是从购买方的私有数据集中获取出价hash很让人费解。
-	buyerPriceHash, err := ctx.GetStub().GetPrivateDataHash(collectionBuyer, assetBidKey)
+	buyerPriceHash, err := collectionBuyer.Hash(assetBidKey)
 	if err != nil {
-		return fmt.Errorf("failed to get buyer price hash: %v", err)
+		return nil, fmt.Errorf("failed to get buyer price hash: %v", err)
 	}
 	if buyerPriceHash == nil {
-		return fmt.Errorf("buyer price for %s does not exist", asset.ID)
+		return nil, errBuyerPriceNotFound.new(asset.ID)
 	}
 
-	hash = sha256.New()
-	hash.Write(priceJSON)
-	calculatedPriceHash := hash.Sum(nil)
-
 	// Verify that the hash of the passed price matches the on-chain sellers price hash
-	if !bytes.Equal(calculatedPriceHash, sellerPriceHash) {
-		return fmt.Errorf("hash %x for passed price JSON %s does not match on-chain hash %x, seller hasn't agreed to the passed trade id and price",
-			calculatedPriceHash,
-			priceJSON,
-			sellerPriceHash,
-		)
+	matches, err = hashMatches("asset_price", sellerPriceHash, priceJSON)
+	if err != nil {
+		return nil, err
+	}
+	if !matches {
+		return nil, errSellerPriceHashMismatch.new(sellerPriceHash)
 	}
 
 	// Verify that the hash of the passed price matches the on-chain buyer price hash
-	if !bytes.Equal(calculatedPriceHash, buyerPriceHash) {
-		return fmt.Errorf("hash %x for passed price JSON %s does not match on-chain hash %x, buyer hasn't agreed to the passed trade id and price",
-			calculatedPriceHash,
-			priceJSON,
-			buyerPriceHash,
-		)
+	matches, err = hashMatches("asset_price", buyerPriceHash, priceJSON)
+	if err != nil {
+		return nil, err
+	}
+	if !matches {
+		return nil, errBuyerPriceHashMismatch.new(buyerPriceHash)
 	}
 
-	return nil
+	return delegation, nil
 }
 
 // transferAssetState performs the public and private state updates for the transferred asset
-func transferAssetState(ctx contractapi.TransactionContextInterface, asset *Asset, immutablePropertiesJSON []byte, clientOrgID string, buyerOrgID string, price int) error {
+func transferAssetState(ctx TransactionContextInterface, asset *Asset, immutablePropertiesJSON []byte, clientOrgID string, buyerOrgID string, agreement *Agreement) error {
+	previous := *asset
+	collectionOwner := ctx.ImplicitCollection(previous.OwnerOrg)
 	asset.OwnerOrg = buyerOrgID
-	updatedAsset, err := json.Marshal(asset)
-	if err != nil {
-		return err
-	}
-
-	err = ctx.GetStub().PutState(asset.ID, updatedAsset)
+	// 买方在出价中指定资产的持有人，未指定时资产归买方组织所有
+	asset.OwnerID = agreement.BuyerOwnerID
+	// The buyer receives the plaintext properties, their private data hash commits to them again
+	asset.PropertiesHash = ""
+	// The endorsement policy changes to the new owner along with the asset
+	err := putAsset(ctx, &previous, asset)
 	if err != nil {
 		return fmt.Errorf("failed to write asset for buyer: %v", err)
 	}
 
-	// Change the endorsement policy to the new owner
-	err = setAssetStateBasedEndorsement(ctx, asset.ID, buyerOrgID)
+	// Transfer the private properties (delete from owner collection, create in buyer collection)
+	err = collectionOwner.Delete(asset.ID)
 	if err != nil {
-		return fmt.Errorf("failed setting state based endorsement for new owner: %v", err)
+		return fmt.Errorf("failed to delete Asset private details from owner: %v", err)
 	}
+	collectionSeller := ctx.ImplicitCollection(clientOrgID)
 
-	// Transfer the private properties (delete from seller collection, create in buyer collection)
-	collectionSeller := buildCollectionName(clientOrgID)
-	err = ctx.GetStub().DelPrivateData(collectionSeller, asset.ID)
-	if err != nil {
-		return fmt.Errorf("failed to delete Asset private details from seller: %v", err)
-	}
-
-	collectionBuyer := buildCollectionName(buyerOrgID)
-	err = ctx.GetStub().PutPrivateData(collectionBuyer, asset.ID, immutablePropertiesJSON)
+	collectionBuyer := ctx.ImplicitCollection(buyerOrgID)
+	err = collectionBuyer.Put(asset.ID, immutablePropertiesJSON)
 	if err != nil {
 		return fmt.Errorf("failed to put Asset private properties for buyer: %v", err)
 	}
@@ -530,7 +748,7 @@ func transferAssetState(ctx contractapi.TransactionContextInterface, asset *Asse
 		return fmt.Errorf("failed to create composite key for seller: %v", err)
 	}
 
-	err = ctx.GetStub().DelPrivateData(collectionSeller, assetPriceKey)
+	err = collectionSeller.Delete(assetPriceKey)
 	if err != nil {
 		return fmt.Errorf("failed to delete asset price from implicit private data collection for seller: %v", err)
 	}
@@ -541,7 +759,7 @@ func transferAssetState(ctx contractapi.TransactionContextInterface, asset *Asse
 		return fmt.Errorf("failed to create composite key for buyer: %v", err)
 	}
 
-	err = ctx.GetStub().DelPrivateData(collectionBuyer, assetPriceKey)
+	err = collectionBuyer.Delete(assetPriceKey)
 	if err != nil {
 		return fmt.Errorf("failed to delete asset price from implicit private data collection for buyer: %v", err)
 	}
@@ -563,7 +781,7 @@ func transferAssetState(ctx contractapi.TransactionContextInterface, asset *Asse
 		return err
 	}
 	assetReceipt := receipt{
-		price:     price,
+		price:     agreement.Price,
 		timestamp: timestamp,
 	}
 	receipt, err := json.Marshal(assetReceipt)
@@ -571,7 +789,7 @@ func transferAssetState(ctx contractapi.TransactionContextInterface, asset *Asse
 		return fmt.Errorf("failed to marshal receipt: %v", err)
 	}
 
-	err = ctx.GetStub().PutPrivateData(collectionBuyer, receiptBuyKey, receipt)
+	err = collectionBuyer.Put(receiptBuyKey, receipt)
 	if err != nil {
 		return fmt.Errorf("failed to put private asset receipt for buyer: %v", err)
 	}
@@ -581,55 +799,24 @@ func transferAssetState(ctx contractapi.TransactionContextInterface, asset *Asse
 		return fmt.Errorf("failed to create composite key for receipt: %v", err)
 	}
 
-	err = ctx.GetStub().PutPrivateData(collectionSeller, receiptSaleKey, receipt)
+	err = collectionSeller.Put(receiptSaleKey, receipt)
 	if err != nil {
 		return fmt.Errorf("failed to put private asset receipt for seller: %v", err)
 	}
-
-	return nil
-}
-
-// getClientOrgID gets the client org ID.
-// The client org ID can optionally be verified against the peer org ID, to ensure that a client
-// from another org doesn't attempt to read or write private data from this peer.
-// The only exception in this scenario is for TransferAsset, since the current owner
-// needs to get an endorsement from the buyer's peer.
-func getClientOrgID(ctx contractapi.TransactionContextInterface, verifyOrg bool) (string, error) {
-	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
-	if err != nil {
-		return "", fmt.Errorf("failed getting client's orgID: %v", err)
-	}
-
-	if verifyOrg {
-		err = verifyClientOrgMatchesPeerOrg(clientOrgID)
+	// 代理方出售时资产拥有方同样保留收据
+	if collectionOwner.MSPID != collectionSeller.MSPID {
+		err = collectionOwner.Put(receiptSaleKey, receipt)
 		if err != nil {
-			return "", err
+			return fmt.Errorf("failed to put private asset receipt for owner: %v", err)
 		}
 	}
 
-	return clientOrgID, nil
-}
-
-// verifyClientOrgMatchesPeerOrg checks the client org id matches the peer org id.
-func verifyClientOrgMatchesPeerOrg(clientOrgID string) error {
-	peerOrgID, err := shim.GetMSPID()
-	if err != nil {
-		return fmt.Errorf("failed getting peer's orgID: %v", err)
-	}
-
-	if clientOrgID != peerOrgID {
-		return fmt.Errorf("client from org %s is not authorized to read or write private data from an org %s peer",
-			clientOrgID,
-			peerOrgID,
-		)
-	}
-
 	return nil
 }
 
 // setAssetStateBasedEndorsement adds an endorsement policy to a asset so that only a peer from an owning org
 // can update or transfer the asset.
-func setAssetStateBasedEndorsement(ctx contractapi.TransactionContextInterface, assetID string, orgToEndorse string) error {
+func setAssetStateBasedEndorsement(ctx TransactionContextInterface, assetID string, orgToEndorse string) error {
 	endorsementPolicy, err := statebased.NewStateEP(nil)
 	if err != nil {
 		return err
@@ -651,22 +838,22 @@ func buildCollectionName(clientOrgID string) string {
 	return fmt.Sprintf("_implicit_org_%s", clientOrgID)
 }
 
-func getClientImplicitCollectionName(ctx contractapi.TransactionContextInterface) (string, error) {
-	clientOrgID, err := getClientOrgID(ctx, true)
-	if err != nil {
-		return "", fmt.Errorf("failed to get verified OrgID: %v", err)
-	}
-
-	err = verifyClientOrgMatchesPeerOrg(clientOrgID)
+// newChaincode returns the chaincode of the asset transfer and practice contracts, running the error
+// hooks of their middlewares
+func newChaincode() (*middleware.Chaincode, error) {
+	assetContract := newSmartContract()
+	practiceContract := new(chaincode.SmartContract)
+	ccc, err := contractapi.NewChaincode(assetContract, practiceContract)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-
-	return buildCollectionName(clientOrgID), nil
+	return middleware.NewChaincode(ccc).
+		Handle(assetContract, transactionPipeline).
+		Handle(practiceContract, chaincode.Pipeline), nil
 }
 
 func main() {
-	ccc, err := contractapi.NewChaincode(new(SmartContract), new(chaincode.SmartContract))
+	ccc, err := newChaincode()
 	if err != nil {
 		log.Panicf("Error create transfer asset chaincode: %v", err)
 	}
@@ -0,0 +1,166 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// attributeRole is the certificate attribute, registered with Fabric CA, that holds the comma separated roles of a client
+const attributeRole = "role"
+
+// Client roles
+const (
+	roleIssuerOperator = "issuer-operator"
+	roleTreasury       = "treasury"
+	roleTrader         = "trader"
+	roleAuditor        = "auditor"
+	roleAdmin          = "admin"
+)
+
+// publicTransactions only read public state and can be called by any client of the channel
+var publicTransactions = []string{
+	"ReadAsset",
+	"GetOrgEncryptionKey",
+	"GetAssetsByRangeWithPagination",
+	"QueryAssetsByOwner",
+	"QueryAssetsByStatus",
+	"QueryAssetsByIssuer",
+	"QueryAssetsWithPagination",
+	"QueryAssetsByOwnerIndex",
+	"QueryAssetsByStatusIndex",
+	"QueryAssetChildren",
+	"QueryAssetHistory",
+	"QueryAssetHistoryWithPagination",
+	"QueryAssetAsOf",
+	"ClientIdentityPractice",
+	"GetClientOwnerID",
+	"QueryDelegations",
+	"GetIssuerKey",
+	"GetAssetIssuerSignature",
+	"IsPaused",
+	"GetOperatorOrg",
+}
+
+// rolePolicy lists the transactions each role may call, on top of the public ones.
+// A transaction that is neither public nor granted to a role of the client is denied.
+var rolePolicy = map[string][]string{
+	// 资产登记：创建、拆分、维护资产
+	roleIssuerOperator: {
+		"CreateAsset",
+		"NextAssetID",
+		"ChangePublicDescription",
+		"AssignAssetOwner",
+		"SplitAsset",
+		"GrantDelegation",
+		"RevokeDelegation",
+		"RegisterIssuerKey",
+		"AttestAssetProperties",
+		"GetAssetPrivateProperties",
+		"GetAssetPropertyProofs",
+		"EncryptAssetProperties",
+		"RegisterOrgEncryptionKey",
+	},
+	// 资金：出价、确认资产
+	roleTreasury: {
+		"AgreeToBuy",
+		"PledgeAsset",
+		"GuaranteeAsset",
+		"AcceptPledge",
+		"AcceptGuarantee",
+		"ReleaseAsset",
+		"VerifyAssetProperties",
+		"VerifyAssetIssuerSignature",
+		"VerifyAssetPropertyProofs",
+		"GetAssetSalesPrice",
+		"GetAssetBidPrice",
+		"QueryAssetSaleAgreements",
+		"QueryAssetBuyAgreements",
+		"RegisterOrgEncryptionKey",
+	},
+	// 交易：买卖、转让、拆分资产
+	roleTrader: {
+		"AgreeToSell",
+		"AgreeToBuy",
+		"VerifyAssetProperties",
+		"VerifyAssetIssuerSignature",
+		"VerifyAssetPropertyProofs",
+		"TransferAsset",
+		"AssignAssetOwner",
+		"SplitAsset",
+		"GrantDelegation",
+		"RevokeDelegation",
+		"GetAssetPrivateProperties",
+		"GetAssetPropertyProofs",
+		"GetAssetSalesPrice",
+		"GetAssetBidPrice",
+		"QueryAssetSaleAgreements",
+		"QueryAssetBuyAgreements",
+	},
+	// 审计：只读
+	roleAuditor: {
+		"VerifyAssetProperties",
+		"VerifyAssetIssuerSignature",
+		"VerifyAssetPropertyProofs",
+		"GetAssetPrivateProperties",
+		"GetAssetPropertyProofs",
+		"GetAssetSalesPrice",
+		"GetAssetBidPrice",
+		"QueryAssetSaleAgreements",
+		"QueryAssetBuyAgreements",
+	},
+	// 运维：设置运维组织，暂停和恢复合约
+	roleAdmin: {
+		"SetPaused",
+		"SetOperatorOrg",
+	},
+}
+
+// authorizeTransaction checks the called transaction is public or granted to one of the client's roles,
+// it runs before every transaction of the contract, see transactionPipeline
+func authorizeTransaction(ctx TransactionContextInterface, function string) error {
+	if contains(publicTransactions, function) {
+		return nil
+	}
+
+	roles, err := getClientRoles(ctx)
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if contains(rolePolicy[role], function) {
+			return nil
+		}
+	}
+	return errRoleForbidden.new(roles, function)
+}
+
+// getClientRoles returns the roles in the role attribute of the client's certificate
+func getClientRoles(ctx TransactionContextInterface) ([]string, error) {
+	value, found, err := ctx.GetClientIdentity().GetAttributeValue(attributeRole)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client's %s attribute: %v", attributeRole, err)
+	}
+	if !found {
+		return nil, nil
+	}
+	var roles []string
+	for _, role := range strings.Split(value, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
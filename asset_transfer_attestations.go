@@ -0,0 +1,311 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/guozhe001/supply-finance-chaincode-go/envelope"
+	"github.com/guozhe001/supply-finance-chaincode-go/events"
+)
+
+const (
+	// typeIssuerKey prefixes the public state keys of the registered issuer signing keys
+	typeIssuerKey = "IK"
+	// typeIssuerSignature prefixes the public state keys of the issuer signatures over asset properties
+	typeIssuerSignature = "IS"
+	// transientIssuerSignature optionally carries the issuer signature of the properties of a created asset
+	transientIssuerSignature = "issuer_signature"
+)
+
+// Issuer signature status of verified asset properties
+const (
+	issuerSignatureSigned   = "signed"   // the issuer signed the properties
+	issuerSignatureUnsigned = "unsigned" // the properties carry no signature, e.g. split assets the issuer has not attested yet
+)
+
+// IssuerSignature is the signature of the issuer org over the SHA-256 of the private properties of an asset
+type IssuerSignature struct {
+	AssetID        string `json:"assetID"`
+	IssuerOrg      string `json:"issuerOrg"`
+	KeyID          string `json:"keyID,omitempty" metadata:"keyID,optional"` // issuer key the signature was made with, see issuerKeyID
+	PropertiesHash string `json:"propertiesHash"`                            // hex encoded
+	Signature      string `json:"signature"`                                 // base64 encoded ASN.1 ECDSA signature
+}
+
+// IssuerSignatureVerification reports whether the properties of an asset were signed by its issuer
+type IssuerSignatureVerification struct {
+	AssetID   string `json:"assetID"`
+	IssuerOrg string `json:"issuerOrg"`
+	Status    string `json:"status"` // signed or unsigned
+	KeyID     string `json:"keyID,omitempty" metadata:"keyID,optional"`
+}
+
+// RegisterIssuerKey registers the P-256 public key, PEM encoded as PUBLIC KEY or CERTIFICATE, that the
+// client's org signs the properties of the assets it issues with. A registered key replaces the previous
+// one for new signatures; every key is kept under its key ID, so signatures made with a previous key keep verifying.
+func (s *SmartContract) RegisterIssuerKey(ctx TransactionContextInterface, publicKeyPEM string) error {
+	clientOrgID, err := ctx.GetClientOrgID(false)
+	if err != nil {
+		return err
+	}
+
+	keyID, err := issuerKeyID([]byte(publicKeyPEM))
+	if err != nil {
+		return errInvalidPublicKey.new("issuer key", err)
+	}
+
+	// the current key under the org, and every key under the org and its key ID
+	for _, attributes := range [][]string{{clientOrgID}, {clientOrgID, keyID}} {
+		keyKey, err := ctx.GetStub().CreateCompositeKey(typeIssuerKey, attributes)
+		if err != nil {
+			return fmt.Errorf("failed to create composite key: %v", err)
+		}
+		err = ctx.GetStub().PutState(keyKey, []byte(publicKeyPEM))
+		if err != nil {
+			return fmt.Errorf("failed to put issuer key for %s: %v", clientOrgID, err)
+		}
+		// Only the issuer org can replace its key
+		err = setAssetStateBasedEndorsement(ctx, keyKey, clientOrgID)
+		if err != nil {
+			return fmt.Errorf("failed setting state based endorsement for issuer key: %v", err)
+		}
+	}
+	return nil
+}
+
+// GetIssuerKey returns the PEM encoded signing key registered by an issuer org
+func (s *SmartContract) GetIssuerKey(ctx TransactionContextInterface, mspID string) (string, error) {
+	publicKeyPEM, err := getIssuerKey(ctx, mspID)
+	if err != nil {
+		return "", err
+	}
+	if publicKeyPEM == nil {
+		return "", errIssuerKeyNotFound.new(mspID)
+	}
+	return string(publicKeyPEM), nil
+}
+
+// AttestAssetProperties stores the issuer's signature over the properties of an asset, such as an asset
+// split from a signed one. Only the issuer org of the asset can attest it. The signature is checked against
+// the on-chain hash of the properties, so the issuer does not need to see the owner's private data.
+func (s *SmartContract) AttestAssetProperties(ctx TransactionContextInterface, assetID string, signature string) error {
+	asset, err := s.ReadAsset(ctx, assetID)
+	if err != nil {
+		return err
+	}
+	clientOrgID, err := ctx.GetClientOrgID(false)
+	if err != nil {
+		return err
+	}
+	if clientOrgID != asset.IssuerOrg {
+		return errNotIssuer.new(clientOrgID, asset.IssuerOrg)
+	}
+
+	propertiesHash, err := getPropertiesHash(ctx, asset)
+	if err != nil {
+		return err
+	}
+	err = putIssuerSignature(ctx, asset, propertiesHash, signature)
+	if err != nil {
+		return err
+	}
+	return emitAssetEvent(ctx, events.AssetAttested, asset)
+}
+
+// GetAssetIssuerSignature returns the issuer signature over the properties of an asset
+func (s *SmartContract) GetAssetIssuerSignature(ctx TransactionContextInterface, assetID string) (*IssuerSignature, error) {
+	issuerSignature, err := getIssuerSignature(ctx, assetID)
+	if err != nil {
+		return nil, err
+	}
+	if issuerSignature == nil {
+		return nil, errIssuerSignatureNotFound.new(assetID)
+	}
+	return issuerSignature, nil
+}
+
+// putIssuerSignature verifies the issuer signature over a properties hash with the issuer's current key
+// and stores it publicly
+func putIssuerSignature(ctx TransactionContextInterface, asset *Asset, propertiesHash []byte, signature string) error {
+	publicKeyPEM, err := getIssuerKey(ctx, asset.IssuerOrg)
+	if err != nil {
+		return err
+	}
+	if publicKeyPEM == nil {
+		return errIssuerKeyNotFound.new(asset.IssuerOrg)
+	}
+	keyID, err := issuerKeyID(publicKeyPEM)
+	if err != nil {
+		return fmt.Errorf("invalid issuer key of %s: %v", asset.IssuerOrg, err)
+	}
+	err = verifySignature(publicKeyPEM, propertiesHash, signature)
+	if err != nil {
+		return errInvalidIssuerSignature.new(asset.ID, err)
+	}
+
+	issuerSignatureJSON, err := json.Marshal(IssuerSignature{
+		AssetID:        asset.ID,
+		IssuerOrg:      asset.IssuerOrg,
+		KeyID:          keyID,
+		PropertiesHash: hex.EncodeToString(propertiesHash),
+		Signature:      signature,
+	})
+	if err != nil {
+		return err
+	}
+	signatureKey, err := ctx.GetStub().CreateCompositeKey(typeIssuerSignature, []string{asset.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	err = ctx.GetStub().PutState(signatureKey, issuerSignatureJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put issuer signature: %v", err)
+	}
+	return nil
+}
+
+// verifyIssuerSignature checks the properties of an asset were signed by its issuer, with the key recorded in
+// the signature. Properties without a signature are reported unsigned: assets created before the issuer
+// registered a key and assets split from signed ones have none until the issuer attests them.
+func verifyIssuerSignature(ctx TransactionContextInterface, asset *Asset, immutablePropertiesJSON []byte) (*IssuerSignatureVerification, error) {
+	verification := &IssuerSignatureVerification{AssetID: asset.ID, IssuerOrg: asset.IssuerOrg, Status: issuerSignatureUnsigned}
+	issuerSignature, err := getIssuerSignature(ctx, asset.ID)
+	if err != nil {
+		return nil, err
+	}
+	if issuerSignature == nil {
+		return verification, nil
+	}
+
+	propertiesHash := sha256.Sum256(immutablePropertiesJSON)
+	if issuerSignature.IssuerOrg != asset.IssuerOrg || issuerSignature.PropertiesHash != hex.EncodeToString(propertiesHash[:]) {
+		return nil, errSignatureMismatch.new(asset.ID)
+	}
+	publicKeyPEM, err := getIssuerKeyVersion(ctx, asset.IssuerOrg, issuerSignature.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	err = verifySignature(publicKeyPEM, propertiesHash[:], issuerSignature.Signature)
+	if err != nil {
+		return nil, errIssuerSignatureFail.new(asset.ID, asset.IssuerOrg, err)
+	}
+
+	assetProperties, err := getAssetProperties(immutablePropertiesJSON)
+	if err != nil {
+		return nil, err
+	}
+	if assetProperties.Issuer != asset.IssuerOrg {
+		return nil, errIssuerMismatch.new(asset.ID, asset.IssuerOrg)
+	}
+	verification.Status = issuerSignatureSigned
+	verification.KeyID = issuerSignature.KeyID
+	return verification, nil
+}
+
+// issuerKeyID returns the ID of an issuer key: the hex encoded SHA-256 of its DER encoded public key
+func issuerKeyID(publicKeyPEM []byte) (string, error) {
+	publicKey, err := envelope.ParsePublicKeyPEM(publicKeyPEM)
+	if err != nil {
+		return "", err
+	}
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	keyID := sha256.Sum256(publicKeyDER)
+	return hex.EncodeToString(keyID[:]), nil
+}
+
+// getIssuerKey returns the current key of an issuer org, nil if it has not registered one
+func getIssuerKey(ctx TransactionContextInterface, mspID string) ([]byte, error) {
+	keyKey, err := ctx.GetStub().CreateCompositeKey(typeIssuerKey, []string{mspID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	publicKeyPEM, err := ctx.GetStub().GetState(keyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read issuer key of %s: %v", mspID, err)
+	}
+	return publicKeyPEM, nil
+}
+
+// getIssuerKeyVersion returns the key of an issuer org with the given ID. Signatures stored before keys were
+// versioned carry no key ID and are verified with the current key.
+func getIssuerKeyVersion(ctx TransactionContextInterface, mspID string, keyID string) ([]byte, error) {
+	if keyID == "" {
+		publicKeyPEM, err := getIssuerKey(ctx, mspID)
+		if err != nil {
+			return nil, err
+		}
+		if publicKeyPEM == nil {
+			return nil, errIssuerKeyNotFound.new(mspID)
+		}
+		return publicKeyPEM, nil
+	}
+	keyKey, err := ctx.GetStub().CreateCompositeKey(typeIssuerKey, []string{mspID, keyID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	publicKeyPEM, err := ctx.GetStub().GetState(keyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read issuer key %s of %s: %v", keyID, mspID, err)
+	}
+	if publicKeyPEM == nil {
+		return nil, errIssuerKeyVersionNotFound.new(mspID, keyID)
+	}
+	return publicKeyPEM, nil
+}
+
+func getIssuerSignature(ctx TransactionContextInterface, assetID string) (*IssuerSignature, error) {
+	signatureKey, err := ctx.GetStub().CreateCompositeKey(typeIssuerSignature, []string{assetID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	issuerSignatureJSON, err := ctx.GetStub().GetState(signatureKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read issuer signature: %v", err)
+	}
+	if issuerSignatureJSON == nil {
+		return nil, nil
+	}
+	var issuerSignature IssuerSignature
+	err = json.Unmarshal(issuerSignatureJSON, &issuerSignature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal issuer signature: %v", err)
+	}
+	return &issuerSignature, nil
+}
+
+// verifySignature verifies a base64 encoded ASN.1 ECDSA signature over a digest
+func verifySignature(publicKeyPEM []byte, digest []byte, signature string) error {
+	publicKey, err := envelope.ParsePublicKeyPEM(publicKeyPEM)
+	if err != nil {
+		return err
+	}
+	der, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %v", err)
+	}
+	var ecdsaSignature struct {
+		R, S *big.Int
+	}
+	rest, err := asn1.Unmarshal(der, &ecdsaSignature)
+	if err != nil || len(rest) != 0 || ecdsaSignature.R == nil || ecdsaSignature.S == nil {
+		return errMalformedSignature.new()
+	}
+	if !ecdsa.Verify(publicKey, digest, ecdsaSignature.R, ecdsaSignature.S) {
+		return errSignatureInvalid.new()
+	}
+	return nil
+}
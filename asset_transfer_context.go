@@ -0,0 +1,193 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/guozhe001/supply-finance-chaincode-go/logging"
+	"github.com/guozhe001/supply-finance-chaincode-go/middleware"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// TransactionContextInterface is the transaction context of the asset transfer contract. It caches what
+// a transaction looks up repeatedly: the client's MSP ID, the peer org check, the transient map and the
+// assets it reads. It also keeps the private values of the transaction out of its log entries.
+type TransactionContextInterface interface {
+	contractapi.TransactionContextInterface
+	// GetClientOrgID returns the MSP ID of the client. With verifyOrg the client org must also be the
+	// peer's org, as clients are only authorized to read/write private data from their own peer.
+	// The exception is TransferAsset, since the current owner needs an endorsement from the buyer's peer.
+	GetClientOrgID(verifyOrg bool) (string, error)
+	// GetTransient returns the transient map of the proposal
+	GetTransient() (map[string][]byte, error)
+	// GetAsset returns the public asset as committed before the transaction, nil if it does not exist.
+	// Like the ledger, it does not reflect the writes of the transaction itself.
+	GetAsset(assetID string) (*Asset, error)
+	// ImplicitCollection returns the implicit private data collection of an org
+	ImplicitCollection(mspID string) *ImplicitCollection
+	// ClientCollection returns the implicit collection of the client org, verified to be the peer's org
+	ClientCollection() (*ImplicitCollection, error)
+	// Logger returns the logger of the transaction. Its entries never contain the transient values of the
+	// transaction, the private data it reads or the values passed to Redact.
+	Logger() *logging.Logger
+	// Redact keeps private values, such as decrypted properties, out of the transaction's log entries
+	Redact(values ...[]byte)
+}
+
+// TransactionContext implements TransactionContextInterface, a new one is created for every transaction
+type TransactionContext struct {
+	contractapi.TransactionContext
+	clientOrgID  string
+	peerVerified bool
+	transient    map[string][]byte
+	assets       map[string][]byte
+	redactor     *logging.Redactor
+	logger       *logging.Logger
+}
+
+// GetClientOrgID returns the MSP ID of the client, see TransactionContextInterface
+func (ctx *TransactionContext) GetClientOrgID(verifyOrg bool) (string, error) {
+	if ctx.clientOrgID == "" {
+		clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+		if err != nil {
+			return "", fmt.Errorf("failed getting client's orgID: %v", err)
+		}
+		ctx.clientOrgID = clientOrgID
+	}
+
+	if verifyOrg && !ctx.peerVerified {
+		peerOrgID, err := shim.GetMSPID()
+		if err != nil {
+			return "", fmt.Errorf("failed getting peer's orgID: %v", err)
+		}
+		if ctx.clientOrgID != peerOrgID {
+			return "", errPeerOrgForbidden.new(ctx.clientOrgID, peerOrgID)
+		}
+		ctx.peerVerified = true
+	}
+	return ctx.clientOrgID, nil
+}
+
+// GetTransient returns the transient map of the proposal
+func (ctx *TransactionContext) GetTransient() (map[string][]byte, error) {
+	if ctx.transient == nil {
+		transientMap, err := ctx.GetStub().GetTransient()
+		if err != nil {
+			return nil, err
+		}
+		if transientMap == nil {
+			transientMap = map[string][]byte{}
+		}
+		ctx.transient = transientMap
+		for _, value := range transientMap {
+			ctx.Redact(value)
+		}
+	}
+	return ctx.transient, nil
+}
+
+// GetAsset returns the public asset, see TransactionContextInterface. Every call returns a new copy,
+// which the caller is free to modify.
+func (ctx *TransactionContext) GetAsset(assetID string) (*Asset, error) {
+	assetJSON, ok := ctx.assets[assetID]
+	if !ok {
+		var err error
+		assetJSON, err = ctx.GetStub().GetState(assetID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read from world state: %v", err)
+		}
+		if ctx.assets == nil {
+			ctx.assets = make(map[string][]byte)
+		}
+		ctx.assets[assetID] = assetJSON
+	}
+	if assetJSON == nil {
+		return nil, nil
+	}
+	var asset Asset
+	err := json.Unmarshal(assetJSON, &asset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal asset %s: %v", assetID, err)
+	}
+	return &asset, nil
+}
+
+// ImplicitCollection returns the implicit private data collection of an org
+func (ctx *TransactionContext) ImplicitCollection(mspID string) *ImplicitCollection {
+	return &ImplicitCollection{MSPID: mspID, Name: buildCollectionName(mspID), stub: ctx.GetStub(), redact: ctx.Redact}
+}
+
+// ClientCollection returns the implicit collection of the client org, verified to be the peer's org
+func (ctx *TransactionContext) ClientCollection() (*ImplicitCollection, error) {
+	clientOrgID, err := ctx.GetClientOrgID(true)
+	if err != nil {
+		return nil, err
+	}
+	return ctx.ImplicitCollection(clientOrgID), nil
+}
+
+// Logger returns the logger of the transaction, see TransactionContextInterface
+func (ctx *TransactionContext) Logger() *logging.Logger {
+	if ctx.logger == nil {
+		// the transient values are secrets from the first entry on
+		_, _ = ctx.GetTransient()
+		ctx.logger = contractLogger.WithRedactor(ctx.getRedactor()).
+			With("txID", ctx.GetStub().GetTxID(), "function", middleware.Function(ctx.GetStub()))
+	}
+	return ctx.logger
+}
+
+// Redact keeps private values out of the transaction's log entries
+func (ctx *TransactionContext) Redact(values ...[]byte) {
+	ctx.getRedactor().AddSecret(values...)
+}
+
+func (ctx *TransactionContext) getRedactor() *logging.Redactor {
+	if ctx.redactor == nil {
+		ctx.redactor = logRedactor.Clone()
+	}
+	return ctx.redactor
+}
+
+// ImplicitCollection is the implicit private data collection of an org, _implicit_org_<MSP ID>
+type ImplicitCollection struct {
+	MSPID  string
+	Name   string
+	stub   shim.ChaincodeStubInterface
+	redact func(values ...[]byte)
+}
+
+// Get returns the private data of a key, only available on the peers of the org.
+// The data is redacted from the log entries of the transaction.
+func (c *ImplicitCollection) Get(key string) ([]byte, error) {
+	value, err := c.stub.GetPrivateData(c.Name, key)
+	if err == nil && c.redact != nil {
+		c.redact(value)
+	}
+	return value, err
+}
+
+// Hash returns the hash of the private data of a key, available on every peer
+func (c *ImplicitCollection) Hash(key string) ([]byte, error) {
+	return c.stub.GetPrivateDataHash(c.Name, key)
+}
+
+// Put writes the private data of a key
+func (c *ImplicitCollection) Put(key string, value []byte) error {
+	return c.stub.PutPrivateData(c.Name, key, value)
+}
+
+// Delete deletes the private data of a key
+func (c *ImplicitCollection) Delete(key string) error {
+	return c.stub.DelPrivateData(c.Name, key)
+}
+
+// GetByPartialCompositeKey queries the private data by a partial composite key
+func (c *ImplicitCollection) GetByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	return c.stub.GetPrivateDataByPartialCompositeKey(c.Name, objectType, keys)
+}
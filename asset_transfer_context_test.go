@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/guozhe001/supply-finance-chaincode-go/ledgertest"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestContext(t *testing.T, ledger *ledgertest.Ledger, tx ledgertest.Transaction) *TransactionContext {
+	stub := ledger.NewStub(tx)
+	clientIdentity, err := cid.New(stub)
+	require.NoError(t, err)
+	ctx := new(TransactionContext)
+	ctx.SetStub(stub)
+	ctx.SetClientIdentity(clientIdentity)
+	return ctx
+}
+
+func TestTransactionContextCaches(t *testing.T) {
+	identity, err := ledgertest.NewIdentity(org1MSP, "user1")
+	require.NoError(t, err)
+	ledger := ledgertest.NewLedger("mychannel")
+	ledger.PutState("asset1", []byte(mustMarshal(t, Asset{ID: "asset1", OwnerOrg: org1MSP})))
+
+	ctx := newTestContext(t, ledger, ledgertest.Transaction{Identity: identity, Transient: map[string][]byte{"request_id": []byte("r1")}})
+	asset, err := ctx.GetAsset("asset1")
+	require.NoError(t, err)
+	require.Equal(t, org1MSP, asset.OwnerOrg)
+
+	// assets are read once per transaction, callers get their own copy
+	asset.OwnerOrg = org2MSP
+	ledger.PutState("asset1", []byte(mustMarshal(t, Asset{ID: "asset1", OwnerOrg: "Org3MSP"})))
+	asset, err = ctx.GetAsset("asset1")
+	require.NoError(t, err)
+	require.Equal(t, org1MSP, asset.OwnerOrg)
+	asset, err = ctx.GetAsset("asset2")
+	require.NoError(t, err)
+	require.Nil(t, asset)
+
+	transient, err := ctx.GetTransient()
+	require.NoError(t, err)
+	require.Equal(t, []byte("r1"), transient["request_id"])
+
+	// the peer org is checked against the client org once
+	defer os.Unsetenv("CORE_PEER_LOCALMSPID")
+	os.Setenv("CORE_PEER_LOCALMSPID", org2MSP)
+	_, err = ctx.GetClientOrgID(true)
+	require.Equal(t, codeForbidden, err.(*ContractError).Code)
+	require.Equal(t, "client from org Org1MSP is not authorized to read or write private data from an org Org2MSP peer", err.(*ContractError).Message)
+	clientOrgID, err := ctx.GetClientOrgID(false)
+	require.NoError(t, err)
+	require.Equal(t, org1MSP, clientOrgID)
+	os.Setenv("CORE_PEER_LOCALMSPID", org1MSP)
+	collection, err := ctx.ClientCollection()
+	require.NoError(t, err)
+	require.Equal(t, "_implicit_org_Org1MSP", collection.Name)
+	require.NoError(t, collection.Put("asset1", []byte("secret")))
+}
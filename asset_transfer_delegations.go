@@ -0,0 +1,263 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+)
+
+const (
+	// typeDelegation prefixes the public state keys of delegations, keyed by owner org, delegate MSP and asset ID
+	typeDelegation = "DL"
+	// allAssets grants a delegation on every asset of the owner org
+	allAssets = "*"
+)
+
+// Rights an owner org can delegate
+const (
+	rightList  = "list"  // AgreeToSell
+	rightSell  = "sell"  // TransferAsset
+	rightSplit = "split" // SplitAsset
+)
+
+var delegableRights = []string{rightList, rightSell, rightSplit}
+
+// Delegation lets another org act on assets of the owner org until it expires
+type Delegation struct {
+	OwnerOrg    string    `json:"ownerOrg"`
+	DelegateMSP string    `json:"delegateMSP"`
+	AssetID     string    `json:"assetID"`
+	Rights      []string  `json:"rights"`
+	Expiry      time.Time `json:"expiry"`
+	// GrantedBy is the owner ID of the granting client, delegations only apply to assets restricted
+	// to a single client when that client granted them
+	GrantedBy string `json:"grantedBy"`
+}
+
+// GrantDelegation grants rights on an asset, or on all assets of the client's org when assetID is "*",
+// to another org until expiry, an RFC3339 timestamp. A new grant replaces the previous one.
+func (s *SmartContract) GrantDelegation(ctx TransactionContextInterface, delegateMSP string, assetID string,
+	rights []string, expiry string) error {
+	clientOrgID, err := ctx.GetClientOrgID(false)
+	if err != nil {
+		return err
+	}
+	if delegateMSP == "" || delegateMSP == clientOrgID {
+		return errInvalidMSPID.new("delegate", delegateMSP)
+	}
+	if len(rights) == 0 {
+		return errNoRights.new()
+	}
+	for _, right := range rights {
+		if !contains(delegableRights, right) {
+			return errUnknownRight.new(right, delegableRights)
+		}
+	}
+
+	expiryTime, err := time.Parse(time.RFC3339, expiry)
+	if err != nil {
+		return errInvalidExpiry.new(expiry, err)
+	}
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	if !expiryTime.After(now) {
+		return errExpiryNotInFuture.new(expiry)
+	}
+
+	if assetID != allAssets {
+		asset, err := s.ReadAsset(ctx, assetID)
+		if err != nil {
+			return err
+		}
+		if clientOrgID != asset.OwnerOrg {
+			return errNotOwnerOrg.new(clientOrgID, "delegate", asset.OwnerOrg)
+		}
+		err = verifyClientOwnerID(ctx, asset, "delegate")
+		if err != nil {
+			return err
+		}
+	}
+
+	grantedBy, err := getClientOwnerID(ctx)
+	if err != nil {
+		return err
+	}
+	delegation := Delegation{
+		OwnerOrg:    clientOrgID,
+		DelegateMSP: delegateMSP,
+		AssetID:     assetID,
+		Rights:      rights,
+		Expiry:      expiryTime.UTC(),
+		GrantedBy:   grantedBy,
+	}
+	delegationJSON, err := json.Marshal(delegation)
+	if err != nil {
+		return err
+	}
+	delegationKey, err := ctx.GetStub().CreateCompositeKey(typeDelegation, []string{clientOrgID, delegateMSP, assetID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	err = ctx.GetStub().PutState(delegationKey, delegationJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put delegation: %v", err)
+	}
+	// Only the owner org can change or revoke the delegation
+	err = setAssetStateBasedEndorsement(ctx, delegationKey, clientOrgID)
+	if err != nil {
+		return fmt.Errorf("failed setting state based endorsement for delegation: %v", err)
+	}
+	return nil
+}
+
+// RevokeDelegation revokes the delegation of the client's org to another org on an asset, or on all assets
+func (s *SmartContract) RevokeDelegation(ctx TransactionContextInterface, delegateMSP string, assetID string) error {
+	clientOrgID, err := ctx.GetClientOrgID(false)
+	if err != nil {
+		return err
+	}
+	delegation, err := getDelegation(ctx, clientOrgID, delegateMSP, assetID)
+	if err != nil {
+		return err
+	}
+	if delegation == nil {
+		return errDelegationNotFound.new(delegateMSP, clientOrgID, assetID)
+	}
+
+	delegationKey, err := ctx.GetStub().CreateCompositeKey(typeDelegation, []string{clientOrgID, delegateMSP, assetID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	err = ctx.GetStub().DelState(delegationKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete delegation: %v", err)
+	}
+	return nil
+}
+
+// QueryDelegations returns the delegations granted by an org, including expired ones
+func (s *SmartContract) QueryDelegations(ctx TransactionContextInterface, ownerOrg string) ([]*Delegation, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(typeDelegation, []string{ownerOrg})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read delegations: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	delegations := []*Delegation{}
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var delegation Delegation
+		err = json.Unmarshal(response.Value, &delegation)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal delegation: %v", err)
+		}
+		delegations = append(delegations, &delegation)
+	}
+	return delegations, nil
+}
+
+func getDelegation(ctx TransactionContextInterface, ownerOrg string, delegateMSP string, assetID string) (*Delegation, error) {
+	delegationKey, err := ctx.GetStub().CreateCompositeKey(typeDelegation, []string{ownerOrg, delegateMSP, assetID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	delegationJSON, err := ctx.GetStub().GetState(delegationKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read delegation: %v", err)
+	}
+	if delegationJSON == nil {
+		return nil, nil
+	}
+	var delegation Delegation
+	err = json.Unmarshal(delegationJSON, &delegation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal delegation: %v", err)
+	}
+	return &delegation, nil
+}
+
+// authorizeAssetAction checks that the client may act on an asset, either as its owner or through an
+// active delegation of the owner org granting the right. The delegation is returned when the client acts
+// on behalf of the owner, nil when it is the owner.
+func authorizeAssetAction(ctx TransactionContextInterface, asset *Asset, right string) (*Delegation, error) {
+	clientOrgID, err := ctx.GetClientOrgID(false)
+	if err != nil {
+		return nil, err
+	}
+	if clientOrgID == asset.OwnerOrg {
+		return nil, verifyClientOwnerID(ctx, asset, right)
+	}
+
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var expired *Delegation
+	for _, assetID := range []string{asset.ID, allAssets} {
+		delegation, err := getDelegation(ctx, asset.OwnerOrg, clientOrgID, assetID)
+		if err != nil {
+			return nil, err
+		}
+		if delegation == nil || !contains(delegation.Rights, right) {
+			continue
+		}
+		if asset.OwnerID != "" && delegation.GrantedBy != asset.OwnerID {
+			continue
+		}
+		if !now.Before(delegation.Expiry) {
+			expired = delegation
+			continue
+		}
+		return delegation, nil
+	}
+	// clients relying on a delegation that ran out are told so, they have to ask the owner for a new grant
+	if expired != nil {
+		return nil, errDelegationExpired.new(asset.OwnerOrg, clientOrgID, asset.ID, expired.Expiry.Format(time.RFC3339))
+	}
+	return nil, errNotOwnerOrg.new(clientOrgID, right, asset.OwnerOrg)
+}
+
+// getDelegatedAssetProperties returns the asset properties passed in the transient map by a delegate,
+// which cannot read the owner's collection, after checking them against the owner's on-chain hash
+func getDelegatedAssetProperties(ctx TransactionContextInterface, asset *Asset) ([]byte, error) {
+	transientMap, err := ctx.GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("error getting transient: %v", err)
+	}
+	immutablePropertiesJSON, ok := transientMap["asset_properties"]
+	if !ok {
+		return nil, errTransientKeyMissing.new("asset_properties")
+	}
+
+	onChainHash, err := getPropertiesHash(ctx, asset)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := hashMatches("asset_properties", onChainHash, immutablePropertiesJSON)
+	if err != nil {
+		return nil, err
+	}
+	if !matches {
+		return nil, errPropertiesHashMismatch.new(onChainHash)
+	}
+	return canonicalPayload("asset_properties", immutablePropertiesJSON)
+}
+
+func getTxTime(ctx TransactionContextInterface) (time.Time, error) {
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	return ptypes.Timestamp(txTimestamp)
+}
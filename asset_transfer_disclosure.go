@@ -0,0 +1,114 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/guozhe001/supply-finance-chaincode-go/canonicaljson"
+	"github.com/guozhe001/supply-finance-chaincode-go/merkle"
+)
+
+// transientPropertyProofs is a JSON array of merkle.Proof disclosing individual asset properties
+const transientPropertyProofs = "property_proofs"
+
+// GetAssetPropertyProofs returns inclusion proofs of the given fields of the asset properties, such as
+// "issuer" and "endDate", that the owner can share with a buyer instead of the whole properties.
+// Only the owner org can read the properties from its own peer.
+func (s *SmartContract) GetAssetPropertyProofs(ctx TransactionContextInterface, assetID string, fields []string) ([]*merkle.Proof, error) {
+	immutableProperties, err := getAssetPrivateProperties(ctx, assetID)
+	if err != nil {
+		return nil, err
+	}
+	assetProperties, err := getAssetProperties(immutableProperties)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := propertiesTree(assetProperties)
+	if err != nil {
+		return nil, err
+	}
+
+	proofs := make([]*merkle.Proof, len(fields))
+	for i, field := range fields {
+		proofs[i], err = tree.Prove(field)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return proofs, nil
+}
+
+// VerifyAssetPropertyProofs allows a buyer to validate individual properties of an asset, disclosed by the
+// owner with GetAssetPropertyProofs and passed in the transient map, against the public properties root
+func (s *SmartContract) VerifyAssetPropertyProofs(ctx TransactionContextInterface, assetID string) (bool, error) {
+	transMap, err := ctx.GetTransient()
+	if err != nil {
+		return false, fmt.Errorf("error getting transient: %v", err)
+	}
+	proofsJSON, ok := transMap[transientPropertyProofs]
+	if !ok {
+		return false, errTransientKeyMissing.new(transientPropertyProofs)
+	}
+	proofs, err := validatePropertyProofs(ctx, proofsJSON)
+	if err != nil {
+		return false, err
+	}
+
+	asset, err := s.ReadAsset(ctx, assetID)
+	if err != nil {
+		return false, err
+	}
+	if asset.PropertiesRoot == "" {
+		return false, errPropertiesRootNotFound.new(assetID)
+	}
+	root, err := hex.DecodeString(asset.PropertiesRoot)
+	if err != nil {
+		return false, fmt.Errorf("invalid properties root of asset %s: %v", assetID, err)
+	}
+	err = merkle.VerifyAll(root, proofs)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// propertiesTree commits to every field of the asset properties but the salt, which hides them
+func propertiesTree(assetProperties AssetProperties) (*merkle.Tree, error) {
+	values := []struct {
+		name  string
+		value interface{}
+	}{
+		{"objectType", assetProperties.ObjectType},
+		{"assetID", assetProperties.ID},
+		{"issuer", assetProperties.Issuer},
+		{"amount", assetProperties.Amount},
+		{"createDate", assetProperties.CreateDate},
+		{"endDate", assetProperties.EndDate},
+	}
+	fields := make([]merkle.Field, len(values))
+	for i, v := range values {
+		valueJSON, err := canonicaljson.Marshal(v.value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal property %s: %v", v.name, err)
+		}
+		fields[i] = merkle.Field{Name: v.name, Value: valueJSON}
+	}
+	return merkle.New([]byte(assetProperties.Salt), fields)
+}
+
+// propertiesRoot returns the hex encoded root of the commitment to the asset properties
+func propertiesRoot(immutablePropertiesJSON []byte) (string, error) {
+	assetProperties, err := getAssetProperties(immutablePropertiesJSON)
+	if err != nil {
+		return "", err
+	}
+	tree, err := propertiesTree(assetProperties)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(tree.Root()), nil
+}
@@ -0,0 +1,192 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/guozhe001/supply-finance-chaincode-go/events"
+)
+
+const (
+	// transientPropertiesKey is the AES-256 key the owner encrypts its asset properties with at rest
+	transientPropertiesKey = "properties_key"
+	// typeEncryptedProperties is the object type of encrypted asset properties in a private data collection
+	typeEncryptedProperties = "encrypted_asset_properties"
+)
+
+// encryptedProperties are asset properties encrypted with AES-GCM under a key held by the owner org only,
+// so that they cannot be read from the database of the owner's peers
+type encryptedProperties struct {
+	ObjectType string `json:"objectType"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// EncryptAssetProperties encrypts the stored private properties of an asset of the client's org under
+// the key passed in the transient map, such as the properties of an asset just bought
+func (s *SmartContract) EncryptAssetProperties(ctx TransactionContextInterface, assetID string) error {
+	asset, err := s.ReadAsset(ctx, assetID)
+	if err != nil {
+		return err
+	}
+	clientOrgID, err := ctx.GetClientOrgID(true)
+	if err != nil {
+		return err
+	}
+	if clientOrgID != asset.OwnerOrg {
+		return errNotOwnerOrg.new(clientOrgID, "encrypt", asset.OwnerOrg)
+	}
+	err = verifyClientOwnerID(ctx, asset, "encrypt")
+	if err != nil {
+		return err
+	}
+
+	collection := ctx.ImplicitCollection(clientOrgID)
+	storedProperties, err := collection.Get(assetID)
+	if err != nil {
+		return fmt.Errorf("failed to read asset private properties from client org's collection: %v", err)
+	}
+	if storedProperties == nil {
+		return errPrivatePropertiesNotFound.new(assetID)
+	}
+	if isEncryptedProperties(storedProperties) {
+		return errPropertiesEncrypted.new(assetID)
+	}
+
+	previous := *asset
+	encrypted, err := putAssetProperties(ctx, collection, asset, storedProperties)
+	if err != nil {
+		return err
+	}
+	if !encrypted {
+		return errTransientKeyMissing.new(transientPropertiesKey)
+	}
+	err = putAsset(ctx, &previous, asset)
+	if err != nil {
+		return err
+	}
+	return emitAssetEvent(ctx, events.AssetPropertiesEncrypted, asset)
+}
+
+// putAssetProperties stores the private properties of an asset in a collection, encrypted when the client
+// passed a properties key. The plaintext hash of encrypted properties is recorded on the asset, as the
+// private data hash then commits to the ciphertext. It reports whether the properties were encrypted.
+func putAssetProperties(ctx TransactionContextInterface, collection *ImplicitCollection, asset *Asset, immutablePropertiesJSON []byte) (bool, error) {
+	transientMap, err := ctx.GetTransient()
+	if err != nil {
+		return false, fmt.Errorf("error getting transient: %v", err)
+	}
+	key, ok := transientMap[transientPropertiesKey]
+	if !ok {
+		err = collection.Put(asset.ID, immutablePropertiesJSON)
+		if err != nil {
+			return false, fmt.Errorf("failed to put Asset private details: %v", err)
+		}
+		return false, nil
+	}
+
+	aead, err := newPropertiesAEAD(key)
+	if err != nil {
+		return false, err
+	}
+	// Every endorser must produce the same ciphertext, the nonce is unique to the transaction and asset
+	nonceSeed := sha256.Sum256([]byte(ctx.GetStub().GetTxID() + "\x00" + asset.ID))
+	nonce := nonceSeed[:aead.NonceSize()]
+	stored, err := json.Marshal(encryptedProperties{
+		ObjectType: typeEncryptedProperties,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, immutablePropertiesJSON, []byte(asset.ID)),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal encrypted properties: %v", err)
+	}
+	err = collection.Put(asset.ID, stored)
+	if err != nil {
+		return false, fmt.Errorf("failed to put Asset private details: %v", err)
+	}
+
+	propertiesHash := sha256.Sum256(immutablePropertiesJSON)
+	asset.PropertiesHash = hex.EncodeToString(propertiesHash[:])
+	return true, nil
+}
+
+// decryptAssetProperties returns the plaintext of stored private properties, decrypting them with the
+// properties key passed in the transient map when they are encrypted
+func decryptAssetProperties(ctx TransactionContextInterface, assetID string, storedProperties []byte) ([]byte, error) {
+	if !isEncryptedProperties(storedProperties) {
+		return storedProperties, nil
+	}
+	var encrypted encryptedProperties
+	if err := json.Unmarshal(storedProperties, &encrypted); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal encrypted properties: %v", err)
+	}
+
+	transientMap, err := ctx.GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("error getting transient: %v", err)
+	}
+	key, ok := transientMap[transientPropertiesKey]
+	if !ok {
+		return nil, errPropertiesKeyMissing.new(assetID, transientPropertiesKey)
+	}
+	aead, err := newPropertiesAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(encrypted.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce of asset %s properties", assetID)
+	}
+	plaintext, err := aead.Open(nil, encrypted.Nonce, encrypted.Ciphertext, []byte(assetID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt asset %s properties, wrong %s", assetID, transientPropertiesKey)
+	}
+	ctx.Redact(plaintext)
+	return plaintext, nil
+}
+
+// getPropertiesHash returns the on-chain commitment to the plaintext properties of an asset: the plaintext
+// hash recorded with encrypted properties, otherwise the hash of the private data in the owner's collection
+func getPropertiesHash(ctx TransactionContextInterface, asset *Asset) ([]byte, error) {
+	if asset.PropertiesHash != "" {
+		propertiesHash, err := hex.DecodeString(asset.PropertiesHash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid properties hash of asset %s: %v", asset.ID, err)
+		}
+		return propertiesHash, nil
+	}
+
+	propertiesHash, err := ctx.ImplicitCollection(asset.OwnerOrg).Hash(asset.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read asset private properties hash from owner's collection: %v", err)
+	}
+	if propertiesHash == nil {
+		return nil, errPropertiesHashNotFound.new(asset.ID)
+	}
+	return propertiesHash, nil
+}
+
+func isEncryptedProperties(storedProperties []byte) bool {
+	var object struct {
+		ObjectType string `json:"objectType"`
+	}
+	return json.Unmarshal(storedProperties, &object) == nil && object.ObjectType == typeEncryptedProperties
+}
+
+func newPropertiesAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, errInvalidAESKey.new(transientPropertiesKey)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,185 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/msp"
+)
+
+// Parties of an asset that endorsement policy templates refer to
+const (
+	partyOwner     = "owner"
+	partyFinancier = "financier"
+	partyGuarantor = "guarantor" // the guarantor orgs of the asset
+)
+
+// endorsementRule is a policy template: either a single party that must endorse, or a rule requiring
+// N of its sub-rules. A party that resolves to several orgs, such as the guarantors, counts as one
+// sub-rule satisfied by any of them, or by all of them if All is set.
+type endorsementRule struct {
+	Party string
+	All   bool
+	N     int
+	Rules []endorsementRule
+}
+
+func signedBy(party string) endorsementRule {
+	return endorsementRule{Party: party}
+}
+
+func signedByAll(party string) endorsementRule {
+	return endorsementRule{Party: party, All: true}
+}
+
+func outOf(n int, rules ...endorsementRule) endorsementRule {
+	return endorsementRule{N: n, Rules: rules}
+}
+
+func allOf(rules ...endorsementRule) endorsementRule {
+	return outOf(len(rules), rules...)
+}
+
+func anyOf(rules ...endorsementRule) endorsementRule {
+	return outOf(1, rules...)
+}
+
+// statusEndorsementPolicies configures the state-based endorsement policy of an asset for each status.
+// The policy is applied whenever an asset is written with a status or parties different from before.
+// Offered pledges already need the financier, so that only it can accept them. Offered guarantees only need
+// the owner, so that it can withdraw an offer that some guarantor never answers.
+// 质押资产需要资产拥有方和资金方共同背书，担保资产需要资产拥有方和任一担保方共同背书
+var statusEndorsementPolicies = map[string]endorsementRule{
+	statusEnable:           signedBy(partyOwner),
+	statusDelete:           signedBy(partyOwner),
+	statusPledgeOffered:    allOf(signedBy(partyOwner), signedBy(partyFinancier)),
+	statusPledged:          allOf(signedBy(partyOwner), signedBy(partyFinancier)),
+	statusGuaranteeOffered: signedBy(partyOwner),
+	statusGuaranteed:       allOf(signedBy(partyOwner), signedBy(partyGuarantor)),
+}
+
+// applyEndorsementPolicy sets the endorsement policy of the asset's status when the asset is created or
+// the policy differs from the one of the previous version
+func applyEndorsementPolicy(ctx TransactionContextInterface, previous *Asset, asset *Asset) error {
+	policy, err := assetEndorsementPolicy(asset)
+	if err != nil {
+		return err
+	}
+	if previous != nil {
+		previousPolicy, err := assetEndorsementPolicy(previous)
+		if err == nil && bytes.Equal(previousPolicy, policy) {
+			return nil
+		}
+	}
+	err = ctx.GetStub().SetStateValidationParameter(asset.ID, policy)
+	if err != nil {
+		return fmt.Errorf("failed setting state based endorsement for %s asset %s: %v", asset.Status, asset.ID, err)
+	}
+	return nil
+}
+
+// assetEndorsementPolicy builds the marshaled signature policy of the asset's status
+func assetEndorsementPolicy(asset *Asset) ([]byte, error) {
+	template, ok := statusEndorsementPolicies[asset.Status]
+	if !ok {
+		return nil, errNoEndorsementPolicy.new(asset.Status)
+	}
+
+	builder := &policyBuilder{principals: make(map[string]int32)}
+	rule, err := builder.build(template, asset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build endorsement policy of asset %s: %v", asset.ID, err)
+	}
+	envelope := &common.SignaturePolicyEnvelope{Version: 0, Rule: rule}
+	for _, mspID := range builder.mspIDs {
+		role, err := proto.Marshal(&msp.MSPRole{MspIdentifier: mspID, Role: msp.MSPRole_MEMBER})
+		if err != nil {
+			return nil, err
+		}
+		envelope.Identities = append(envelope.Identities, &msp.MSPPrincipal{
+			PrincipalClassification: msp.MSPPrincipal_ROLE,
+			Principal:               role,
+		})
+	}
+	return proto.Marshal(envelope)
+}
+
+// policyBuilder turns a template into a signature policy, collecting the principals it signs by
+type policyBuilder struct {
+	mspIDs     []string
+	principals map[string]int32
+}
+
+func (b *policyBuilder) build(rule endorsementRule, asset *Asset) (*common.SignaturePolicy, error) {
+	if rule.Party == "" {
+		if rule.N < 1 || rule.N > len(rule.Rules) {
+			return nil, fmt.Errorf("invalid rule requiring %d of %d rules", rule.N, len(rule.Rules))
+		}
+		rules := make([]*common.SignaturePolicy, len(rule.Rules))
+		for i, subRule := range rule.Rules {
+			policy, err := b.build(subRule, asset)
+			if err != nil {
+				return nil, err
+			}
+			rules[i] = policy
+		}
+		return nOutOf(int32(rule.N), rules), nil
+	}
+
+	mspIDs, err := partyOrgs(asset, rule.Party)
+	if err != nil {
+		return nil, err
+	}
+	if len(mspIDs) == 1 {
+		return b.signedBy(mspIDs[0]), nil
+	}
+	rules := make([]*common.SignaturePolicy, len(mspIDs))
+	for i, mspID := range mspIDs {
+		rules[i] = b.signedBy(mspID)
+	}
+	if rule.All {
+		return nOutOf(int32(len(rules)), rules), nil
+	}
+	return nOutOf(1, rules), nil
+}
+
+func (b *policyBuilder) signedBy(mspID string) *common.SignaturePolicy {
+	index, ok := b.principals[mspID]
+	if !ok {
+		index = int32(len(b.mspIDs))
+		b.principals[mspID] = index
+		b.mspIDs = append(b.mspIDs, mspID)
+	}
+	return &common.SignaturePolicy{Type: &common.SignaturePolicy_SignedBy{SignedBy: index}}
+}
+
+func nOutOf(n int32, rules []*common.SignaturePolicy) *common.SignaturePolicy {
+	return &common.SignaturePolicy{Type: &common.SignaturePolicy_NOutOf_{NOutOf: &common.SignaturePolicy_NOutOf{N: n, Rules: rules}}}
+}
+
+// partyOrgs resolves a party of a policy template to the MSPs of the asset
+func partyOrgs(asset *Asset, party string) ([]string, error) {
+	var mspIDs []string
+	switch party {
+	case partyOwner:
+		mspIDs = []string{asset.OwnerOrg}
+	case partyFinancier:
+		mspIDs = []string{asset.FinancierOrg}
+	case partyGuarantor:
+		mspIDs = append(mspIDs, asset.GuarantorOrgs...)
+		sort.Strings(mspIDs)
+	default:
+		return nil, fmt.Errorf("unknown party %s", party)
+	}
+	if len(mspIDs) == 0 || mspIDs[0] == "" {
+		return nil, errAssetPartyNotFound.new(asset.ID, party)
+	}
+	return mspIDs, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/guozhe001/supply-finance-chaincode-go/ledgertest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssetEndorsementPolicyTemplates(t *testing.T) {
+	asset := &Asset{ID: "asset1", OwnerOrg: "Org1MSP", FinancierOrg: "Org3MSP", GuarantorOrgs: []string{"Org2MSP", "Org4MSP"}, Status: statusPledged}
+	policy, err := assetEndorsementPolicy(asset)
+	require.NoError(t, err)
+	satisfied := func(endorsers ...string) bool {
+		ok, err := ledgertest.SatisfiesPolicy(policy, endorsers)
+		require.NoError(t, err)
+		return ok
+	}
+	require.True(t, satisfied("Org1MSP", "Org3MSP"))
+	require.False(t, satisfied("Org1MSP", "Org2MSP"))
+
+	// an offered guarantee needs the owner only, a guarantee any one of the guarantors as well
+	asset.Status = statusGuaranteeOffered
+	policy, err = assetEndorsementPolicy(asset)
+	require.NoError(t, err)
+	require.True(t, satisfied("Org1MSP"))
+	require.False(t, satisfied("Org2MSP", "Org4MSP"))
+	asset.Status = statusGuaranteed
+	policy, err = assetEndorsementPolicy(asset)
+	require.NoError(t, err)
+	require.True(t, satisfied("Org1MSP", "Org4MSP"))
+	require.False(t, satisfied("Org1MSP"))
+
+	defer func(policies map[string]endorsementRule) { statusEndorsementPolicies = policies }(statusEndorsementPolicies)
+	statusEndorsementPolicies = map[string]endorsementRule{
+		statusPledged:    outOf(2, signedBy(partyOwner), signedBy(partyFinancier), signedBy(partyGuarantor)),
+		statusGuaranteed: allOf(signedBy(partyOwner), signedByAll(partyGuarantor)),
+	}
+	asset.Status = statusPledged
+	policy, err = assetEndorsementPolicy(asset)
+	require.NoError(t, err)
+	require.True(t, satisfied("Org2MSP", "Org3MSP"))
+	require.False(t, satisfied("Org1MSP"))
+	asset.Status = statusGuaranteed
+	policy, err = assetEndorsementPolicy(asset)
+	require.NoError(t, err)
+	require.True(t, satisfied("Org1MSP", "Org2MSP", "Org4MSP"))
+	require.False(t, satisfied("Org1MSP", "Org2MSP"))
+
+	_, err = assetEndorsementPolicy(&Asset{ID: "asset1", OwnerOrg: "Org1MSP", FinancierOrg: "Org3MSP", Status: statusPledged})
+	require.Error(t, err)
+	_, err = assetEndorsementPolicy(&Asset{ID: "asset1", OwnerOrg: "Org1MSP", Status: statusEnable})
+	require.Error(t, err)
+}
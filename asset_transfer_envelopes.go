@@ -0,0 +1,136 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/guozhe001/supply-finance-chaincode-go/envelope"
+	"github.com/guozhe001/supply-finance-chaincode-go/events"
+)
+
+const (
+	// typeOrgEncryptionKey prefixes the public state keys of the registered org encryption keys
+	typeOrgEncryptionKey = "EK"
+	// transientEventRecipients is a JSON array of the MSP IDs the private event payload is sealed to
+	transientEventRecipients = "event_recipients"
+	// transientEventEntropy is client supplied randomness, shared by all endorsers, used to seal envelopes deterministically
+	transientEventEntropy = "event_entropy"
+	// minEventEntropy is the minimum number of bytes of event entropy
+	minEventEntropy = 16
+)
+
+// RegisterOrgEncryptionKey registers the P-256 public key, PEM encoded as PUBLIC KEY or CERTIFICATE,
+// that private event payloads for the client's org are encrypted to. A registered key replaces the previous one.
+func (s *SmartContract) RegisterOrgEncryptionKey(ctx TransactionContextInterface, publicKeyPEM string) error {
+	clientOrgID, err := ctx.GetClientOrgID(false)
+	if err != nil {
+		return err
+	}
+
+	if _, err := envelope.ParsePublicKeyPEM([]byte(publicKeyPEM)); err != nil {
+		return errInvalidPublicKey.new("encryption key", err)
+	}
+
+	keyKey, err := ctx.GetStub().CreateCompositeKey(typeOrgEncryptionKey, []string{clientOrgID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	err = ctx.GetStub().PutState(keyKey, []byte(publicKeyPEM))
+	if err != nil {
+		return fmt.Errorf("failed to put encryption key for %s: %v", clientOrgID, err)
+	}
+	// Only the org can replace its key
+	err = setAssetStateBasedEndorsement(ctx, keyKey, clientOrgID)
+	if err != nil {
+		return fmt.Errorf("failed setting state based endorsement for encryption key: %v", err)
+	}
+	return nil
+}
+
+// GetOrgEncryptionKey returns the PEM encoded encryption key registered by an org
+func (s *SmartContract) GetOrgEncryptionKey(ctx TransactionContextInterface, mspID string) (string, error) {
+	publicKeyPEM, err := getOrgEncryptionKey(ctx, mspID)
+	if err != nil {
+		return "", err
+	}
+	return string(publicKeyPEM), nil
+}
+
+func getOrgEncryptionKey(ctx TransactionContextInterface, mspID string) ([]byte, error) {
+	keyKey, err := ctx.GetStub().CreateCompositeKey(typeOrgEncryptionKey, []string{mspID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	publicKeyPEM, err := ctx.GetStub().GetState(keyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption key of %s: %v", mspID, err)
+	}
+	if publicKeyPEM == nil {
+		return nil, errEncryptionKeyNotFound.new(mspID)
+	}
+	return publicKeyPEM, nil
+}
+
+// sealEventPayload encrypts a private payload to every recipient listed in the transient map and attaches
+// the envelopes to the event. Nothing is sealed when the client asked for no recipients.
+func sealEventPayload(ctx TransactionContextInterface, event *events.AssetEvent, payload []byte) error {
+	transientMap, err := ctx.GetTransient()
+	if err != nil {
+		return fmt.Errorf("error getting transient: %v", err)
+	}
+	recipientsJSON, ok := transientMap[transientEventRecipients]
+	if !ok {
+		return nil
+	}
+	recipients, err := validateEventRecipients(ctx, recipientsJSON)
+	if err != nil {
+		return err
+	}
+
+	// Every endorser must produce the same envelope, so the randomness of the encryption comes from
+	// the client through the transient map rather than from the peer.
+	entropy := transientMap[transientEventEntropy]
+	if len(entropy) < minEventEntropy {
+		return errTransientTooShort.new(transientEventEntropy, minEventEntropy)
+	}
+
+	for _, recipient := range recipients {
+		publicKeyPEM, err := getOrgEncryptionKey(ctx, recipient)
+		if err != nil {
+			return err
+		}
+		publicKey, err := envelope.ParsePublicKeyPEM(publicKeyPEM)
+		if err != nil {
+			return fmt.Errorf("invalid encryption key of %s: %v", recipient, err)
+		}
+
+		seed := sha256.New()
+		seed.Write(entropy)
+		seed.Write([]byte(event.TxID))
+		seed.Write([]byte(event.Type))
+		seed.Write([]byte(recipient))
+		sealed, err := envelope.Seal(envelope.DeterministicReader(seed.Sum(nil)), recipient, publicKey, payload, event.AdditionalData())
+		if err != nil {
+			return fmt.Errorf("failed to seal event payload for %s: %v", recipient, err)
+		}
+		event.Envelopes = append(event.Envelopes, *sealed)
+	}
+	return nil
+}
+
+// emitSealedAssetEvent emits an event for an asset carrying payload encrypted to the requested recipients
+func emitSealedAssetEvent(ctx TransactionContextInterface, eventType string, asset *Asset, payload []byte) error {
+	event, err := newAssetEvent(ctx, eventType, asset)
+	if err != nil {
+		return err
+	}
+	err = sealEventPayload(ctx, event, payload)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, event)
+}
@@ -0,0 +1,118 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import "github.com/guozhe001/supply-finance-chaincode-go/contracterror"
+
+// errorCode identifies the kind of error a transaction failed with, see contracterror.Code
+type errorCode = contracterror.Code
+
+const (
+	codeNotFound        = contracterror.NotFound
+	codeAlreadyExists   = contracterror.AlreadyExists
+	codeNotOwner        = contracterror.NotOwner
+	codeBadStatus       = contracterror.BadStatus
+	codeHashMismatch    = contracterror.HashMismatch
+	codeBadSignature    = contracterror.BadSignature
+	codeExpired         = contracterror.Expired
+	codeForbidden       = contracterror.Forbidden
+	codeInvalidArgument = contracterror.InvalidArgument
+	codeConflict        = contracterror.Conflict
+	codePaused          = contracterror.Paused
+	codeInternal        = contracterror.Internal
+)
+
+// errorMessage is an entry of the error catalog, its messages take the same arguments in every language
+type errorMessage struct {
+	code errorCode
+	en   string
+	zh   string
+}
+
+// the error catalog
+var (
+	errAssetNotFound             = errorMessage{codeNotFound, "asset %s does not exist", "资产%s不存在"}
+	errPrivatePropertiesNotFound = errorMessage{codeNotFound, "asset private details does not exist in client org's collection: %s", "本组织的私有数据集合中不存在资产%s的属性"}
+	errPropertiesHashNotFound    = errorMessage{codeNotFound, "asset private properties hash does not exist: %s", "资产%s的属性哈希不存在"}
+	errPropertiesRootNotFound    = errorMessage{codeNotFound, "asset %s has no properties root", "资产%s没有属性默克尔根"}
+	errPriceNotFound             = errorMessage{codeNotFound, "asset price does not exist: %s", "资产%s的价格不存在"}
+	errSellerPriceNotFound       = errorMessage{codeNotFound, "seller price for %s does not exist", "资产%s的卖方价格不存在"}
+	errBuyerPriceNotFound        = errorMessage{codeNotFound, "buyer price for %s does not exist", "资产%s的买方价格不存在"}
+	errIssuerKeyNotFound         = errorMessage{codeNotFound, "%s has not registered an issuer key", "%s尚未登记发行方公钥"}
+	errIssuerSignatureNotFound   = errorMessage{codeNotFound, "asset %s has no issuer signature", "资产%s没有发行方签名"}
+	errIssuerKeyVersionNotFound  = errorMessage{codeNotFound, "%s has not registered issuer key %s", "%[1]s未登记发行方公钥%[2]s"}
+	errEncryptionKeyNotFound     = errorMessage{codeNotFound, "%s has not registered an encryption key", "%s尚未登记加密公钥"}
+	errDelegationNotFound        = errorMessage{codeNotFound, "%s has no delegation from %s on %s", "%[1]s没有%[2]s对%[3]s的授权"}
+	errAssetPartyNotFound        = errorMessage{codeNotFound, "asset %s has no %s", "资产%[1]s没有%[2]s"}
+	errOperatorOrgNotFound       = errorMessage{codeNotFound, "no operator org has been set", "尚未设置运维组织"}
+
+	errAssetExists     = errorMessage{codeAlreadyExists, "asset %s already exists", "资产%s已存在"}
+	errAlreadyAccepted = errorMessage{codeAlreadyExists, "%s already accepted the %s of asset %s", "%[1]s已接受资产%[3]s的%[2]s"}
+
+	errNotOwnerOrg    = errorMessage{codeNotOwner, "a client from %s cannot %s an asset owned by %s", "%[1]s的客户端无权操作%[3]s持有的资产"}
+	errNotOwnerClient = errorMessage{codeNotOwner, "client %s cannot %s asset %s owned by another client of %s", "客户端%[1]s无权操作%[4]s其他客户端持有的资产%[3]s"}
+
+	errAssetNotTradable    = errorMessage{codeBadStatus, "asset %s is %s and cannot be traded", "资产%[1]s不可用（%[2]s），不允许交易"}
+	errAssetNotModifiable  = errorMessage{codeBadStatus, "asset %s is %s and cannot be changed", "资产%[1]s不可用（%[2]s），不允许修改"}
+	errAssetNotEnabled     = errorMessage{codeBadStatus, "asset %s is %s, only enabled assets can be %sd", "资产%[1]s的状态为%[2]s，只有可用的资产才能质押或担保"}
+	errAssetNotEncumbered  = errorMessage{codeBadStatus, "asset %s is neither pledged nor guaranteed", "资产%s既未质押也未担保"}
+	errAssetNotOffered     = errorMessage{codeBadStatus, "asset %s has no %s waiting to be accepted", "资产%[1]s没有待接受的%[2]s"}
+	errPropertiesEncrypted = errorMessage{codeBadStatus, "asset %s properties are already encrypted", "资产%s的属性已经加密"}
+	errNoEndorsementPolicy = errorMessage{codeBadStatus, "no endorsement policy for status %s", "状态%s没有背书策略"}
+	errNotPaused           = errorMessage{codeBadStatus, "contract is not paused", "合约未暂停"}
+
+	errPropertiesHashMismatch  = errorMessage{codeHashMismatch, "passed immutable properties do not match on-chain hash %x", "传入的资产属性与链上哈希%x不一致"}
+	errSellerPriceHashMismatch = errorMessage{codeHashMismatch, "passed price does not match on-chain hash %x, seller hasn't agreed to the passed trade id and price", "传入的价格与链上哈希%x不一致，卖方未同意该交易编号和价格"}
+	errBuyerPriceHashMismatch  = errorMessage{codeHashMismatch, "passed price does not match on-chain hash %x, buyer hasn't agreed to the passed trade id and price", "传入的价格与链上哈希%x不一致，买方未同意该交易编号和价格"}
+	errSignatureMismatch       = errorMessage{codeHashMismatch, "issuer signature of asset %s does not cover the passed properties", "资产%s的发行方签名与传入的属性不一致"}
+	errIssuerMismatch          = errorMessage{codeHashMismatch, "asset %s is issued by %s but its properties name another issuer", "资产%[1]s的发行方为%[2]s，但属性中的发行方与之不符"}
+
+	errMalformedSignature     = errorMessage{codeBadSignature, "malformed signature", "签名格式错误"}
+	errSignatureInvalid       = errorMessage{codeBadSignature, "signature does not verify", "签名验证失败"}
+	errIssuerSignatureFail    = errorMessage{codeBadSignature, "issuer signature of asset %s does not verify with the key of %s: %v", "资产%[1]s的发行方签名无法用%[2]s的公钥验证"}
+	errInvalidIssuerSignature = errorMessage{codeBadSignature, "invalid issuer signature for asset %s: %v", "资产%[1]s的发行方签名无效"}
+
+	errDelegationExpired = errorMessage{codeExpired, "delegation from %s to %s on asset %s expired at %s", "%[1]s授予%[2]s的资产%[3]s的授权已于%[4]s过期"}
+
+	errRoleForbidden    = errorMessage{codeForbidden, "client with roles %v is not allowed to call %s", "角色为%[1]v的客户端无权调用%[2]s"}
+	errPeerOrgForbidden = errorMessage{codeForbidden, "client from org %s is not authorized to read or write private data from an org %s peer", "%[1]s的客户端无权通过%[2]s的节点读写私有数据"}
+	errNotIssuer        = errorMessage{codeForbidden, "a client from %s cannot attest an asset issued by %s", "%[1]s的客户端不能证明%[2]s发行的资产"}
+	errAcceptForbidden  = errorMessage{codeForbidden, "a client from %s cannot accept the %s of asset %s", "%[1]s的客户端不能接受资产%[3]s的%[2]s"}
+	errReleaseForbidden = errorMessage{codeForbidden, "a client from %s cannot release asset %s", "%[1]s的客户端不能解除资产%[2]s的质押或担保"}
+	errPauseForbidden   = errorMessage{codeForbidden, "a client from %s cannot pause the contract, only the operator org can", "%s的客户端不能暂停合约，只有运维组织可以"}
+	errResumeForbidden  = errorMessage{codeForbidden, "contract is paused by %s, a client from %s cannot resume it", "合约已被%[1]s暂停，%[2]s的客户端不能恢复"}
+	errNotOperator      = errorMessage{codeForbidden, "a client from %s cannot change the operator org %s", "%[1]s的客户端不能变更运维组织%[2]s"}
+
+	errTransientKeyMissing  = errorMessage{codeInvalidArgument, "%s key not found in the transient map", "临时数据中缺少%s"}
+	errInvalidPayload       = errorMessage{codeInvalidArgument, "invalid %s: %s", "%[1]s无效：%[2]s"}
+	errInvalidJSON          = errorMessage{codeInvalidArgument, "invalid %s JSON", "%s不是有效的JSON"}
+	errInvalidPublicKey     = errorMessage{codeInvalidArgument, "invalid %s: %v", "%[1]s无效"}
+	errInvalidMSPID         = errorMessage{codeInvalidArgument, "invalid %s %q", "无效的组织%[2]q"}
+	errPropertiesKeyMissing = errorMessage{codeInvalidArgument, "asset %s properties are encrypted, %s key not found in the transient map", "资产%[1]s的属性已加密，临时数据中缺少%[2]s"}
+	errSplitAmountTooLarge  = errorMessage{codeInvalidArgument, "asset amount %d is not greater than the split amount %d", "资产的金额%d不大于想要拆分的金额%d，不允许拆分"}
+	errEmptyTransient       = errorMessage{codeInvalidArgument, "%s must not be empty", "%s不能为空"}
+	errTransientTooShort    = errorMessage{codeInvalidArgument, "%s of at least %d bytes is required to seal event payloads", "加密事件需要至少%[2]d字节的%[1]s"}
+	errInvalidAESKey        = errorMessage{codeInvalidArgument, "%s must be a 32 byte AES-256 key", "%s必须是32字节的AES-256密钥"}
+	errNoRights             = errorMessage{codeInvalidArgument, "no rights granted", "未授予任何权限"}
+	errUnknownRight         = errorMessage{codeInvalidArgument, "unknown right %q, expected one of %v", "未知的权限%[1]q，可选的权限为%[2]v"}
+	errInvalidExpiry        = errorMessage{codeInvalidArgument, "invalid expiry %q: %v", "授权到期时间%[1]q格式错误"}
+	errExpiryNotInFuture    = errorMessage{codeInvalidArgument, "expiry %s is not in the future", "授权到期时间%s早于当前时间"}
+	errNoGuarantor          = errorMessage{codeInvalidArgument, "no guarantor given", "未指定担保方"}
+	errInvalidPageSize      = errorMessage{codeInvalidArgument, "page size must be positive: %d", "分页大小必须为正数：%d"}
+	errUnknownBookmark      = errorMessage{codeInvalidArgument, "bookmark %s is not part of the history of asset %s", "书签%[1]s不属于资产%[2]s的历史记录"}
+	errInvalidTimestamp     = errorMessage{codeInvalidArgument, "invalid timestamp %q, expected RFC3339: %v", "时间%[1]q格式错误，应为RFC3339格式"}
+
+	errRequestIDReused = errorMessage{codeConflict, "request ID %s was already used by transaction %s for another request", "请求编号%[1]s已被交易%[2]s用于其他请求"}
+
+	errPaused = errorMessage{codePaused, "contract is paused by %s, %s is not allowed", "合约已被%[1]s暂停，不允许调用%[2]s"}
+)
+
+// ContractError is the error transactions fail with, returned to clients as JSON, see contracterror.Error
+type ContractError = contracterror.Error
+
+// new returns the error of the catalog entry formatted with args
+func (m errorMessage) new(args ...interface{}) *ContractError {
+	return contracterror.Message{Code: m.code, En: m.en, Zh: m.zh}.New(args...)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/guozhe001/supply-finance-chaincode-go/contracterror"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseContractError(t *testing.T) {
+	contractError := contracterror.Parse(errAssetNotFound.new("asset1").Error())
+	require.Equal(t, codeNotFound, contractError.Code)
+	require.Equal(t, "asset asset1 does not exist", contractError.Message)
+	require.Equal(t, map[string]string{"en": "asset asset1 does not exist", "zh": "资产asset1不存在"}, contractError.Messages)
+
+	// wrapped errors keep the code of the original error
+	err := fmt.Errorf("failed to get asset: %v", errNotOwnerOrg.new(org2MSP, "sell", org1MSP))
+	contractError = contracterror.Parse(err.Error())
+	require.Equal(t, codeNotOwner, contractError.Code)
+	require.Equal(t, "Org2MSP的客户端无权操作Org1MSP持有的资产", contractError.Messages["zh"])
+
+	// the text of internal errors is not returned to clients
+	contractError = contracterror.Parse("failed to read asset:\n  connection refused")
+	require.Equal(t, codeInternal, contractError.Code)
+	require.Equal(t, "internal error", contractError.Message)
+}
+
+func TestStructuredErrors(t *testing.T) {
+	n := newTestNetwork(t)
+	contractError := n.fail(n.org1, nil, codeNotFound, "ReadAsset", "asset1")
+	require.Equal(t, "资产asset1不存在", contractError.Messages["zh"])
+
+	n.submit(n.org1, map[string]string{"asset_properties": testAssetProperties}, "CreateAsset", "asset1", "receivable")
+	n.fail(n.org1, map[string]string{"asset_properties": testAssetProperties}, codeAlreadyExists, "CreateAsset", "asset1", "receivable")
+	n.fail(n.org2, nil, codeNotOwner, "ChangePublicDescription", "asset1", "overdue receivable")
+	n.fail(n.org2, map[string]string{"asset_properties": testAsset2Properties}, codeHashMismatch, "VerifyAssetProperties", "asset1")
+	contractError = n.fail(n.org1, map[string]string{"asset_price": `{"asset_id":"asset1","price":0,"trade_id":"trade1"}`},
+		codeInvalidArgument, "AgreeToSell", "asset1")
+	require.Equal(t, []fieldError{{Field: "price", Message: "must be positive"}}, contractError.Fields)
+
+	auditor := newTestIdentity(t, org1MSP, "auditor1", roleAuditor)
+	n.fail(auditor, nil, codeForbidden, "SplitAsset", "asset1", "400")
+	contractError = n.fail(n.org1, nil, codeInvalidArgument, "SplitAsset", "asset1", "1000")
+	require.Equal(t, "asset amount 1000 is not greater than the split amount 1000", contractError.Message)
+	n.submit(n.org1, nil, "SplitAsset", "asset1", "400")
+	n.fail(n.org1, nil, codeBadStatus, "ChangePublicDescription", "asset1", "overdue receivable")
+	contractError = n.fail(n.org2, map[string]string{"asset_properties": testAssetProperties}, codeBadStatus, "VerifyAssetProperties", "asset1")
+	require.Equal(t, "asset asset1 is delete and cannot be traded", contractError.Message)
+
+	// errors caused by the client are not wrapped
+	contractError = n.fail(n.org2, map[string]string{"asset_properties": testAssetProperties}, codeNotFound, "VerifyAssetProperties", "asset9")
+	require.Equal(t, "asset asset9 does not exist", contractError.Message)
+	n.fail(n.org1, nil, codeInvalidArgument, "QueryAssetAsOf", "asset1", "yesterday")
+
+	// errors of the contract API itself have the same format
+	n.fail(n.org1, nil, codeInternal, "ReadAsset")
+}
+
+func TestPracticeContractErrors(t *testing.T) {
+	cc, err := newChaincode()
+	require.NoError(t, err)
+	n := newTestNetwork(t)
+	n.cc = cc
+
+	practiceError := func(function string, args ...string) *ContractError {
+		result := n.invoke(n.org1, nil, "Practice_SmartContract:"+function, args...)
+		require.Equal(t, int32(shim.ERROR), result.Response.Status)
+		var contractError ContractError
+		require.NoError(t, json.Unmarshal([]byte(result.Response.Message), &contractError), result.Response.Message)
+		require.Equal(t, function, contractError.Function)
+		return &contractError
+	}
+
+	// the practice contract fails with the same codes and JSON as the asset transfer contract
+	contractError := practiceError("ReadAsset", "asset9")
+	require.Equal(t, codeNotFound, contractError.Code)
+	require.Equal(t, "资产asset9不存在", contractError.Messages["zh"])
+	n.submit(n.org1, nil, "Practice_SmartContract:CreateAsset", "asset9", "blue", "5", "Tomoko", "300")
+	require.Equal(t, codeAlreadyExists, practiceError("CreateAsset", "asset9", "blue", "5", "Tomoko", "300").Code)
+	require.Equal(t, codeForbidden, practiceError("ClientIdentityPractice").Code)
+	require.Equal(t, codeInternal, practiceError("CreateAsset", "asset10").Code)
+}
@@ -0,0 +1,69 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/guozhe001/supply-finance-chaincode-go/events"
+)
+
+// newAssetEvent builds an event of the given type from the public state of an asset
+func newAssetEvent(ctx TransactionContextInterface, eventType string, asset *Asset) (*events.AssetEvent, error) {
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timestamp for event: %v", err)
+	}
+	timestamp, err := ptypes.Timestamp(txTimestamp)
+	if err != nil {
+		return nil, err
+	}
+	actingMSP, err := ctx.GetClientOrgID(false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &events.AssetEvent{
+		Version:           events.Version,
+		Type:              eventType,
+		TxID:              ctx.GetStub().GetTxID(),
+		Timestamp:         timestamp,
+		ActingMSP:         actingMSP,
+		AssetID:           asset.ID,
+		OwnerOrg:          asset.OwnerOrg,
+		OwnerID:           asset.OwnerID,
+		FinancierOrg:      asset.FinancierOrg,
+		GuarantorOrgs:     asset.GuarantorOrgs,
+		Status:            asset.Status,
+		ParentID:          asset.ParentID,
+		IssuerOrg:         asset.IssuerOrg,
+		PublicDescription: asset.PublicDescription,
+	}, nil
+}
+
+// emitEvent sets the event on the transaction. Fabric keeps only one event per transaction,
+// so it must be called once, by the exported transaction function, after all state updates.
+func emitEvent(ctx TransactionContextInterface, event *events.AssetEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %v", event.Type, err)
+	}
+	err = ctx.GetStub().SetEvent(event.Type, payload)
+	if err != nil {
+		return fmt.Errorf("failed to set %s event: %v", event.Type, err)
+	}
+	return nil
+}
+
+// emitAssetEvent builds and emits an event of the given type for an asset
+func emitAssetEvent(ctx TransactionContextInterface, eventType string, asset *Asset) error {
+	event, err := newAssetEvent(ctx, eventType, asset)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, event)
+}
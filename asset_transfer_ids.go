@@ -0,0 +1,95 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// typeAssetSequence prefixes the public state keys of the per-org asset ID counters
+const typeAssetSequence = "SQ"
+
+// NextAssetID returns the ID CreateAsset allocates to the next asset of the client's org when no asset ID
+// is passed. The asset properties must carry that ID; when another asset takes it first, CreateAsset
+// allocates the following ID, the creation fails the assetID check of the properties and the client asks again.
+func (s *SmartContract) NextAssetID(ctx TransactionContextInterface) (string, error) {
+	clientOrgID, err := ctx.GetClientOrgID(false)
+	if err != nil {
+		return "", err
+	}
+	allocator, err := newAssetIDAllocator(ctx, clientOrgID)
+	if err != nil {
+		return "", err
+	}
+	return allocator.allocate(ctx)
+}
+
+// assetIDAllocator hands out the asset IDs of an org, its MSP ID followed by a sequence number. Orgs allocate
+// the IDs of the assets they create and of the children of the assets they split.
+// Fabric does not let a transaction read its own writes, so the allocator keeps the counter itself while a
+// transaction allocates several IDs, such as the children of a split asset, and saves it once.
+type assetIDAllocator struct {
+	mspID string
+	key   string
+	next  uint64
+}
+
+func newAssetIDAllocator(ctx TransactionContextInterface, mspID string) (*assetIDAllocator, error) {
+	sequenceKey, err := ctx.GetStub().CreateCompositeKey(typeAssetSequence, []string{mspID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	value, err := ctx.GetStub().GetState(sequenceKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read asset sequence of %s: %v", mspID, err)
+	}
+	allocator := &assetIDAllocator{mspID: mspID, key: sequenceKey, next: 1}
+	if value != nil {
+		allocator.next, err = strconv.ParseUint(string(value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid asset sequence of %s: %v", mspID, err)
+		}
+	}
+	return allocator, nil
+}
+
+// allocate returns the next free asset ID, skipping IDs clients have chosen themselves
+func (a *assetIDAllocator) allocate(ctx TransactionContextInterface) (string, error) {
+	for {
+		assetID := fmt.Sprintf("%s-%06d", a.mspID, a.next)
+		a.next++
+		exists, err := assetExists(ctx, assetID)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return assetID, nil
+		}
+	}
+}
+
+// save records the allocated IDs
+func (a *assetIDAllocator) save(ctx TransactionContextInterface) error {
+	err := ctx.GetStub().PutState(a.key, []byte(strconv.FormatUint(a.next, 10)))
+	if err != nil {
+		return fmt.Errorf("failed to put asset sequence of %s: %v", a.mspID, err)
+	}
+	// Only the org allocates its IDs
+	err = setAssetStateBasedEndorsement(ctx, a.key, a.mspID)
+	if err != nil {
+		return fmt.Errorf("failed setting state based endorsement for asset sequence: %v", err)
+	}
+	return nil
+}
+
+// assetExists reports whether an asset ID is taken, split and deleted assets keep their public record
+func assetExists(ctx TransactionContextInterface, assetID string) (bool, error) {
+	asset, err := ctx.GetAsset(assetID)
+	if err != nil {
+		return false, err
+	}
+	return asset != nil, nil
+}
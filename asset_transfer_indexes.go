@@ -0,0 +1,157 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Composite-key secondary indexes kept in the public state. Unlike the CouchDB indexes under META-INF
+// they are maintained by the chaincode itself, so the queries built on them work on LevelDB as well.
+const (
+	indexOwnerAsset  = "owner~asset"
+	indexStatusAsset = "status~asset"
+	indexParentChild = "parent~child"
+)
+
+// assetIndexes lists every index an asset takes part in
+var assetIndexes = []string{indexOwnerAsset, indexStatusAsset, indexParentChild}
+
+// putAsset writes the public asset and keeps its secondary indexes and endorsement policy in step with
+// the previous version. previous is nil when the asset is created.
+func putAsset(ctx TransactionContextInterface, previous *Asset, asset *Asset) error {
+	assetJSON, err := json.Marshal(asset)
+	if err != nil {
+		return fmt.Errorf("failed to marshal asset: %v", err)
+	}
+	err = ctx.GetStub().PutState(asset.ID, assetJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put asset in public data: %v", err)
+	}
+
+	for _, index := range assetIndexes {
+		newValue := assetIndexValue(asset, index)
+		if previous != nil {
+			oldValue := assetIndexValue(previous, index)
+			if oldValue == newValue {
+				continue
+			}
+			if oldValue != "" {
+				if err := delIndexEntry(ctx, index, oldValue, asset.ID); err != nil {
+					return err
+				}
+			}
+		}
+		if newValue != "" {
+			if err := putIndexEntry(ctx, index, newValue, asset.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return applyEndorsementPolicy(ctx, previous, asset)
+}
+
+// assetIndexValue returns the value of the field an index is keyed on
+func assetIndexValue(asset *Asset, index string) string {
+	switch index {
+	case indexOwnerAsset:
+		return asset.OwnerOrg
+	case indexStatusAsset:
+		return asset.Status
+	case indexParentChild:
+		return asset.ParentID
+	}
+	return ""
+}
+
+func putIndexEntry(ctx TransactionContextInterface, index string, value string, assetID string) error {
+	indexKey, err := ctx.GetStub().CreateCompositeKey(index, []string{value, assetID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key for index %s: %v", index, err)
+	}
+	// Save index entry to world state. Only the key name is needed, no need to store a duplicate copy of the asset.
+	// Note - passing a 'nil' value will effectively delete the key from state, therefore we pass null character as value
+	err = ctx.GetStub().PutState(indexKey, []byte{0x00})
+	if err != nil {
+		return fmt.Errorf("failed to put index %s for asset %s: %v", index, assetID, err)
+	}
+	return nil
+}
+
+func delIndexEntry(ctx TransactionContextInterface, index string, value string, assetID string) error {
+	indexKey, err := ctx.GetStub().CreateCompositeKey(index, []string{value, assetID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key for index %s: %v", index, err)
+	}
+	err = ctx.GetStub().DelState(indexKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete index %s for asset %s: %v", index, assetID, err)
+	}
+	return nil
+}
+
+// QueryAssetsByOwnerIndex returns a page of the assets owned by the given org using the owner~asset index.
+// Works on both LevelDB and CouchDB state databases.
+func (s *SmartContract) QueryAssetsByOwnerIndex(ctx TransactionContextInterface, ownerOrg string,
+	pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	return queryAssetsByIndex(ctx, indexOwnerAsset, ownerOrg, pageSize, bookmark)
+}
+
+// QueryAssetsByStatusIndex returns a page of the assets with the given status using the status~asset index.
+// Works on both LevelDB and CouchDB state databases.
+func (s *SmartContract) QueryAssetsByStatusIndex(ctx TransactionContextInterface, status string,
+	pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	return queryAssetsByIndex(ctx, indexStatusAsset, status, pageSize, bookmark)
+}
+
+// QueryAssetChildren returns a page of the assets split from the given asset using the parent~child index.
+// Works on both LevelDB and CouchDB state databases.
+func (s *SmartContract) QueryAssetChildren(ctx TransactionContextInterface, parentID string,
+	pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	return queryAssetsByIndex(ctx, indexParentChild, parentID, pageSize, bookmark)
+}
+
+// queryAssetsByIndex walks the entries of an index for the given value and reads the assets they point to
+func queryAssetsByIndex(ctx TransactionContextInterface, index string, value string,
+	pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(index, []string{value}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index %s: %v", index, err)
+	}
+	defer resultsIterator.Close()
+
+	assets := []*Asset{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, compositeKeyParts, err := ctx.GetStub().SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
+		}
+		if len(compositeKeyParts) < 2 {
+			return nil, fmt.Errorf("malformed index %s entry: %s", index, responseRange.Key)
+		}
+		assetID := compositeKeyParts[1]
+
+		asset, err := ctx.GetAsset(assetID)
+		if err != nil {
+			return nil, err
+		}
+		if asset == nil {
+			return nil, fmt.Errorf("index %s points to missing asset %s", index, assetID)
+		}
+		assets = append(assets, asset)
+	}
+
+	return &PaginatedQueryResult{
+		Records:             assets,
+		FetchedRecordsCount: int32(len(assets)),
+		Bookmark:            responseMetadata.Bookmark,
+	}, nil
+}
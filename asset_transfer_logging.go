@@ -0,0 +1,80 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"os"
+	"sync"
+
+	"github.com/guozhe001/supply-finance-chaincode-go/contracterror"
+	"github.com/guozhe001/supply-finance-chaincode-go/logging"
+	"github.com/guozhe001/supply-finance-chaincode-go/middleware"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// privateLogKeys are the keys whose values are never logged: the transient payloads and the private
+// properties and prices of assets
+var privateLogKeys = []string{
+	"asset_properties",
+	"asset_price",
+	transientPropertyProofs,
+	transientPropertiesKey,
+	transientIssuerSignature,
+	transientEventEntropy,
+	"properties",
+	"price",
+	"salt",
+}
+
+// logRedactor redacts the private keys from every log entry, transactions clone it to add their secrets
+var logRedactor = logging.NewRedactor(privateLogKeys...)
+
+// contractLogger is the logger of the contract, transactions log through TransactionContextInterface.Logger,
+// which also redacts their transient values and the private data they read
+var contractLogger = logging.New("asset_transfer", os.Stderr, logging.LevelFromEnv()).WithRedactor(logRedactor)
+
+// runningTransactions holds the context of every running transaction by transaction ID. Error hooks run once
+// the contract API has discarded the context, they find it here to log with the transaction's redactor.
+var runningTransactions sync.Map
+
+// transactionLog logs the outcome of every transaction. Failed transactions are logged with the error they
+// failed with, internal errors with their full text, which the client does not get, see contracterror.Parse.
+var transactionLog = middleware.Middleware{
+	Name: "log",
+	Before: withContext(func(ctx TransactionContextInterface, function string) error {
+		runningTransactions.Store(ctx.GetStub().GetTxID(), ctx)
+		_, args := ctx.GetStub().GetFunctionAndParameters()
+		ctx.Logger().Debug("transaction started", "args", args)
+		return nil
+	}),
+	After: func(ctx contractapi.TransactionContextInterface, function string, _ interface{}) error {
+		runningTransactions.Delete(ctx.GetStub().GetTxID())
+		ctx.(TransactionContextInterface).Logger().Info("transaction succeeded")
+		return nil
+	},
+	Error: func(stub shim.ChaincodeStubInterface, function string, err error) error {
+		logger := failedTransactionContext(stub).Logger()
+		contractError := contracterror.Parse(err.Error())
+		if contractError.Code == codeInternal {
+			logger.Error("transaction failed", "code", contractError.Code, "err", err)
+		} else {
+			logger.Warning("transaction failed", "code", contractError.Code, "err", contractError.Message)
+		}
+		return err
+	},
+}
+
+// failedTransactionContext returns the context of a failed transaction. Transactions the contract API rejected
+// before running the middlewares, such as calls with missing arguments, get a new context of their stub.
+func failedTransactionContext(stub shim.ChaincodeStubInterface) TransactionContextInterface {
+	if ctx, ok := runningTransactions.Load(stub.GetTxID()); ok {
+		runningTransactions.Delete(stub.GetTxID())
+		return ctx.(TransactionContextInterface)
+	}
+	ctx := new(TransactionContext)
+	ctx.SetStub(stub)
+	return ctx
+}
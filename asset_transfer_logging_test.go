@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/guozhe001/supply-finance-chaincode-go/logging"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogsKeepPrivateDataOut(t *testing.T) {
+	var logs bytes.Buffer
+	contractLogger.SetOutput(&logs)
+	contractLogger.SetLevel(logging.LevelDebug)
+	defer contractLogger.SetLevel(logging.LevelFromEnv())
+	defer contractLogger.SetOutput(os.Stderr)
+
+	n := newTestNetwork(t)
+	n.submit(n.org1, map[string]string{"asset_properties": testAssetProperties}, "CreateAsset", "asset1", "receivable")
+	n.submit(n.org1, nil, "GetAssetPrivateProperties", "asset1")
+	n.submit(n.org1, map[string]string{"asset_price": testAssetPrice}, "AgreeToSell", "asset1")
+	failed := n.invoke(n.org1, map[string]string{"asset_properties": testAsset2Properties, "asset_price": testAssetPrice},
+		"TransferAsset", "asset1", org2MSP)
+	require.Contains(t, failed.Response.Message, `"code":"HASH_MISMATCH"`)
+	// internal errors are only logged in full
+	contractError := n.fail(n.org1, map[string]string{"asset_properties": testAssetProperties}, codeInternal, "ReadAsset")
+	require.Equal(t, "internal error", contractError.Message)
+
+	require.Contains(t, logs.String(), `"msg":"transaction succeeded","txID":`)
+	require.Contains(t, logs.String(), `"msg":"transaction failed","txID":"`+failed.TxID+`","function":"TransferAsset","code":"HASH_MISMATCH"`)
+	require.Regexp(t, `"level":"ERROR".*"function":"ReadAsset","code":"INTERNAL","err":".*params`, logs.String())
+	require.Contains(t, logs.String(), `"assetID":"asset1"`)
+	for _, private := range []string{"a1b2c3", "d4e5f6", `"amount"`, `"price"`, "trade1"} {
+		require.NotContains(t, logs.String(), private)
+	}
+}
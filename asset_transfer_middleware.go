@@ -0,0 +1,318 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/guozhe001/supply-finance-chaincode-go/contracterror"
+	"github.com/guozhe001/supply-finance-chaincode-go/middleware"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const (
+	// typePause is the public state key recording that the contract is paused
+	typePause = "PA"
+	// typeOperatorOrg is the public state key recording the MSP ID of the operator org, the only org whose
+	// admins may pause the contract
+	typeOperatorOrg = "OP"
+	// typeAuditRecord prefixes the public state keys of the audit trail, keyed by transaction ID
+	typeAuditRecord = "AU"
+)
+
+// AuditRecord is the audit trail entry of a transaction that changed the ledger
+type AuditRecord struct {
+	TxID      string    `json:"txID"`
+	Function  string    `json:"function"`
+	ClientOrg string    `json:"clientOrg"`
+	ClientID  string    `json:"clientID"` // owner ID of the client, see getClientOwnerID
+	Timestamp time.Time `json:"timestamp"`
+	Args      []string  `json:"args"`
+}
+
+var (
+	authorization = middleware.Middleware{Name: "authorization", Before: withContext(authorizeTransaction)}
+	pauseCheck    = middleware.Middleware{Name: "pause", Before: withContext(checkNotPaused)}
+	auditTrail    = middleware.Middleware{Name: "audit", After: func(ctx contractapi.TransactionContextInterface, function string, _ interface{}) error {
+		// a replayed request changes nothing, its audit record was written when it was processed
+		replayed, err := isReplayedRequest(ctx.(TransactionContextInterface), function)
+		if err != nil || replayed {
+			return err
+		}
+		return putAuditRecord(ctx.(TransactionContextInterface), function)
+	}}
+)
+
+// transactionMiddlewares declares the middlewares of each transaction, run after authorization.
+// Transactions changing the ledger can be paused and leave an audit record, transactions taking
+// transient payloads check they are present before running.
+var transactionMiddlewares = map[string][]middleware.Middleware{
+	"CreateAsset":                {pauseCheck, requireTransient("asset_properties"), auditTrail},
+	"ChangePublicDescription":    {pauseCheck, auditTrail},
+	"AgreeToSell":                {pauseCheck, requireTransient("asset_price"), auditTrail},
+	"AgreeToBuy":                 {pauseCheck, requireTransient("asset_price"), auditTrail},
+	"VerifyAssetProperties":      {requireTransient("asset_properties")},
+	"VerifyAssetIssuerSignature": {requireTransient("asset_properties")},
+	"VerifyAssetPropertyProofs":  {requireTransient(transientPropertyProofs)},
+	"TransferAsset":              {pauseCheck, requireTransient("asset_properties", "asset_price"), auditTrail},
+	"SplitAsset":                 {pauseCheck, auditTrail},
+	"AssignAssetOwner":           {pauseCheck, auditTrail},
+	"GrantDelegation":            {pauseCheck, auditTrail},
+	"RevokeDelegation":           {pauseCheck, auditTrail},
+	"PledgeAsset":                {pauseCheck, auditTrail},
+	"GuaranteeAsset":             {pauseCheck, auditTrail},
+	"AcceptPledge":               {pauseCheck, auditTrail},
+	"AcceptGuarantee":            {pauseCheck, auditTrail},
+	"ReleaseAsset":               {pauseCheck, auditTrail},
+	"RegisterIssuerKey":          {pauseCheck, auditTrail},
+	"AttestAssetProperties":      {pauseCheck, auditTrail},
+	"EncryptAssetProperties":     {pauseCheck, requireTransient(transientPropertiesKey), auditTrail},
+	"RegisterOrgEncryptionKey":   {pauseCheck, auditTrail},
+	"SetPaused":                  {auditTrail},
+	"SetOperatorOrg":             {auditTrail},
+}
+
+// transactionPipeline runs the middlewares of the asset transfer contract
+var transactionPipeline = newTransactionPipeline()
+
+func newTransactionPipeline() *middleware.Pipeline {
+	// error hooks run in reverse order, the log sees the error before it is returned to the client
+	pipeline := middleware.New(contracterror.Structured, transactionLog, authorization)
+	for function, middlewares := range transactionMiddlewares {
+		pipeline.Use(function, middlewares...)
+	}
+	return pipeline
+}
+
+// GetBeforeTransaction runs the before hooks of the contract's middlewares, see transactionMiddlewares
+func (s *SmartContract) GetBeforeTransaction() interface{} {
+	return transactionPipeline.Before
+}
+
+// GetAfterTransaction runs the after hooks of the contract's middlewares once a transaction succeeded
+func (s *SmartContract) GetAfterTransaction() interface{} {
+	return transactionPipeline.After
+}
+
+// withContext adapts a before hook to the transaction context of the contract
+func withContext(before func(ctx TransactionContextInterface, function string) error) middleware.Before {
+	return func(ctx contractapi.TransactionContextInterface, function string) error {
+		return before(ctx.(TransactionContextInterface), function)
+	}
+}
+
+// requireTransient checks that the transient payloads a transaction needs are passed
+func requireTransient(keys ...string) middleware.Middleware {
+	return middleware.Middleware{
+		Name: "transient",
+		Before: withContext(func(ctx TransactionContextInterface, function string) error {
+			transientMap, err := ctx.GetTransient()
+			if err != nil {
+				return fmt.Errorf("error getting transient: %v", err)
+			}
+			for _, key := range keys {
+				if len(transientMap[key]) == 0 {
+					return errTransientKeyMissing.new(key)
+				}
+			}
+			return nil
+		}),
+	}
+}
+
+// SetPaused pauses or resumes every transaction changing the ledger, queries keep working.
+// Only admins of the operator org may pause the contract, and only admins of the org that paused it may resume it.
+// 暂停期间只能查询，不能创建、交易或变更资产
+func (s *SmartContract) SetPaused(ctx TransactionContextInterface, paused bool) error {
+	clientOrgID, err := ctx.GetClientOrgID(false)
+	if err != nil {
+		return err
+	}
+	pauseKey, err := ctx.GetStub().CreateCompositeKey(typePause, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	if !paused {
+		pausedBy, err := getPausedBy(ctx)
+		if err != nil {
+			return err
+		}
+		if pausedBy == "" {
+			return errNotPaused.new()
+		}
+		if pausedBy != clientOrgID {
+			return errResumeForbidden.new(pausedBy, clientOrgID)
+		}
+		return ctx.GetStub().DelState(pauseKey)
+	}
+	operatorOrgID, err := getOperatorOrg(ctx)
+	if err != nil {
+		return err
+	}
+	if operatorOrgID == "" {
+		return errOperatorOrgNotFound.new()
+	}
+	if clientOrgID != operatorOrgID {
+		return errPauseForbidden.new(clientOrgID)
+	}
+	return ctx.GetStub().PutState(pauseKey, []byte(clientOrgID))
+}
+
+// SetOperatorOrg records the operator org, whose admins may pause the contract. The first admin to call it
+// after the chaincode is deployed names the operator, after that only admins of the operator org can hand it
+// over. The record is endorsed by the operator org, so other orgs cannot replace it.
+// 设置运维组织，只有运维组织的管理员可以暂停合约
+func (s *SmartContract) SetOperatorOrg(ctx TransactionContextInterface, mspID string) error {
+	if mspID == "" {
+		return errInvalidMSPID.new("operator org", mspID)
+	}
+	clientOrgID, err := ctx.GetClientOrgID(false)
+	if err != nil {
+		return err
+	}
+	operatorOrgID, err := getOperatorOrg(ctx)
+	if err != nil {
+		return err
+	}
+	if operatorOrgID != "" && operatorOrgID != clientOrgID {
+		return errNotOperator.new(clientOrgID, operatorOrgID)
+	}
+
+	operatorKey, err := ctx.GetStub().CreateCompositeKey(typeOperatorOrg, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	err = ctx.GetStub().PutState(operatorKey, []byte(mspID))
+	if err != nil {
+		return fmt.Errorf("failed to put operator org: %v", err)
+	}
+	// Only the operator org can hand the role over
+	err = setAssetStateBasedEndorsement(ctx, operatorKey, mspID)
+	if err != nil {
+		return fmt.Errorf("failed setting state based endorsement for operator org: %v", err)
+	}
+	return nil
+}
+
+// GetOperatorOrg returns the MSP ID of the operator org
+func (s *SmartContract) GetOperatorOrg(ctx TransactionContextInterface) (string, error) {
+	operatorOrgID, err := getOperatorOrg(ctx)
+	if err != nil {
+		return "", err
+	}
+	if operatorOrgID == "" {
+		return "", errOperatorOrgNotFound.new()
+	}
+	return operatorOrgID, nil
+}
+
+// getOperatorOrg returns the MSP ID of the operator org, empty if none has been set
+func getOperatorOrg(ctx TransactionContextInterface) (string, error) {
+	operatorKey, err := ctx.GetStub().CreateCompositeKey(typeOperatorOrg, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create composite key: %v", err)
+	}
+	operatorOrgID, err := ctx.GetStub().GetState(operatorKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to read operator org: %v", err)
+	}
+	return string(operatorOrgID), nil
+}
+
+// IsPaused returns whether the contract is paused
+func (s *SmartContract) IsPaused(ctx TransactionContextInterface) (bool, error) {
+	pausedBy, err := getPausedBy(ctx)
+	if err != nil {
+		return false, err
+	}
+	return pausedBy != "", nil
+}
+
+// checkNotPaused rejects transactions changing the ledger while the contract is paused
+func checkNotPaused(ctx TransactionContextInterface, function string) error {
+	pausedBy, err := getPausedBy(ctx)
+	if err != nil {
+		return err
+	}
+	if pausedBy != "" {
+		return errPaused.new(pausedBy, function)
+	}
+	return nil
+}
+
+// getPausedBy returns the org that paused the contract, empty if it is not paused
+func getPausedBy(ctx TransactionContextInterface) (string, error) {
+	pauseKey, err := ctx.GetStub().CreateCompositeKey(typePause, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create composite key: %v", err)
+	}
+	pausedBy, err := ctx.GetStub().GetState(pauseKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to read pause state: %v", err)
+	}
+	return string(pausedBy), nil
+}
+
+// putAuditRecord records who called a transaction changing the ledger, the private inputs passed in
+// the transient map are not recorded
+func putAuditRecord(ctx TransactionContextInterface, function string) error {
+	clientOrgID, err := ctx.GetClientOrgID(false)
+	if err != nil {
+		return err
+	}
+	clientID, err := getClientOwnerID(ctx)
+	if err != nil {
+		return err
+	}
+	timestamp, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	_, args := ctx.GetStub().GetFunctionAndParameters()
+	record := AuditRecord{
+		TxID:      ctx.GetStub().GetTxID(),
+		Function:  function,
+		ClientOrg: clientOrgID,
+		ClientID:  clientID,
+		Timestamp: timestamp,
+		Args:      args,
+	}
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %v", err)
+	}
+	recordKey, err := ctx.GetStub().CreateCompositeKey(typeAuditRecord, []string{record.TxID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	err = ctx.GetStub().PutState(recordKey, recordJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put audit record: %v", err)
+	}
+	return nil
+}
+
+// getAuditRecord returns the audit record of a transaction, nil if it left none
+func getAuditRecord(ctx TransactionContextInterface, txID string) (*AuditRecord, error) {
+	recordKey, err := ctx.GetStub().CreateCompositeKey(typeAuditRecord, []string{txID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	recordJSON, err := ctx.GetStub().GetState(recordKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit record: %v", err)
+	}
+	if recordJSON == nil {
+		return nil, nil
+	}
+	var record AuditRecord
+	err = json.Unmarshal(recordJSON, &record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal audit record: %v", err)
+	}
+	return &record, nil
+}
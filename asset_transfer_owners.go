@@ -0,0 +1,78 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/guozhe001/supply-finance-chaincode-go/events"
+)
+
+// GetClientOwnerID returns the owner ID of the calling client, to be shared with a seller
+// so that a bought asset is handed over to the client rather than to its whole org
+func (s *SmartContract) GetClientOwnerID(ctx TransactionContextInterface) (string, error) {
+	return getClientOwnerID(ctx)
+}
+
+// AssignAssetOwner restricts an asset to a single client of the owner org, or makes it owned by the
+// whole org again when ownerID is empty. Only the current owner can assign the asset.
+func (s *SmartContract) AssignAssetOwner(ctx TransactionContextInterface, assetID string, ownerID string) error {
+	asset, err := s.ReadAsset(ctx, assetID)
+	if err != nil {
+		return err
+	}
+
+	clientOrgID, err := ctx.GetClientOrgID(false)
+	if err != nil {
+		return err
+	}
+	if clientOrgID != asset.OwnerOrg {
+		return errNotOwnerOrg.new(clientOrgID, "assign", asset.OwnerOrg)
+	}
+	err = verifyClientOwnerID(ctx, asset, "assign")
+	if err != nil {
+		return err
+	}
+	if asset.Status != statusEnable {
+		return errAssetNotModifiable.new(asset.ID, asset.Status)
+	}
+
+	previous := *asset
+	asset.OwnerID = ownerID
+	err = putAsset(ctx, &previous, asset)
+	if err != nil {
+		return err
+	}
+	return emitAssetEvent(ctx, events.AssetOwnerAssigned, asset)
+}
+
+// getClientOwnerID identifies the client within its org by the SHA-256 of its client ID,
+// so that the subject and issuer of the certificate are not published with the asset
+func getClientOwnerID(ctx TransactionContextInterface) (string, error) {
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed getting client's ID: %v", err)
+	}
+	hash := sha256.Sum256([]byte(clientID))
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// verifyClientOwnerID checks that the client is the owner of an asset restricted to a single client.
+// Assets without an owner ID can be used by any client of the owner org, the org itself is checked by the caller.
+func verifyClientOwnerID(ctx TransactionContextInterface, asset *Asset, action string) error {
+	if asset.OwnerID == "" {
+		return nil
+	}
+	ownerID, err := getClientOwnerID(ctx)
+	if err != nil {
+		return err
+	}
+	if ownerID != asset.OwnerID {
+		return errNotOwnerClient.new(ownerID, action, asset.ID, asset.OwnerOrg)
+	}
+	return nil
+}
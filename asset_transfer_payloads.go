@@ -0,0 +1,41 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+
+	"github.com/guozhe001/supply-finance-chaincode-go/canonicaljson"
+)
+
+// canonicalPayload returns the canonical form of a JSON payload from the transient map, such as
+// asset_properties or asset_price. Payloads are stored and hashed canonical, so that parties agreeing on
+// the same document match whatever the key order or whitespace of their JSON encoder; clients can use
+// the canonicaljson package to produce the same bytes.
+func canonicalPayload(name string, payload []byte) ([]byte, error) {
+	canonical, err := canonicaljson.Transform(payload)
+	if err != nil {
+		// the parser error is not returned, it may quote values of the private payload
+		return nil, errInvalidJSON.new(name)
+	}
+	return canonical, nil
+}
+
+// hashMatches reports whether an on-chain hash commits to a JSON payload from the transient map.
+// Records written before payloads were canonicalized match the payload exactly as submitted.
+func hashMatches(name string, onChainHash []byte, payload []byte) (bool, error) {
+	canonical, err := canonicalPayload(name, payload)
+	if err != nil {
+		return false, err
+	}
+	for _, candidate := range [][]byte{canonical, payload} {
+		hash := sha256.Sum256(candidate)
+		if bytes.Equal(onChainHash, hash[:]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,184 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import "github.com/guozhe001/supply-finance-chaincode-go/events"
+
+// PledgeAsset offers to pledge an asset of the client's org to a financier. The asset is pledged once the
+// financier accepts with AcceptPledge; until then it cannot be traded and its updates need the endorsement
+// of both the owner and the financier, so the owner alone cannot complete the pledge.
+func (s *SmartContract) PledgeAsset(ctx TransactionContextInterface, assetID string, financierOrg string) error {
+	asset, err := s.ReadAsset(ctx, assetID)
+	if err != nil {
+		return err
+	}
+	if financierOrg == "" || financierOrg == asset.OwnerOrg {
+		return errInvalidMSPID.new("financier", financierOrg)
+	}
+	previous, err := encumberAsset(ctx, asset, "pledge")
+	if err != nil {
+		return err
+	}
+
+	asset.Status = statusPledgeOffered
+	asset.FinancierOrg = financierOrg
+	err = putAsset(ctx, previous, asset)
+	if err != nil {
+		return err
+	}
+	return emitAssetEvent(ctx, events.AssetPledgeOffered, asset)
+}
+
+// AcceptPledge accepts the pledge of an asset offered to the client's org with PledgeAsset
+func (s *SmartContract) AcceptPledge(ctx TransactionContextInterface, assetID string) error {
+	asset, err := s.ReadAsset(ctx, assetID)
+	if err != nil {
+		return err
+	}
+	if asset.Status != statusPledgeOffered {
+		return errAssetNotOffered.new(assetID, "pledge")
+	}
+	clientOrgID, err := ctx.GetClientOrgID(false)
+	if err != nil {
+		return err
+	}
+	if clientOrgID != asset.FinancierOrg {
+		return errAcceptForbidden.new(clientOrgID, "pledge", assetID)
+	}
+
+	previous := *asset
+	asset.Status = statusPledged
+	err = putAsset(ctx, &previous, asset)
+	if err != nil {
+		return err
+	}
+	return emitAssetEvent(ctx, events.AssetPledged, asset)
+}
+
+// GuaranteeAsset offers the guarantee of an asset of the client's org to the guarantor orgs. The asset is
+// guaranteed once every guarantor accepts with AcceptGuarantee; until then it cannot be traded and the owner
+// can withdraw the offer with ReleaseAsset.
+func (s *SmartContract) GuaranteeAsset(ctx TransactionContextInterface, assetID string, guarantorOrgs []string) error {
+	asset, err := s.ReadAsset(ctx, assetID)
+	if err != nil {
+		return err
+	}
+	if len(guarantorOrgs) == 0 {
+		return errNoGuarantor.new()
+	}
+	for i, guarantorOrg := range guarantorOrgs {
+		if guarantorOrg == "" || guarantorOrg == asset.OwnerOrg || contains(guarantorOrgs[:i], guarantorOrg) {
+			return errInvalidMSPID.new("guarantor", guarantorOrg)
+		}
+	}
+	previous, err := encumberAsset(ctx, asset, "guarantee")
+	if err != nil {
+		return err
+	}
+
+	asset.Status = statusGuaranteeOffered
+	asset.GuarantorOrgs = guarantorOrgs
+	err = putAsset(ctx, previous, asset)
+	if err != nil {
+		return err
+	}
+	return emitAssetEvent(ctx, events.AssetGuaranteeOffered, asset)
+}
+
+// AcceptGuarantee accepts the guarantee of an asset offered to the client's org with GuaranteeAsset.
+// The asset is guaranteed once the last guarantor accepts.
+func (s *SmartContract) AcceptGuarantee(ctx TransactionContextInterface, assetID string) error {
+	asset, err := s.ReadAsset(ctx, assetID)
+	if err != nil {
+		return err
+	}
+	if asset.Status != statusGuaranteeOffered {
+		return errAssetNotOffered.new(assetID, "guarantee")
+	}
+	clientOrgID, err := ctx.GetClientOrgID(false)
+	if err != nil {
+		return err
+	}
+	if !contains(asset.GuarantorOrgs, clientOrgID) {
+		return errAcceptForbidden.new(clientOrgID, "guarantee", assetID)
+	}
+	if contains(asset.AcceptedGuarantorOrgs, clientOrgID) {
+		return errAlreadyAccepted.new(clientOrgID, "guarantee", assetID)
+	}
+
+	previous := *asset
+	asset.AcceptedGuarantorOrgs = append(append([]string{}, asset.AcceptedGuarantorOrgs...), clientOrgID)
+	eventType := events.AssetGuaranteeAccepted
+	if len(asset.AcceptedGuarantorOrgs) == len(asset.GuarantorOrgs) {
+		asset.Status = statusGuaranteed
+		asset.AcceptedGuarantorOrgs = nil
+		eventType = events.AssetGuaranteed
+	}
+	err = putAsset(ctx, &previous, asset)
+	if err != nil {
+		return err
+	}
+	return emitAssetEvent(ctx, eventType, asset)
+}
+
+// ReleaseAsset releases a pledged or guaranteed asset, making it tradable again, or withdraws a pledge or
+// guarantee that was not accepted yet. It can be submitted by the owner, the financier or a guarantor, the
+// endorsement policy of the asset requires both sides to endorse, except for an offered guarantee which the
+// owner withdraws alone.
+func (s *SmartContract) ReleaseAsset(ctx TransactionContextInterface, assetID string) error {
+	asset, err := s.ReadAsset(ctx, assetID)
+	if err != nil {
+		return err
+	}
+	clientOrgID, err := ctx.GetClientOrgID(false)
+	if err != nil {
+		return err
+	}
+
+	var parties []string
+	switch asset.Status {
+	case statusPledged, statusPledgeOffered:
+		parties = []string{asset.OwnerOrg, asset.FinancierOrg}
+	case statusGuaranteed, statusGuaranteeOffered:
+		parties = append([]string{asset.OwnerOrg}, asset.GuarantorOrgs...)
+	default:
+		return errAssetNotEncumbered.new(assetID)
+	}
+	if !contains(parties, clientOrgID) {
+		return errReleaseForbidden.new(clientOrgID, assetID)
+	}
+
+	previous := *asset
+	asset.Status = statusEnable
+	asset.FinancierOrg = ""
+	asset.GuarantorOrgs = nil
+	asset.AcceptedGuarantorOrgs = nil
+	err = putAsset(ctx, &previous, asset)
+	if err != nil {
+		return err
+	}
+	return emitAssetEvent(ctx, events.AssetReleased, asset)
+}
+
+// encumberAsset checks the client owns an asset that is free to be pledged or guaranteed and returns a copy
+// of the asset before the change
+func encumberAsset(ctx TransactionContextInterface, asset *Asset, action string) (*Asset, error) {
+	clientOrgID, err := ctx.GetClientOrgID(false)
+	if err != nil {
+		return nil, err
+	}
+	if clientOrgID != asset.OwnerOrg {
+		return nil, errNotOwnerOrg.new(clientOrgID, action, asset.OwnerOrg)
+	}
+	err = verifyClientOwnerID(ctx, asset, action)
+	if err != nil {
+		return nil, err
+	}
+	if asset.Status != statusEnable {
+		return nil, errAssetNotEnabled.new(asset.ID, asset.Status, action)
+	}
+	previous := *asset
+	return &previous, nil
+}
@@ -7,45 +7,61 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/golang/protobuf/ptypes"
-	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
 )
 
 // QueryResult structure used for handling result of query
 type QueryResult struct {
-	Record    *Asset
-	TxId      string    `json:"txId"`
-	Timestamp time.Time `json:"timestamp"`
+	Record    *Asset        `json:"record,omitempty" metadata:"record,optional"`
+	TxId      string        `json:"txId"`
+	Timestamp time.Time     `json:"timestamp"`
+	IsDelete  bool          `json:"isDelete"`
+	Changes   []FieldChange `json:"changes,omitempty" metadata:"changes,optional"`
+	ActingMSP string        `json:"actingMSP,omitempty" metadata:"actingMSP,optional"`
+}
+
+// FieldChange describes how a single public field of an asset changed between two versions.
+// Values are JSON encoded so that fields of any type can be reported.
+type FieldChange struct {
+	Field    string `json:"field"`
+	Previous string `json:"previous"`
+	Current  string `json:"current"`
+}
+
+// HistoryQueryResult structure used for returning a page of the history of an asset
+type HistoryQueryResult struct {
+	Records             []QueryResult `json:"records"`
+	FetchedRecordsCount int32         `json:"fetchedRecordsCount"`
+	Bookmark            string        `json:"bookmark"`
 }
 
 type Agreement struct {
 	ID      string `json:"asset_id"`
 	Price   int    `json:"price"`
 	TradeID string `json:"trade_id"`
+	// BuyerOwnerID is the owner ID the asset is handed over to in the buyer org, both parties agree to it with the price
+	BuyerOwnerID string `json:"buyer_owner_id,omitempty" metadata:"buyer_owner_id,optional"`
 }
 
 // ReadAsset returns the public asset data
-func (s *SmartContract) ReadAsset(ctx contractapi.TransactionContextInterface, assetID string) (*Asset, error) {
+func (s *SmartContract) ReadAsset(ctx TransactionContextInterface, assetID string) (*Asset, error) {
 	// Since only public data is accessed in this function, no access control is required
-	assetJSON, err := ctx.GetStub().GetState(assetID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read from world state: %v", err)
-	}
-	if assetJSON == nil {
-		return nil, fmt.Errorf("%s does not exist", assetID)
-	}
-	var asset *Asset
-	err = json.Unmarshal(assetJSON, &asset)
+	asset, err := ctx.GetAsset(assetID)
 	if err != nil {
 		return nil, err
 	}
+	if asset == nil {
+		return nil, errAssetNotFound.new(assetID)
+	}
 	return asset, nil
 }
 
 // GetAssetPrivateProperties returns the immutable asset properties from owner's private data collection
-func (s *SmartContract) GetAssetPrivateProperties(ctx contractapi.TransactionContextInterface, assetID string) (string, error) {
+func (s *SmartContract) GetAssetPrivateProperties(ctx TransactionContextInterface, assetID string) (string, error) {
 	immutableProperties, err := getAssetPrivateProperties(ctx, assetID)
 	if err != nil {
 		return "", err
@@ -53,37 +69,37 @@ func (s *SmartContract) GetAssetPrivateProperties(ctx contractapi.TransactionCon
 	return string(immutableProperties), nil
 }
 
-func getAssetPrivateProperties(ctx contractapi.TransactionContextInterface, assetID string) ([]byte, error) {
+func getAssetPrivateProperties(ctx TransactionContextInterface, assetID string) ([]byte, error) {
 	// In this scenario, client is only authorized to read/write private data from its own peer.
-	collection, err := getClientImplicitCollectionName(ctx)
-	fmt.Println("collection:", collection)
+	collection, err := ctx.ClientCollection()
 	if err != nil {
 		return []byte{}, err
 	}
+	ctx.Logger().Debug("reading asset properties", "assetID", assetID, "collection", collection.Name)
 
-	immutableProperties, err := ctx.GetStub().GetPrivateData(collection, assetID)
+	immutableProperties, err := collection.Get(assetID)
 	if err != nil {
 		return []byte{}, fmt.Errorf("failed to read asset private properties from client org's collection: %v", err)
 	}
 	if immutableProperties == nil {
-		return []byte{}, fmt.Errorf("asset private details does not exist in client org's collection: %s", assetID)
+		return []byte{}, errPrivatePropertiesNotFound.new(assetID)
 	}
-	return immutableProperties, nil
+	return decryptAssetProperties(ctx, assetID, immutableProperties)
 }
 
 // GetAssetSalesPrice returns the sales price
-func (s *SmartContract) GetAssetSalesPrice(ctx contractapi.TransactionContextInterface, assetID string) (string, error) {
+func (s *SmartContract) GetAssetSalesPrice(ctx TransactionContextInterface, assetID string) (string, error) {
 	return getAssetPrice(ctx, assetID, typeAssetForSale)
 }
 
 // GetAssetBidPrice returns the bid price
-func (s *SmartContract) GetAssetBidPrice(ctx contractapi.TransactionContextInterface, assetID string) (string, error) {
+func (s *SmartContract) GetAssetBidPrice(ctx TransactionContextInterface, assetID string) (string, error) {
 	return getAssetPrice(ctx, assetID, typeAssetBid)
 }
 
 // getAssetPrice gets the bid or ask price from caller's implicit private data collection
-func getAssetPrice(ctx contractapi.TransactionContextInterface, assetID string, priceType string) (string, error) {
-	collection, err := getClientImplicitCollectionName(ctx)
+func getAssetPrice(ctx TransactionContextInterface, assetID string, priceType string) (string, error) {
+	collection, err := ctx.ClientCollection()
 	if err != nil {
 		return "", err
 	}
@@ -93,35 +109,35 @@ func getAssetPrice(ctx contractapi.TransactionContextInterface, assetID string,
 		return "", fmt.Errorf("failed to create composite key: %v", err)
 	}
 
-	price, err := ctx.GetStub().GetPrivateData(collection, assetPriceKey)
+	price, err := collection.Get(assetPriceKey)
 	if err != nil {
 		return "", fmt.Errorf("failed to read asset price from implicit private data collection: %v", err)
 	}
 	if price == nil {
-		return "", fmt.Errorf("asset price does not exist: %s", assetID)
+		return "", errPriceNotFound.new(assetID)
 	}
 
 	return string(price), nil
 }
 
 // QueryAssetSaleAgreements returns all of an organization's proposed sales
-func (s *SmartContract) QueryAssetSaleAgreements(ctx contractapi.TransactionContextInterface) ([]Agreement, error) {
+func (s *SmartContract) QueryAssetSaleAgreements(ctx TransactionContextInterface) ([]Agreement, error) {
 	return queryAgreementsByType(ctx, typeAssetForSale)
 }
 
 // QueryAssetBuyAgreements returns all of an organization's proposed bids
-func (s *SmartContract) QueryAssetBuyAgreements(ctx contractapi.TransactionContextInterface) ([]Agreement, error) {
+func (s *SmartContract) QueryAssetBuyAgreements(ctx TransactionContextInterface) ([]Agreement, error) {
 	return queryAgreementsByType(ctx, typeAssetBid)
 }
 
-func queryAgreementsByType(ctx contractapi.TransactionContextInterface, agreeType string) ([]Agreement, error) {
-	collection, err := getClientImplicitCollectionName(ctx)
+func queryAgreementsByType(ctx TransactionContextInterface, agreeType string) ([]Agreement, error) {
+	collection, err := ctx.ClientCollection()
 	if err != nil {
 		return nil, err
 	}
 
 	// Query for any object type starting with `agreeType`
-	agreementsIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(collection, agreeType, []string{})
+	agreementsIterator, err := collection.GetByPartialCompositeKey(agreeType, []string{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to read from private data collection: %v", err)
 	}
@@ -146,38 +162,397 @@ func queryAgreementsByType(ctx contractapi.TransactionContextInterface, agreeTyp
 	return agreements, nil
 }
 
-// QueryAssetHistory returns the chain of custody for a asset since issuance
-func (s *SmartContract) QueryAssetHistory(ctx contractapi.TransactionContextInterface, assetID string) ([]QueryResult, error) {
-	resultsIterator, err := ctx.GetStub().GetHistoryForKey(assetID)
+// PaginatedQueryResult structure used for returning paginated query results and metadata.
+// FetchedRecordsCount counts the assets of the page, the keys of other records in the range are not counted.
+type PaginatedQueryResult struct {
+	Records             []*Asset `json:"records"`
+	FetchedRecordsCount int32    `json:"fetchedRecordsCount"`
+	Bookmark            string   `json:"bookmark"`
+}
+
+// GetAssetsByRangeWithPagination performs a range query based on the start and end keys provided,
+// returning one page of assets. Works on both LevelDB and CouchDB state databases.
+func (s *SmartContract) GetAssetsByRangeWithPagination(ctx TransactionContextInterface, startKey string, endKey string,
+	pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByRangeWithPagination(startKey, endKey, pageSize, bookmark)
 	if err != nil {
 		return nil, err
 	}
 	defer resultsIterator.Close()
 
-	var results []QueryResult
+	assets, err := constructQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaginatedQueryResult{
+		Records:             assets,
+		FetchedRecordsCount: int32(len(assets)),
+		Bookmark:            responseMetadata.Bookmark,
+	}, nil
+}
+
+// QueryAssetsByOwner queries for assets owned by the given org, one page at a time.
+// Only available on state databases that support rich query (e.g. CouchDB).
+func (s *SmartContract) QueryAssetsByOwner(ctx TransactionContextInterface, ownerOrg string,
+	pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	return queryAssetsByField(ctx, "ownerOrg", ownerOrg, indexOwner, pageSize, bookmark)
+}
+
+// QueryAssetsByStatus queries for assets with the given status, one page at a time.
+// Only available on state databases that support rich query (e.g. CouchDB).
+func (s *SmartContract) QueryAssetsByStatus(ctx TransactionContextInterface, status string,
+	pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	return queryAssetsByField(ctx, "status", status, indexStatus, pageSize, bookmark)
+}
+
+// QueryAssetsByIssuer queries for assets issued by the given org, including assets split from them, one page at a time.
+// Only available on state databases that support rich query (e.g. CouchDB).
+func (s *SmartContract) QueryAssetsByIssuer(ctx TransactionContextInterface, issuerOrg string,
+	pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	return queryAssetsByField(ctx, "issuerOrg", issuerOrg, indexIssuer, pageSize, bookmark)
+}
+
+// QueryAssetsWithPagination uses a query string, page size and a bookmark to perform a query
+// for assets. Query string matching state database syntax is passed in, its selector is restricted
+// to assets so that other public records, such as delegations and audit records, cannot be queried.
+// Only available on state databases that support rich query (e.g. CouchDB).
+func (s *SmartContract) QueryAssetsWithPagination(ctx TransactionContextInterface, queryString string,
+	pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	assetQueryString, err := restrictToAssets(queryString)
+	if err != nil {
+		return nil, err
+	}
+	return getQueryResultForQueryStringWithPagination(ctx, assetQueryString, pageSize, bookmark)
+}
+
+// restrictToAssets sets the asset object type in the selector of a rich query. CouchDB combines the
+// top level fields of a selector with an implicit $and, so a condition on objectType given by the
+// caller is replaced rather than widened.
+func restrictToAssets(queryString string) (string, error) {
+	var query map[string]interface{}
+	if err := json.Unmarshal([]byte(queryString), &query); err != nil || query == nil {
+		return "", errInvalidJSON.new("query")
+	}
+	selector := map[string]interface{}{}
+	if value, ok := query["selector"]; ok {
+		if selector, ok = value.(map[string]interface{}); !ok {
+			return "", errInvalidJSON.new("query")
+		}
+	}
+	selector["objectType"] = "asset"
+	query["selector"] = selector
+	assetQuery, err := json.Marshal(query)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal query: %v", err)
+	}
+	return string(assetQuery), nil
+}
+
+// queryAssetsByField runs a rich query selecting assets whose field equals value, using the named CouchDB index
+func queryAssetsByField(ctx TransactionContextInterface, field string, value string, index string,
+	pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	query := map[string]interface{}{
+		"selector": map[string]interface{}{
+			"objectType": "asset",
+			field:        value,
+		},
+		"use_index": []string{"_design/" + index + "Doc", index},
+	}
+	queryString, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query: %v", err)
+	}
+	return getQueryResultForQueryStringWithPagination(ctx, string(queryString), pageSize, bookmark)
+}
+
+// getQueryResultForQueryStringWithPagination executes the passed in query string with
+// pagination info. The result set is built and returned as a PaginatedQueryResult.
+func getQueryResultForQueryStringWithPagination(ctx TransactionContextInterface, queryString string,
+	pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetQueryResultWithPagination(queryString, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	assets, err := constructQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaginatedQueryResult{
+		Records:             assets,
+		FetchedRecordsCount: int32(len(assets)),
+		Bookmark:            responseMetadata.Bookmark,
+	}, nil
+}
+
+// constructQueryResponseFromIterator constructs a slice of assets from the resultsIterator,
+// skipping any public records that are not assets. A value that is not JSON is an error.
+func constructQueryResponseFromIterator(resultsIterator shim.StateQueryIteratorInterface) ([]*Asset, error) {
+	assets := []*Asset{}
 	for resultsIterator.HasNext() {
-		response, err := resultsIterator.Next()
+		queryResult, err := resultsIterator.Next()
 		if err != nil {
 			return nil, err
 		}
+		var asset Asset
+		err = json.Unmarshal(queryResult.Value, &asset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal %s: %v", queryResult.Key, err)
+		}
+		if asset.ObjectType != "asset" {
+			continue
+		}
+		assets = append(assets, &asset)
+	}
 
-		var asset *Asset
-		err = json.Unmarshal(response.Value, &asset)
+	return assets, nil
+}
+
+// QueryAssetHistory returns the chain of custody for a asset since issuance, newest first
+func (s *SmartContract) QueryAssetHistory(ctx TransactionContextInterface, assetID string) ([]QueryResult, error) {
+	return getAssetHistory(ctx, assetID)
+}
+
+// QueryAssetHistoryWithPagination returns a page of the chain of custody for a asset, newest first like
+// QueryAssetHistory. The bookmark is the txId of the last record of the previous page, an empty bookmark starts
+// from the newest record. The peer cannot seek in the history of a key, so the records before the bookmark are
+// still read to find it, only the records of the page are completed with their changes and acting MSP.
+func (s *SmartContract) QueryAssetHistoryWithPagination(ctx TransactionContextInterface, assetID string,
+	pageSize int32, bookmark string) (*HistoryQueryResult, error) {
+	if pageSize <= 0 {
+		return nil, errInvalidPageSize.new(pageSize)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(assetID)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	// window holds the bookmarked record, the page and the record after it, which is the previous
+	// version of the last record of the page
+	var window []QueryResult
+	if bookmark != "" {
+		for resultsIterator.HasNext() && window == nil {
+			record, err := nextHistoryRecord(resultsIterator, assetID)
+			if err != nil {
+				return nil, err
+			}
+			if record.TxId == bookmark {
+				window = append(window, record)
+			}
+		}
+		if window == nil {
+			return nil, errUnknownBookmark.new(bookmark, assetID)
+		}
+	}
+	start := len(window)
+	for resultsIterator.HasNext() && len(window) < start+int(pageSize)+1 {
+		record, err := nextHistoryRecord(resultsIterator, assetID)
 		if err != nil {
 			return nil, err
 		}
+		window = append(window, record)
+	}
+	end := len(window)
+	if end > start+int(pageSize) {
+		end = start + int(pageSize)
+	}
 
-		timestamp, err := ptypes.Timestamp(response.Timestamp)
+	for i := start; i < end; i++ {
+		var previous *Asset
+		if i+1 < len(window) {
+			previous = window[i+1].Record
+		}
+		err = completeHistoryRecord(ctx, &window[i], previous)
 		if err != nil {
 			return nil, err
 		}
-		record := QueryResult{
-			TxId:      response.TxId,
-			Timestamp: timestamp,
-			Record:    asset,
+	}
+
+	result := &HistoryQueryResult{
+		Records:             append([]QueryResult{}, window[start:end]...),
+		FetchedRecordsCount: int32(end - start),
+	}
+	if end < len(window) {
+		result.Bookmark = window[end-1].TxId
+	}
+	return result, nil
+}
+
+// AssetSnapshot structure used for returning the state of an asset at a point in time
+type AssetSnapshot struct {
+	AssetID   string    `json:"assetID"`
+	AsOf      time.Time `json:"asOf"`
+	Exists    bool      `json:"exists"`
+	Record    *Asset    `json:"record,omitempty" metadata:"record,optional"`
+	TxId      string    `json:"txId,omitempty" metadata:"txId,optional"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// QueryAssetAsOf returns the asset as it stood at the given RFC3339 timestamp, by replaying its history up to that time.
+// If the asset had not been created yet, or had been deleted, the snapshot reports that it did not exist.
+func (s *SmartContract) QueryAssetAsOf(ctx TransactionContextInterface, assetID string, asOf string) (*AssetSnapshot, error) {
+	pointInTime, err := time.Parse(time.RFC3339, asOf)
+	if err != nil {
+		return nil, errInvalidTimestamp.new(asOf, err)
+	}
+
+	history, err := getAssetHistory(ctx, assetID)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &AssetSnapshot{
+		AssetID: assetID,
+		AsOf:    pointInTime,
+	}
+	for _, record := range history {
+		if record.Timestamp.After(pointInTime) {
+			continue
+		}
+		snapshot.Exists = !record.IsDelete && record.Record != nil
+		snapshot.Record = record.Record
+		snapshot.TxId = record.TxId
+		snapshot.Timestamp = record.Timestamp
+		break
+	}
+	return snapshot, nil
+}
+
+// getAssetHistory reads every modification of an asset, newest first as the peer returns them, including deletes.
+// Each record carries the field level changes from the previous version and the MSP that made the change.
+func getAssetHistory(ctx TransactionContextInterface, assetID string) ([]QueryResult, error) {
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(assetID)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var results []QueryResult
+	for resultsIterator.HasNext() {
+		record, err := nextHistoryRecord(resultsIterator, assetID)
+		if err != nil {
+			return nil, err
 		}
 		results = append(results, record)
 	}
 
+	var previous *Asset
+	for i := len(results) - 1; i >= 0; i-- {
+		err = completeHistoryRecord(ctx, &results[i], previous)
+		if err != nil {
+			return nil, err
+		}
+		previous = results[i].Record
+	}
+
 	return results, nil
 }
+
+// nextHistoryRecord reads the next modification of an asset from its history
+func nextHistoryRecord(resultsIterator shim.HistoryQueryIteratorInterface, assetID string) (QueryResult, error) {
+	response, err := resultsIterator.Next()
+	if err != nil {
+		return QueryResult{}, err
+	}
+
+	var asset *Asset
+	if !response.IsDelete && len(response.Value) > 0 {
+		err = json.Unmarshal(response.Value, &asset)
+		if err != nil {
+			return QueryResult{}, fmt.Errorf("failed to unmarshal asset %s in tx %s: %v", assetID, response.TxId, err)
+		}
+	}
+
+	timestamp, err := ptypes.Timestamp(response.Timestamp)
+	if err != nil {
+		return QueryResult{}, err
+	}
+	return QueryResult{
+		TxId:      response.TxId,
+		Timestamp: timestamp,
+		IsDelete:  response.IsDelete,
+		Record:    asset,
+	}, nil
+}
+
+// completeHistoryRecord sets the changes from the previous version of the asset and the acting MSP of a history
+// record. The acting MSP is the client org in the audit record of the transaction, which also names delegates
+// acting on behalf of the owner. Transactions recorded before the audit trail fall back to the ownership rules:
+// only the owner org may create, update, transfer or delete an asset.
+func completeHistoryRecord(ctx TransactionContextInterface, record *QueryResult, previous *Asset) error {
+	changes, err := diffAssets(previous, record.Record)
+	if err != nil {
+		return err
+	}
+	record.Changes = changes
+
+	auditRecord, err := getAuditRecord(ctx, record.TxId)
+	if err != nil {
+		return err
+	}
+	if auditRecord != nil {
+		record.ActingMSP = auditRecord.ClientOrg
+	} else if previous != nil {
+		record.ActingMSP = previous.OwnerOrg
+	} else if record.Record != nil {
+		record.ActingMSP = record.Record.OwnerOrg
+	}
+	return nil
+}
+
+// diffAssets returns the public fields that differ between two versions of an asset, either of which may be nil
+func diffAssets(previous, current *Asset) ([]FieldChange, error) {
+	previousFields, err := assetFields(previous)
+	if err != nil {
+		return nil, err
+	}
+	currentFields, err := assetFields(current)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(previousFields)+len(currentFields))
+	for name := range previousFields {
+		names = append(names, name)
+	}
+	for name := range currentFields {
+		if _, ok := previousFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var changes []FieldChange
+	for _, name := range names {
+		previousValue, currentValue := string(previousFields[name]), string(currentFields[name])
+		if previousValue != currentValue {
+			changes = append(changes, FieldChange{
+				Field:    name,
+				Previous: previousValue,
+				Current:  currentValue,
+			})
+		}
+	}
+	return changes, nil
+}
+
+// assetFields returns the JSON encoded value of every public field of an asset, keyed by JSON field name
+func assetFields(asset *Asset) (map[string]json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if asset == nil {
+		return fields, nil
+	}
+	assetJSON, err := json.Marshal(asset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal asset: %v", err)
+	}
+	if err := json.Unmarshal(assetJSON, &fields); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal asset fields: %v", err)
+	}
+	return fields, nil
+}
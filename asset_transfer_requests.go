@@ -0,0 +1,161 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// typeProcessedRequest prefixes the public state keys of processed requests, keyed by client org and request ID
+	typeProcessedRequest = "RQ"
+	// transientRequestID optionally carries the idempotency key of a transaction, chosen by the client
+	transientRequestID = "request_id"
+)
+
+// ProcessedRequest records the result of a transaction submitted with a request ID, so that a client
+// retrying it after a timeout gets the original result instead of running the transaction again
+type ProcessedRequest struct {
+	RequestID string          `json:"requestID"`
+	ClientOrg string          `json:"clientOrg"`
+	Function  string          `json:"function"`
+	ArgsHash  string          `json:"argsHash"` // hex encoded SHA-256 of the arguments
+	TxID      string          `json:"txID"`
+	Result    json.RawMessage `json:"result,omitempty" metadata:"result,optional"`
+}
+
+// request is a transaction with an optional request ID. Requests without an ID always run.
+type request struct {
+	key       string
+	processed *ProcessedRequest
+	replayed  bool
+}
+
+// beginRequest looks up the request ID passed in the transient map. A request already processed is replayed
+// when it has the same function and arguments; using a request ID for another transaction is an error.
+// Two submissions of a request racing each other both write its record, the later fails the MVCC check.
+func beginRequest(ctx TransactionContextInterface, function string, args ...string) (*request, error) {
+	transientMap, err := ctx.GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("error getting transient: %v", err)
+	}
+	requestID, ok := transientMap[transientRequestID]
+	if !ok {
+		return &request{}, nil
+	}
+	if len(requestID) == 0 {
+		return nil, errEmptyTransient.new(transientRequestID)
+	}
+
+	clientOrgID, err := ctx.GetClientOrgID(false)
+	if err != nil {
+		return nil, err
+	}
+	requestKey, record, err := getProcessedRequest(ctx, clientOrgID, string(requestID))
+	if err != nil {
+		return nil, err
+	}
+	argsJSON, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal arguments: %v", err)
+	}
+	argsHash := sha256.Sum256(argsJSON)
+	processed := &ProcessedRequest{
+		RequestID: string(requestID),
+		ClientOrg: clientOrgID,
+		Function:  function,
+		ArgsHash:  hex.EncodeToString(argsHash[:]),
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	if record == nil {
+		return &request{key: requestKey, processed: processed}, nil
+	}
+	if record.Function != processed.Function || record.ArgsHash != processed.ArgsHash {
+		return nil, errRequestIDReused.new(requestID, record.TxID)
+	}
+	return &request{key: requestKey, processed: record, replayed: true}, nil
+}
+
+// isReplayedRequest reports whether a transaction that succeeded replayed a request processed earlier, see beginRequest
+func isReplayedRequest(ctx TransactionContextInterface, function string) (bool, error) {
+	transientMap, err := ctx.GetTransient()
+	if err != nil {
+		return false, fmt.Errorf("error getting transient: %v", err)
+	}
+	requestID, ok := transientMap[transientRequestID]
+	if !ok {
+		return false, nil
+	}
+	clientOrgID, err := ctx.GetClientOrgID(false)
+	if err != nil {
+		return false, err
+	}
+	_, record, err := getProcessedRequest(ctx, clientOrgID, string(requestID))
+	if err != nil {
+		return false, err
+	}
+	// the record of a request processed by this transaction is not visible to it yet
+	return record != nil && record.Function == function && record.TxID != ctx.GetStub().GetTxID(), nil
+}
+
+// getProcessedRequest returns the state key of a request of the client org and its record, nil if it was not processed
+func getProcessedRequest(ctx TransactionContextInterface, clientOrgID string, requestID string) (string, *ProcessedRequest, error) {
+	requestKey, err := ctx.GetStub().CreateCompositeKey(typeProcessedRequest, []string{clientOrgID, requestID})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	recordJSON, err := ctx.GetStub().GetState(requestKey)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read request %s: %v", requestID, err)
+	}
+	if recordJSON == nil {
+		return requestKey, nil, nil
+	}
+	var record ProcessedRequest
+	err = json.Unmarshal(recordJSON, &record)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to unmarshal request %s: %v", requestID, err)
+	}
+	return requestKey, &record, nil
+}
+
+// replay unmarshals the original result of a replayed request into result
+func (r *request) replay(result interface{}) error {
+	if len(r.processed.Result) == 0 {
+		return nil
+	}
+	err := json.Unmarshal(r.processed.Result, result)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal result of request %s: %v", r.processed.RequestID, err)
+	}
+	return nil
+}
+
+// complete records the result of a request processed by this transaction
+func (r *request) complete(ctx TransactionContextInterface, result interface{}) error {
+	if r.processed == nil {
+		return nil
+	}
+	if result != nil {
+		resultJSON, err := json.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("failed to marshal result of request %s: %v", r.processed.RequestID, err)
+		}
+		r.processed.Result = resultJSON
+	}
+	recordJSON, err := json.Marshal(r.processed)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request %s: %v", r.processed.RequestID, err)
+	}
+	err = ctx.GetStub().PutState(r.key, recordJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put request %s: %v", r.processed.RequestID, err)
+	}
+	return nil
+}
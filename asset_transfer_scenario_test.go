@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/guozhe001/supply-finance-chaincode-go/events"
+	"github.com/guozhe001/supply-finance-chaincode-go/ledgertest"
+	"github.com/stretchr/testify/require"
+)
+
+func newScenario(t *testing.T) *ledgertest.Network {
+	network, err := ledgertest.NewNetwork(newAssetChaincode(t), org1MSP, org2MSP, org3MSP)
+	require.NoError(t, err)
+	for _, mspID := range network.Orgs() {
+		client, err := network.CA(mspID).NewIdentity(ledgertest.IdentityOptions{
+			Attributes: map[string]string{attributeRole: roleIssuerOperator + "," + roleTrader + "," + roleTreasury},
+		})
+		require.NoError(t, err)
+		network.SetClient(client)
+	}
+	return network
+}
+
+const org3MSP = "Org3MSP"
+
+func transientOf(values map[string]string) map[string][]byte {
+	transient := make(map[string][]byte, len(values))
+	for key, value := range values {
+		transient[key] = []byte(value)
+	}
+	return transient
+}
+
+func TestScenarioSecuredTransfer(t *testing.T) {
+	network := newScenario(t)
+	submit := func(p ledgertest.Proposal) *ledgertest.Result {
+		result, err := network.Submit(p)
+		require.NoError(t, err, p.Function)
+		return result
+	}
+
+	submit(ledgertest.Proposal{Org: org1MSP, Function: "CreateAsset", Args: []string{"asset1", "receivable"},
+		Transient: transientOf(map[string]string{"asset_properties": testAssetProperties})})
+
+	// the buyer verifies the properties shared off-chain by the seller
+	result, err := network.Evaluate(ledgertest.Proposal{Org: org2MSP, Function: "VerifyAssetProperties", Args: []string{"asset1"},
+		Transient: transientOf(map[string]string{"asset_properties": testAssetProperties})})
+	require.NoError(t, err)
+	require.Equal(t, "true", string(result.Response.Payload))
+
+	submit(ledgertest.Proposal{Org: org1MSP, Function: "AgreeToSell", Args: []string{"asset1"},
+		Transient: transientOf(map[string]string{"asset_price": testAssetPrice})})
+	submit(ledgertest.Proposal{Org: org2MSP, Function: "AgreeToBuy", Args: []string{"asset1"},
+		Transient: transientOf(map[string]string{"asset_price": testAssetPrice})})
+
+	transfer := ledgertest.Proposal{Org: org1MSP, Function: "TransferAsset", Args: []string{"asset1", org2MSP},
+		Transient: transientOf(map[string]string{"asset_properties": testAssetProperties, "asset_price": testAssetPrice})}
+
+	// the asset is endorsed by the owner org only, the buyer peer alone cannot move it
+	transfer.Endorsers = []string{org2MSP}
+	_, err = network.Submit(transfer)
+	require.Error(t, err)
+
+	transfer.Endorsers = []string{org1MSP, org2MSP}
+	submit(transfer)
+	require.Equal(t, canonical(t, testAssetProperties), string(network.Ledger.PrivateData("_implicit_org_Org2MSP", "asset1")))
+	require.Nil(t, network.Ledger.PrivateData("_implicit_org_Org1MSP", "asset1"))
+
+	// the new owner splits the asset from its own peer, the previous owner no longer can
+	split := ledgertest.Proposal{Org: org1MSP, Function: "SplitAsset", Args: []string{"asset1", "400"}}
+	_, err = network.Submit(split)
+	require.Error(t, err)
+	split.Org = org2MSP
+	children := childIDs(t, submit(split))
+
+	result, err = network.Evaluate(ledgertest.Proposal{Org: org2MSP, Function: "ReadAsset", Args: []string{children[1]}})
+	require.NoError(t, err)
+	var asset Asset
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &asset))
+	require.Equal(t, org2MSP, asset.OwnerOrg)
+	require.Equal(t, "asset1", asset.ParentID)
+}
+
+func TestScenarioRejectsCrossOrgPeer(t *testing.T) {
+	network := newScenario(t)
+
+	// a client may only write to its org's implicit collection through a peer of its own org
+	_, err := network.Submit(ledgertest.Proposal{Org: org2MSP, Endorsers: []string{org1MSP}, Function: "CreateAsset",
+		Args: []string{"asset1", "receivable"}, Transient: transientOf(map[string]string{"asset_properties": testAssetProperties})})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Org1MSP peer failed")
+	require.Nil(t, network.Ledger.State("asset1"))
+}
+
+func TestScenarioDelegatedSale(t *testing.T) {
+	network := newScenario(t)
+	submit := func(p ledgertest.Proposal) *ledgertest.Result {
+		result, err := network.Submit(p)
+		require.NoError(t, err, p.Function)
+		return result
+	}
+	properties := transientOf(map[string]string{"asset_properties": testAssetProperties})
+	submit(ledgertest.Proposal{Org: org1MSP, Function: "CreateAsset", Args: []string{"asset1", "receivable"}, Transient: properties})
+	submit(ledgertest.Proposal{Org: org1MSP, Function: "CreateAsset", Args: []string{"asset2", "receivable"},
+		Transient: transientOf(map[string]string{"asset_properties": testAsset2Properties})})
+
+	// the bank cannot act on the supplier's assets before a delegation is granted
+	list := ledgertest.Proposal{Org: org3MSP, Function: "AgreeToSell", Args: []string{"asset1"},
+		Transient: transientOf(map[string]string{"asset_price": testAssetPrice})}
+	_, err := network.Submit(list)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `"code":"NOT_OWNER"`)
+
+	expiry := network.Ledger.Clock().Add(time.Hour).Format(time.RFC3339)
+	submit(ledgertest.Proposal{Org: org1MSP, Function: "GrantDelegation", Args: []string{org3MSP, "asset1", `["list","sell"]`, expiry}})
+	submit(ledgertest.Proposal{Org: org1MSP, Function: "GrantDelegation", Args: []string{org3MSP, "*", `["split"]`, expiry}})
+
+	result := submit(list)
+	event, err := events.Unmarshal(result.Event.EventName, result.Event.Payload)
+	require.NoError(t, err)
+	require.Equal(t, org3MSP, event.ActingMSP)
+	require.Equal(t, org1MSP, event.OnBehalfOf)
+	submit(ledgertest.Proposal{Org: org2MSP, Function: "AgreeToBuy", Args: []string{"asset1"},
+		Transient: transientOf(map[string]string{"asset_price": testAssetPrice})})
+
+	// the owner org still endorses the transfer of its asset, the bank only drives it
+	result = submit(ledgertest.Proposal{Org: org3MSP, Endorsers: []string{org1MSP, org2MSP}, Function: "TransferAsset",
+		Args:      []string{"asset1", org2MSP},
+		Transient: transientOf(map[string]string{"asset_properties": testAssetProperties, "asset_price": testAssetPrice})})
+	event, err = events.Unmarshal(result.Event.EventName, result.Event.Payload)
+	require.NoError(t, err)
+	require.Equal(t, org1MSP, event.PreviousOwnerOrg)
+	require.Equal(t, org1MSP, event.OnBehalfOf)
+	// the history names the delegate that drove the transfer
+	result, err = network.Evaluate(ledgertest.Proposal{Org: org1MSP, Function: "QueryAssetHistory", Args: []string{"asset1"}})
+	require.NoError(t, err)
+	var history []QueryResult
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &history))
+	require.Equal(t, org3MSP, history[0].ActingMSP)
+	require.Equal(t, canonical(t, testAssetProperties), string(network.Ledger.PrivateData("_implicit_org_Org2MSP", "asset1")))
+	require.Nil(t, network.Ledger.PrivateData("_implicit_org_Org1MSP", "asset1"))
+
+	// delegations of the previous owner do not follow the asset
+	_, err = network.Submit(ledgertest.Proposal{Org: org3MSP, Endorsers: []string{org2MSP}, Function: "SplitAsset",
+		Args: []string{"asset1", "400"}, Transient: properties})
+	require.Error(t, err)
+
+	// the bank splits with the properties shared by the supplier, checked against the on-chain hash
+	_, err = network.Submit(ledgertest.Proposal{Org: org3MSP, Endorsers: []string{org1MSP}, Function: "SplitAsset",
+		Args: []string{"asset2", "400"}, Transient: properties})
+	require.Error(t, err)
+	children := childIDs(t, submit(ledgertest.Proposal{Org: org3MSP, Endorsers: []string{org1MSP}, Function: "SplitAsset", Args: []string{"asset2", "400"},
+		Transient: transientOf(map[string]string{"asset_properties": testAsset2Properties})}))
+	result, err = network.Evaluate(ledgertest.Proposal{Org: org1MSP, Function: "GetAssetPrivateProperties", Args: []string{children[0]}})
+	require.NoError(t, err)
+	require.Contains(t, string(result.Response.Payload), `"amount":400`)
+
+	// expired and revoked delegations no longer apply
+	network.Ledger.SetClock(network.Ledger.Clock().Add(2 * time.Hour))
+	_, err = network.Submit(ledgertest.Proposal{Org: org3MSP, Endorsers: []string{org1MSP}, Function: "SplitAsset", Args: []string{children[0], "100"},
+		Transient: transientOf(map[string]string{"asset_properties": string(result.Response.Payload)})})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `"code":"EXPIRED"`)
+	submit(ledgertest.Proposal{Org: org1MSP, Function: "RevokeDelegation", Args: []string{org3MSP, "*"}})
+	result, err = network.Evaluate(ledgertest.Proposal{Org: org1MSP, Function: "QueryDelegations", Args: []string{org1MSP}})
+	require.NoError(t, err)
+	var delegations []Delegation
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &delegations))
+	require.Len(t, delegations, 1)
+	require.Equal(t, "asset1", delegations[0].AssetID)
+}
+
+func TestScenarioPledgeAndGuaranteePolicies(t *testing.T) {
+	network := newScenario(t)
+	submit := func(p ledgertest.Proposal) *ledgertest.Result {
+		result, err := network.Submit(p)
+		require.NoError(t, err, p.Function)
+		return result
+	}
+	submit(ledgertest.Proposal{Org: org1MSP, Function: "CreateAsset", Args: []string{"asset1", "receivable"},
+		Transient: transientOf(map[string]string{"asset_properties": testAssetProperties})})
+
+	submit(ledgertest.Proposal{Org: org1MSP, Function: "PledgeAsset", Args: []string{"asset1", org3MSP}})
+	// the owner cannot accept the pledge on the financier's behalf, even with its own peers only
+	_, err := network.Submit(ledgertest.Proposal{Org: org1MSP, Endorsers: []string{org1MSP}, Function: "AcceptPledge", Args: []string{"asset1"}})
+	require.Error(t, err)
+	_, err = network.Submit(ledgertest.Proposal{Org: org1MSP, Endorsers: []string{org1MSP, org3MSP}, Function: "AcceptPledge", Args: []string{"asset1"}})
+	require.Error(t, err)
+	submit(ledgertest.Proposal{Org: org3MSP, Endorsers: []string{org1MSP, org3MSP}, Function: "AcceptPledge", Args: []string{"asset1"}})
+	_, err = network.Submit(ledgertest.Proposal{Org: org1MSP, Function: "ChangePublicDescription", Args: []string{"asset1", "pledged receivable"}})
+	require.Error(t, err)
+
+	// releasing the pledge needs the financier as well as the owner
+	release := ledgertest.Proposal{Org: org3MSP, Endorsers: []string{org3MSP}, Function: "ReleaseAsset", Args: []string{"asset1"}}
+	_, err = network.Submit(release)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "endorsement policy failure")
+	release.Endorsers = []string{org1MSP, org3MSP}
+	submit(release)
+
+	// the owner alone withdraws a guarantee that not every guarantor accepted
+	guarantee := ledgertest.Proposal{Org: org1MSP, Function: "GuaranteeAsset", Args: []string{"asset1", `["Org2MSP","Org3MSP"]`}}
+	submit(guarantee)
+	accept := ledgertest.Proposal{Org: org2MSP, Endorsers: []string{org1MSP, org2MSP}, Function: "AcceptGuarantee", Args: []string{"asset1"}}
+	submit(accept)
+	submit(ledgertest.Proposal{Org: org1MSP, Endorsers: []string{org1MSP}, Function: "ReleaseAsset", Args: []string{"asset1"}})
+	asset := readScenarioAsset(t, network, "asset1")
+	require.Equal(t, statusEnable, asset.Status)
+	require.Empty(t, asset.GuarantorOrgs)
+	require.Empty(t, asset.AcceptedGuarantorOrgs)
+
+	// every guarantor accepts the guarantee, then any one of them endorses together with the owner
+	submit(guarantee)
+	submit(accept)
+	asset = readScenarioAsset(t, network, "asset1")
+	require.Equal(t, statusGuaranteeOffered, asset.Status)
+	require.Equal(t, []string{org2MSP}, asset.AcceptedGuarantorOrgs)
+	accept.Org = org3MSP
+	submit(accept)
+	asset = readScenarioAsset(t, network, "asset1")
+	require.Equal(t, statusGuaranteed, asset.Status)
+	require.Empty(t, asset.AcceptedGuarantorOrgs)
+	release = ledgertest.Proposal{Org: org1MSP, Endorsers: []string{org2MSP, org3MSP}, Function: "ReleaseAsset", Args: []string{"asset1"}}
+	_, err = network.Submit(release)
+	require.Error(t, err)
+	release.Endorsers = []string{org1MSP, org2MSP}
+	submit(release)
+
+	// once released, the owner alone endorses updates again
+	submit(ledgertest.Proposal{Org: org1MSP, Function: "ChangePublicDescription", Args: []string{"asset1", "overdue receivable"}})
+}
+
+func readScenarioAsset(t *testing.T, network *ledgertest.Network, assetID string) *Asset {
+	result, err := network.Evaluate(ledgertest.Proposal{Org: org1MSP, Function: "ReadAsset", Args: []string{assetID}})
+	require.NoError(t, err)
+	var asset Asset
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &asset))
+	return &asset
+}
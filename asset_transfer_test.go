@@ -0,0 +1,863 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/guozhe001/supply-finance-chaincode-go/canonicaljson"
+	"github.com/guozhe001/supply-finance-chaincode-go/events"
+	"github.com/guozhe001/supply-finance-chaincode-go/ledgertest"
+	"github.com/guozhe001/supply-finance-chaincode-go/merkle"
+	"github.com/guozhe001/supply-finance-chaincode-go/middleware"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	org1MSP = "Org1MSP"
+	org2MSP = "Org2MSP"
+)
+
+const testAssetProperties = `{"objectType":"asset_properties","assetID":"asset1","issuer":"Org1MSP","amount":1000,` +
+	`"createDate":"2021-01-01T00:00:00Z","endDate":"2021-12-31T00:00:00Z","salt":"a1b2c3"}`
+
+const testAsset2Properties = `{"objectType":"asset_properties","assetID":"asset2","issuer":"Org1MSP","amount":1000,` +
+	`"createDate":"2021-01-01T00:00:00Z","endDate":"2021-12-31T00:00:00Z","salt":"d4e5f6"}`
+
+const testAssetPrice = `{"asset_id":"asset1","price":900,"trade_id":"trade1"}`
+
+// canonical returns the canonical JSON the chaincode stores for a transient payload
+func canonical(t *testing.T, payload string) string {
+	canonical, err := canonicaljson.Transform([]byte(payload))
+	require.NoError(t, err)
+	return string(canonical)
+}
+
+type testNetwork struct {
+	t      *testing.T
+	ledger *ledgertest.Ledger
+	cc     *middleware.Chaincode
+	org1   *ledgertest.Identity
+	org2   *ledgertest.Identity
+}
+
+// newAssetChaincode deploys the asset transfer contract alone, running the error hooks of its middlewares
+func newAssetChaincode(t *testing.T) *middleware.Chaincode {
+	contract := newSmartContract()
+	ccc, err := contractapi.NewChaincode(contract)
+	require.NoError(t, err)
+	return middleware.NewChaincode(ccc).Handle(contract, transactionPipeline)
+}
+
+func newTestNetwork(t *testing.T) *testNetwork {
+	cc := newAssetChaincode(t)
+	org1 := newTestIdentity(t, org1MSP, "user1", roleIssuerOperator+","+roleTrader)
+	org2 := newTestIdentity(t, org2MSP, "user1", roleIssuerOperator+","+roleTrader)
+	return &testNetwork{t: t, ledger: ledgertest.NewLedger("mychannel"), cc: cc, org1: org1, org2: org2}
+}
+
+// newTestIdentity issues a client identity of the org with the given role attribute.
+// The common name tells clients of the same org apart, as the client ID only depends on the subject and issuer.
+func newTestIdentity(t *testing.T, mspID string, commonName string, roles string) *ledgertest.Identity {
+	ca, err := ledgertest.NewCA(mspID)
+	require.NoError(t, err)
+	identity, err := ca.NewIdentity(ledgertest.IdentityOptions{CommonName: commonName, Attributes: map[string]string{attributeRole: roles}})
+	require.NoError(t, err)
+	return identity
+}
+
+// submit invokes a transaction endorsed by a peer of the client's org and requires it to succeed
+func (n *testNetwork) submit(identity *ledgertest.Identity, transient map[string]string, function string, args ...string) *ledgertest.Result {
+	result := n.invoke(identity, transient, function, args...)
+	require.Equal(n.t, int32(shim.OK), result.Response.Status, result.Response.Message)
+	return result
+}
+
+// fail invokes a transaction and requires it to fail with the error code
+func (n *testNetwork) fail(identity *ledgertest.Identity, transient map[string]string, code errorCode, function string, args ...string) *ContractError {
+	result := n.invoke(identity, transient, function, args...)
+	require.Equal(n.t, int32(shim.ERROR), result.Response.Status)
+	var contractError ContractError
+	require.NoError(n.t, json.Unmarshal([]byte(result.Response.Message), &contractError), result.Response.Message)
+	require.Equal(n.t, code, contractError.Code, result.Response.Message)
+	require.Equal(n.t, function, contractError.Function)
+	return &contractError
+}
+
+func (n *testNetwork) invoke(identity *ledgertest.Identity, transient map[string]string, function string, args ...string) *ledgertest.Result {
+	transientMap := make(map[string][]byte, len(transient))
+	for key, value := range transient {
+		transientMap[key] = []byte(value)
+	}
+	return n.ledger.Invoke(n.cc, ledgertest.Transaction{Identity: identity, Function: function, Args: args, Transient: transientMap})
+}
+
+func (n *testNetwork) readAsset(assetID string) *Asset {
+	result := n.submit(n.org1, nil, "ReadAsset", assetID)
+	var asset Asset
+	require.NoError(n.t, json.Unmarshal(result.Response.Payload, &asset))
+	return &asset
+}
+
+// childIDs returns the IDs of the assets a split created
+func childIDs(t *testing.T, result *ledgertest.Result) []string {
+	var ids []string
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &ids))
+	require.Len(t, ids, 2)
+	return ids
+}
+
+func TestCreateAndTransferAsset(t *testing.T) {
+	n := newTestNetwork(t)
+
+	result := n.submit(n.org1, map[string]string{"asset_properties": testAssetProperties}, "CreateAsset", "asset1", "receivable")
+	require.Equal(t, events.AssetCreated, result.Event.EventName)
+	asset := n.readAsset("asset1")
+	require.Equal(t, org1MSP, asset.OwnerOrg)
+	require.Equal(t, org1MSP, asset.IssuerOrg)
+	require.Equal(t, statusEnable, asset.Status)
+	require.NotNil(t, n.ledger.StateValidationParameter("asset1"))
+
+	// only a client of the owner org may read the properties from its own peer
+	result = n.submit(n.org1, nil, "GetAssetPrivateProperties", "asset1")
+	require.Equal(t, canonical(t, testAssetProperties), string(result.Response.Payload))
+	result = n.invoke(n.org2, nil, "GetAssetPrivateProperties", "asset1")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+
+	n.submit(n.org1, map[string]string{"asset_price": testAssetPrice}, "AgreeToSell", "asset1")
+	n.submit(n.org2, map[string]string{"asset_price": testAssetPrice}, "AgreeToBuy", "asset1")
+
+	result = n.submit(n.org2, map[string]string{"asset_properties": testAssetProperties}, "VerifyAssetProperties", "asset1")
+	require.Equal(t, "true", string(result.Response.Payload))
+	result = n.invoke(n.org2, map[string]string{"asset_properties": `{"assetID":"asset1"}`}, "VerifyAssetProperties", "asset1")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+
+	transient := map[string]string{"asset_properties": testAssetProperties, "asset_price": testAssetPrice}
+	result = n.submit(n.org1, transient, "TransferAsset", "asset1", org2MSP)
+	event, err := events.Unmarshal(result.Event.EventName, result.Event.Payload)
+	require.NoError(t, err)
+	require.Equal(t, org1MSP, event.PreviousOwnerOrg)
+	require.Equal(t, org2MSP, event.OwnerOrg)
+
+	require.Equal(t, org2MSP, n.readAsset("asset1").OwnerOrg)
+	require.Nil(t, n.ledger.PrivateData("_implicit_org_Org1MSP", "asset1"))
+	require.Equal(t, canonical(t, testAssetProperties), string(n.ledger.PrivateData("_implicit_org_Org2MSP", "asset1")))
+
+	// the seller can no longer act on the asset
+	result = n.invoke(n.org1, map[string]string{"asset_price": testAssetPrice}, "AgreeToSell", "asset1")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+}
+
+func TestCanonicalPayloads(t *testing.T) {
+	n := newTestNetwork(t)
+	n.submit(n.org1, map[string]string{"asset_properties": testAssetProperties}, "CreateAsset", "asset1", "receivable")
+	require.Equal(t, canonical(t, testAssetProperties), string(n.ledger.PrivateData("_implicit_org_Org1MSP", "asset1")))
+
+	// buyer and seller may encode the same documents with a different key order and whitespace
+	reorderedProperties := `{ "salt": "a1b2c3", "endDate": "2021-12-31T00:00:00Z", "createDate": "2021-01-01T00:00:00Z",
+		"amount": 1.0e3, "issuer": "Org1MSP", "assetID": "asset1", "objectType": "asset_properties" }`
+	reorderedPrice := `{"trade_id": "trade1", "price": 900, "asset_id": "asset1"}`
+	n.submit(n.org1, map[string]string{"asset_price": testAssetPrice}, "AgreeToSell", "asset1")
+	n.submit(n.org2, map[string]string{"asset_price": reorderedPrice}, "AgreeToBuy", "asset1")
+	result := n.submit(n.org2, map[string]string{"asset_properties": reorderedProperties}, "VerifyAssetProperties", "asset1")
+	require.Equal(t, "true", string(result.Response.Payload))
+
+	result = n.invoke(n.org2, map[string]string{"asset_properties": `{"assetID":"asset1","assetID":"asset2"}`}, "VerifyAssetProperties", "asset1")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+
+	n.submit(n.org1, map[string]string{"asset_properties": reorderedProperties, "asset_price": reorderedPrice}, "TransferAsset", "asset1", org2MSP)
+	require.Equal(t, canonical(t, testAssetProperties), string(n.ledger.PrivateData("_implicit_org_Org2MSP", "asset1")))
+}
+
+func TestAssetIDAllocation(t *testing.T) {
+	n := newTestNetwork(t)
+	propertiesOf := func(assetID string) map[string]string {
+		return map[string]string{"asset_properties": `{"objectType":"asset_properties","assetID":"` + assetID + `","issuer":"Org1MSP",` +
+			`"amount":1000,"createDate":"2021-01-01T00:00:00Z","endDate":"2021-12-31T00:00:00Z","salt":"a1b2c3"}`}
+	}
+
+	result := n.submit(n.org1, nil, "NextAssetID")
+	require.Equal(t, "Org1MSP-000001", string(result.Response.Payload))
+	result = n.submit(n.org1, propertiesOf("Org1MSP-000001"), "CreateAsset", "", "receivable")
+	require.Equal(t, "Org1MSP-000001", string(result.Response.Payload))
+	require.Equal(t, org1MSP, n.readAsset("Org1MSP-000001").OwnerOrg)
+
+	// existing public records are never overwritten
+	result = n.invoke(n.org1, propertiesOf("Org1MSP-000001"), "CreateAsset", "Org1MSP-000001", "receivable")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+	require.Contains(t, result.Response.Message, "asset Org1MSP-000001 already exists")
+
+	// IDs taken by clients are skipped, properties must carry the allocated ID
+	result = n.submit(n.org1, propertiesOf("Org1MSP-000002"), "CreateAsset", "Org1MSP-000002", "receivable")
+	require.Equal(t, "Org1MSP-000002", string(result.Response.Payload))
+	result = n.invoke(n.org1, propertiesOf("Org1MSP-000002"), "CreateAsset", "", "receivable")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+	require.Contains(t, result.Response.Message, "assetID: must match asset ID Org1MSP-000003")
+
+	// split assets are allocated from the sequence of their owner
+	result = n.submit(n.org1, nil, "SplitAsset", "Org1MSP-000001", "400")
+	require.Equal(t, []string{"Org1MSP-000003", "Org1MSP-000004"}, childIDs(t, result))
+	result = n.submit(n.org1, nil, "NextAssetID")
+	require.Equal(t, "Org1MSP-000005", string(result.Response.Payload))
+	sequenceKey, err := n.ledger.NewStub(ledgertest.Transaction{}).CreateCompositeKey(typeAssetSequence, []string{org1MSP})
+	require.NoError(t, err)
+	require.NotNil(t, n.ledger.StateValidationParameter(sequenceKey))
+	// assets that cannot be split fail on their status before any ID is allocated
+	n.fail(n.org1, nil, codeBadStatus, "SplitAsset", "Org1MSP-000001", "100")
+
+	price := `{"asset_id":"Org1MSP-000003","price":300,"trade_id":"trade1"}`
+	n.submit(n.org1, map[string]string{"asset_price": price}, "AgreeToSell", "Org1MSP-000003")
+	n.submit(n.org2, map[string]string{"asset_price": price}, "AgreeToBuy", "Org1MSP-000003")
+	childProperties := string(n.ledger.PrivateData("_implicit_org_Org1MSP", "Org1MSP-000003"))
+	n.submit(n.org1, map[string]string{"asset_properties": childProperties, "asset_price": price}, "TransferAsset", "Org1MSP-000003", org2MSP)
+	result = n.submit(n.org2, nil, "SplitAsset", "Org1MSP-000003", "100")
+	require.Equal(t, []string{"Org2MSP-000001", "Org2MSP-000002"}, childIDs(t, result))
+	result = n.submit(n.org1, nil, "NextAssetID")
+	require.Equal(t, "Org1MSP-000005", string(result.Response.Payload))
+	result = n.submit(n.org2, nil, "NextAssetID")
+	require.Equal(t, "Org2MSP-000003", string(result.Response.Payload))
+}
+
+func TestIdempotentRequests(t *testing.T) {
+	n := newTestNetwork(t)
+	properties := `{"objectType":"asset_properties","assetID":"Org1MSP-000001","issuer":"Org1MSP","amount":1000,` +
+		`"createDate":"2021-01-01T00:00:00Z","endDate":"2021-12-31T00:00:00Z","salt":"a1b2c3"}`
+	create := map[string]string{"asset_properties": properties, "request_id": "create-1"}
+	created := n.submit(n.org1, create, "CreateAsset", "", "receivable")
+	require.Equal(t, "Org1MSP-000001", string(created.Response.Payload))
+
+	// a retried creation returns the original asset ID instead of allocating another one
+	result := n.submit(n.org1, create, "CreateAsset", "", "receivable")
+	require.Equal(t, "Org1MSP-000001", string(result.Response.Payload))
+	require.Nil(t, result.Event)
+	// and is audited once, by the transaction that processed it
+	for txID, audited := range map[string]bool{created.TxID: true, result.TxID: false} {
+		recordKey, err := shim.CreateCompositeKey(typeAuditRecord, []string{txID})
+		require.NoError(t, err)
+		require.Equal(t, audited, n.ledger.State(recordKey) != nil)
+	}
+	result = n.submit(n.org1, nil, "NextAssetID")
+	require.Equal(t, "Org1MSP-000002", string(result.Response.Payload))
+
+	// request IDs cannot be reused for other requests, they are scoped to the client org
+	result = n.invoke(n.org1, map[string]string{"request_id": "create-1"}, "SplitAsset", "Org1MSP-000001", "400")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+	require.Contains(t, result.Response.Message, "request ID create-1 was already used")
+
+	split := map[string]string{"request_id": "split-1"}
+	children := childIDs(t, n.submit(n.org1, split, "SplitAsset", "Org1MSP-000001", "400"))
+	require.Equal(t, children, childIDs(t, n.submit(n.org1, split, "SplitAsset", "Org1MSP-000001", "400")))
+
+	price := `{"asset_id":"` + children[0] + `","price":300,"trade_id":"trade1"}`
+	n.submit(n.org1, map[string]string{"asset_price": price}, "AgreeToSell", children[0])
+	n.submit(n.org2, map[string]string{"asset_price": price}, "AgreeToBuy", children[0])
+	childProperties := string(n.ledger.PrivateData("_implicit_org_Org1MSP", children[0]))
+	transfer := map[string]string{"asset_properties": childProperties, "asset_price": price, "request_id": "transfer-1"}
+	n.submit(n.org1, transfer, "TransferAsset", children[0], org2MSP)
+	result = n.submit(n.org1, transfer, "TransferAsset", children[0], org2MSP)
+	require.Nil(t, result.Event)
+	require.Equal(t, org2MSP, n.readAsset(children[0]).OwnerOrg)
+}
+
+func TestQueryAssetHistory(t *testing.T) {
+	n := newTestNetwork(t)
+	created := n.submit(n.org1, map[string]string{"asset_properties": testAssetProperties}, "CreateAsset", "asset1", "receivable")
+	n.submit(n.org1, nil, "ChangePublicDescription", "asset1", "overdue receivable")
+	n.submit(n.org1, map[string]string{"asset_price": testAssetPrice}, "AgreeToSell", "asset1")
+	n.submit(n.org2, map[string]string{"asset_price": testAssetPrice}, "AgreeToBuy", "asset1")
+	transient := map[string]string{"asset_properties": testAssetProperties, "asset_price": testAssetPrice}
+	n.submit(n.org1, transient, "TransferAsset", "asset1", org2MSP)
+
+	result := n.submit(n.org1, nil, "QueryAssetHistory", "asset1")
+	var history []QueryResult
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &history))
+	require.Len(t, history, 3)
+	require.Equal(t, []FieldChange{{Field: "ownerOrg", Previous: `"Org1MSP"`, Current: `"Org2MSP"`}}, history[0].Changes)
+	require.Equal(t, org1MSP, history[0].ActingMSP)
+	require.Equal(t, []FieldChange{{Field: "publicDescription", Previous: `"receivable"`, Current: `"overdue receivable"`}}, history[1].Changes)
+	require.Equal(t, created.TxID, history[2].TxId)
+	require.Equal(t, org1MSP, history[2].ActingMSP)
+
+	// pages are in the same order and carry the same records
+	result = n.submit(n.org1, nil, "QueryAssetHistoryWithPagination", "asset1", "2", "")
+	var page HistoryQueryResult
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &page))
+	require.Equal(t, int32(2), page.FetchedRecordsCount)
+	require.Equal(t, history[:2], page.Records)
+	require.Equal(t, history[1].TxId, page.Bookmark)
+	result = n.submit(n.org1, nil, "QueryAssetHistoryWithPagination", "asset1", "2", page.Bookmark)
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &page))
+	require.Equal(t, int32(1), page.FetchedRecordsCount)
+	require.Equal(t, history[2:], page.Records)
+	require.Empty(t, page.Bookmark)
+	n.fail(n.org1, nil, codeInvalidArgument, "QueryAssetHistoryWithPagination", "asset1", "2", "unknown")
+
+	result = n.submit(n.org1, nil, "QueryAssetAsOf", "asset1", history[2].Timestamp.Add(-1).Format("2006-01-02T15:04:05.999999999Z07:00"))
+	var snapshot AssetSnapshot
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &snapshot))
+	require.False(t, snapshot.Exists)
+	result = n.submit(n.org1, nil, "QueryAssetAsOf", "asset1", history[1].Timestamp.Format("2006-01-02T15:04:05Z07:00"))
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &snapshot))
+	require.True(t, snapshot.Exists)
+	require.Equal(t, "overdue receivable", snapshot.Record.PublicDescription)
+	require.Equal(t, org1MSP, snapshot.Record.OwnerOrg)
+}
+
+func TestQueryAssetHistoryDeletes(t *testing.T) {
+	n := newTestNetwork(t)
+	n.ledger.PutState("asset1", []byte(mustMarshal(t, Asset{ObjectType: "asset", ID: "asset1", OwnerOrg: org1MSP, Status: statusEnable})))
+	stub := n.ledger.NewStub(ledgertest.Transaction{})
+	require.NoError(t, stub.DelState("asset1"))
+	n.ledger.Commit(stub)
+	n.ledger.PutState("asset1", []byte(mustMarshal(t, Asset{ObjectType: "asset", ID: "asset1", OwnerOrg: org2MSP, Status: statusEnable})))
+
+	// without audit records the acting MSP follows the ownership rules
+	result := n.submit(n.org1, nil, "QueryAssetHistory", "asset1")
+	var history []QueryResult
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &history))
+	require.Len(t, history, 3)
+	require.Equal(t, org2MSP, history[0].Record.OwnerOrg)
+	require.Equal(t, org2MSP, history[0].ActingMSP)
+	require.Contains(t, history[0].Changes, FieldChange{Field: "ownerOrg", Current: `"Org2MSP"`})
+	require.True(t, history[1].IsDelete)
+	require.Nil(t, history[1].Record)
+	require.Equal(t, stub.GetTxID(), history[1].TxId)
+	require.Equal(t, org1MSP, history[1].ActingMSP)
+	require.Contains(t, history[1].Changes, FieldChange{Field: "ownerOrg", Previous: `"Org1MSP"`})
+	require.False(t, history[2].IsDelete)
+	require.Equal(t, org1MSP, history[2].ActingMSP)
+
+	// a page holding only the delete still diffs it against the version before
+	result = n.submit(n.org1, nil, "QueryAssetHistoryWithPagination", "asset1", "1", history[0].TxId)
+	var page HistoryQueryResult
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &page))
+	require.Equal(t, []QueryResult{history[1]}, page.Records)
+	require.Equal(t, history[1].TxId, page.Bookmark)
+}
+
+func TestQueryAssetAsOf(t *testing.T) {
+	n := newTestNetwork(t)
+	created := time.Date(2021, 3, 1, 8, 0, 0, 0, time.UTC)
+	n.ledger.SetClock(created)
+	n.ledger.PutState("asset1", []byte(mustMarshal(t, Asset{ObjectType: "asset", ID: "asset1", OwnerOrg: org1MSP, Status: statusEnable})))
+	stub := n.ledger.NewStub(ledgertest.Transaction{})
+	require.NoError(t, stub.DelState("asset1"))
+	n.ledger.Commit(stub)
+	n.ledger.PutState("asset1", []byte(mustMarshal(t, Asset{ObjectType: "asset", ID: "asset1", OwnerOrg: org2MSP, Status: statusEnable})))
+
+	asOf := func(pointInTime time.Time) AssetSnapshot {
+		result := n.submit(n.org1, nil, "QueryAssetAsOf", "asset1", pointInTime.Format(time.RFC3339))
+		var snapshot AssetSnapshot
+		require.NoError(t, json.Unmarshal(result.Response.Payload, &snapshot))
+		return snapshot
+	}
+
+	snapshot := asOf(created.Add(-time.Second))
+	require.False(t, snapshot.Exists)
+	require.Nil(t, snapshot.Record)
+	require.Empty(t, snapshot.TxId)
+
+	// timestamps in any zone refer to the same instant
+	snapshot = asOf(created.In(time.FixedZone("CST", 8*60*60)))
+	require.True(t, snapshot.Exists)
+	require.Equal(t, org1MSP, snapshot.Record.OwnerOrg)
+	require.True(t, created.Equal(snapshot.Timestamp))
+
+	snapshot = asOf(created.Add(time.Second))
+	require.False(t, snapshot.Exists)
+	require.Equal(t, stub.GetTxID(), snapshot.TxId)
+
+	snapshot = asOf(created.Add(time.Hour))
+	require.True(t, snapshot.Exists)
+	require.Equal(t, org2MSP, snapshot.Record.OwnerOrg)
+	require.True(t, created.Add(2*time.Second).Equal(snapshot.Timestamp))
+
+	result := n.submit(n.org1, nil, "QueryAssetAsOf", "asset2", created.Format(time.RFC3339))
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &snapshot))
+	require.False(t, snapshot.Exists)
+}
+
+func TestSplitAssetAndQueries(t *testing.T) {
+	n := newTestNetwork(t)
+	n.submit(n.org1, map[string]string{"asset_properties": testAssetProperties}, "CreateAsset", "asset1", "receivable")
+
+	result := n.submit(n.org1, nil, "SplitAsset", "asset1", "400")
+	event, err := events.Unmarshal(result.Event.EventName, result.Event.Payload)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Org1MSP-000001", "Org1MSP-000002"}, event.ChildIDs)
+	require.Equal(t, event.ChildIDs, childIDs(t, result))
+	require.Equal(t, statusDelete, n.readAsset("asset1").Status)
+
+	var properties AssetProperties
+	require.NoError(t, json.Unmarshal(n.ledger.PrivateData("_implicit_org_Org1MSP", "Org1MSP-000002"), &properties))
+	require.Equal(t, 600, properties.Amount)
+	require.Equal(t, "Org1MSP-000002", properties.ID)
+
+	var page PaginatedQueryResult
+	result = n.submit(n.org1, nil, "QueryAssetChildren", "asset1", "10", "")
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &page))
+	require.Len(t, page.Records, 2)
+	require.Equal(t, org1MSP, page.Records[0].IssuerOrg)
+
+	result = n.submit(n.org1, nil, "QueryAssetsByStatusIndex", statusEnable, "10", "")
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &page))
+	require.Len(t, page.Records, 2)
+
+	result = n.submit(n.org1, nil, "QueryAssetsByOwner", org1MSP, "2", "")
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &page))
+	require.Equal(t, int32(2), page.FetchedRecordsCount)
+	require.NotEmpty(t, page.Bookmark)
+
+	result = n.submit(n.org1, nil, "GetAssetsByRangeWithPagination", "", "", "10", "")
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &page))
+	require.Len(t, page.Records, 3)
+
+	// rich queries only see assets, not the audit records also stored in the public state
+	result = n.submit(n.org1, nil, "QueryAssetsWithPagination", `{"selector":{"clientOrg":"Org1MSP"}}`, "10", "")
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &page))
+	require.Empty(t, page.Records)
+
+	result = n.submit(n.org1, nil, "QueryAssetsWithPagination", `{"selector":{"objectType":"audit"}}`, "10", "")
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &page))
+	require.Len(t, page.Records, 3)
+
+	n.fail(n.org1, nil, "INVALID_ARGUMENT", "QueryAssetsWithPagination", `{"selector":[]}`, "10", "")
+}
+
+func TestAssetIndexesFollowWrites(t *testing.T) {
+	n := newTestNetwork(t)
+	indexed := func(function string, value string) []string {
+		result := n.submit(n.org1, nil, function, value, "10", "")
+		var page PaginatedQueryResult
+		require.NoError(t, json.Unmarshal(result.Response.Payload, &page))
+		ids := []string{}
+		for _, asset := range page.Records {
+			ids = append(ids, asset.ID)
+		}
+		return ids
+	}
+
+	n.submit(n.org1, map[string]string{"asset_properties": testAssetProperties}, "CreateAsset", "asset1", "receivable")
+	require.Equal(t, []string{"asset1"}, indexed("QueryAssetsByOwnerIndex", org1MSP))
+	require.Equal(t, []string{"asset1"}, indexed("QueryAssetsByStatusIndex", statusEnable))
+
+	// a transfer moves the asset to the owner entry of the buyer
+	n.submit(n.org1, map[string]string{"asset_price": testAssetPrice}, "AgreeToSell", "asset1")
+	n.submit(n.org2, map[string]string{"asset_price": testAssetPrice}, "AgreeToBuy", "asset1")
+	n.submit(n.org1, map[string]string{"asset_properties": testAssetProperties, "asset_price": testAssetPrice}, "TransferAsset", "asset1", org2MSP)
+	require.Empty(t, indexed("QueryAssetsByOwnerIndex", org1MSP))
+	require.Equal(t, []string{"asset1"}, indexed("QueryAssetsByOwnerIndex", org2MSP))
+	stub := n.ledger.NewStub(ledgertest.Transaction{})
+	oldOwnerKey, err := stub.CreateCompositeKey(indexOwnerAsset, []string{org1MSP, "asset1"})
+	require.NoError(t, err)
+	require.Nil(t, n.ledger.State(oldOwnerKey))
+
+	// a split deletes the origin asset and indexes its children under their parent
+	result := n.submit(n.org2, nil, "SplitAsset", "asset1", "400")
+	children := childIDs(t, result)
+	require.Equal(t, children, indexed("QueryAssetChildren", "asset1"))
+	require.Equal(t, children, indexed("QueryAssetsByStatusIndex", statusEnable))
+	require.Equal(t, []string{"asset1"}, indexed("QueryAssetsByStatusIndex", statusDelete))
+	require.Equal(t, append(children, "asset1"), indexed("QueryAssetsByOwnerIndex", org2MSP))
+}
+
+func TestPaginatedAssetQueries(t *testing.T) {
+	n := newTestNetwork(t)
+	n.ledger.PutState("asset0", []byte("not an asset"))
+	n.ledger.PutState("asset1", []byte(mustMarshal(t, Asset{ObjectType: "asset", ID: "asset1", OwnerOrg: org1MSP, IssuerOrg: org1MSP, Status: statusEnable})))
+	n.ledger.PutState("asset2", []byte(mustMarshal(t, Asset{ObjectType: "asset", ID: "asset2", OwnerOrg: org2MSP, IssuerOrg: org1MSP, Status: statusEnable})))
+	n.ledger.PutState("asset3", []byte(mustMarshal(t, Asset{ObjectType: "asset", ID: "asset3", OwnerOrg: org1MSP, IssuerOrg: org2MSP, Status: statusPledged})))
+	n.ledger.PutState("asset4", []byte(mustMarshal(t, Delegation{OwnerOrg: org1MSP, AssetID: "asset1"})))
+
+	// collect walks every page of a query and returns the IDs of the assets found
+	collect := func(function string, args ...string) []string {
+		var ids []string
+		bookmark := ""
+		for {
+			result := n.submit(n.org1, nil, function, append(args, "1", bookmark)...)
+			var page PaginatedQueryResult
+			require.NoError(t, json.Unmarshal(result.Response.Payload, &page))
+			require.Equal(t, int32(len(page.Records)), page.FetchedRecordsCount)
+			for _, asset := range page.Records {
+				ids = append(ids, asset.ID)
+			}
+			if page.Bookmark == "" {
+				return ids
+			}
+			bookmark = page.Bookmark
+		}
+	}
+
+	// records that are not assets are skipped and not counted, values that are not JSON fail the page
+	require.Equal(t, []string{"asset1", "asset2", "asset3"}, collect("GetAssetsByRangeWithPagination", "asset1", "asset9"))
+	n.fail(n.org1, nil, codeInternal, "GetAssetsByRangeWithPagination", "asset0", "asset9", "1", "")
+	require.Equal(t, []string{"asset1", "asset3"}, collect("QueryAssetsByOwner", org1MSP))
+	require.Equal(t, []string{"asset1", "asset2"}, collect("QueryAssetsByIssuer", org1MSP))
+	require.Equal(t, []string{"asset3"}, collect("QueryAssetsByStatus", statusPledged))
+	require.Equal(t, []string{"asset1", "asset3"}, collect("QueryAssetsWithPagination", `{"selector":{"ownerOrg":"Org1MSP"}}`))
+	n.fail(n.org1, nil, codeInvalidArgument, "QueryAssetsWithPagination", "not a query", "1", "")
+
+	// the CouchDB indexes named by the queries ship with the chaincode
+	for index, field := range map[string]string{indexOwner: "ownerOrg", indexStatus: "status", indexIssuer: "issuerOrg"} {
+		definitionJSON, err := ioutil.ReadFile(filepath.Join("META-INF", "statedb", "couchdb", "indexes", index+".json"))
+		require.NoError(t, err)
+		var definition struct {
+			Index struct {
+				Fields []string `json:"fields"`
+			} `json:"index"`
+			DDoc string `json:"ddoc"`
+			Name string `json:"name"`
+		}
+		require.NoError(t, json.Unmarshal(definitionJSON, &definition))
+		require.Equal(t, []string{"objectType", field}, definition.Index.Fields)
+		require.Equal(t, index+"Doc", definition.DDoc)
+		require.Equal(t, index, definition.Name)
+	}
+}
+
+func TestClientIdentityAttributes(t *testing.T) {
+	n := newTestNetwork(t)
+	ca, err := ledgertest.NewCA(org1MSP)
+	require.NoError(t, err)
+
+	withAttribute, err := ca.NewIdentity(ledgertest.IdentityOptions{Attributes: map[string]string{"test": "hello"}})
+	require.NoError(t, err)
+	n.submit(withAttribute, nil, "ClientIdentityPractice")
+
+	withoutAttribute, err := ca.NewIdentity(ledgertest.IdentityOptions{CommonName: "user2"})
+	require.NoError(t, err)
+	result := n.invoke(withoutAttribute, nil, "ClientIdentityPractice")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+}
+
+func TestRoleBasedAccess(t *testing.T) {
+	n := newTestNetwork(t)
+	n.submit(n.org1, map[string]string{"asset_properties": testAssetProperties}, "CreateAsset", "asset1", "receivable")
+
+	auditor := newTestIdentity(t, org1MSP, "auditor1", roleAuditor)
+	n.submit(auditor, nil, "GetAssetPrivateProperties", "asset1")
+	result := n.invoke(auditor, nil, "ChangePublicDescription", "asset1", "overdue receivable")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+	require.Contains(t, result.Response.Message, "not allowed to call ChangePublicDescription")
+
+	treasury := newTestIdentity(t, org1MSP, "treasury1", roleTreasury)
+	result = n.invoke(treasury, map[string]string{"asset_price": testAssetPrice}, "AgreeToSell", "asset1")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+	trader := newTestIdentity(t, org1MSP, "trader1", " auditor , trader")
+	n.submit(trader, map[string]string{"asset_price": testAssetPrice}, "AgreeToSell", "asset1")
+
+	// clients without a role can only read public state
+	anonymous, err := ledgertest.NewIdentity(org1MSP, "user2")
+	require.NoError(t, err)
+	n.submit(anonymous, nil, "ReadAsset", "asset1")
+	result = n.invoke(anonymous, nil, "GetAssetPrivateProperties", "asset1")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+}
+
+func TestEveryTransactionHasAccessPolicy(t *testing.T) {
+	granted := make(map[string]bool)
+	for _, function := range publicTransactions {
+		granted[function] = true
+	}
+	for _, functions := range rolePolicy {
+		for _, function := range functions {
+			granted[function] = true
+		}
+	}
+
+	contractType := reflect.TypeOf(new(SmartContract))
+	contractInterface := reflect.TypeOf((*contractapi.ContractInterface)(nil)).Elem()
+	for i := 0; i < contractType.NumMethod(); i++ {
+		name := contractType.Method(i).Name
+		if _, ok := contractInterface.MethodByName(name); ok {
+			continue
+		}
+		require.True(t, granted[name], "transaction %s is not covered by the access policy", name)
+	}
+}
+
+func TestEveryMiddlewareFunctionIsTransaction(t *testing.T) {
+	contractType := reflect.TypeOf(new(SmartContract))
+	for _, function := range transactionPipeline.Functions() {
+		_, ok := contractType.MethodByName(function)
+		require.True(t, ok, "middlewares registered for unknown transaction %s", function)
+	}
+}
+
+func TestPauseAndAuditTrail(t *testing.T) {
+	n := newTestNetwork(t)
+	admin := newTestIdentity(t, org1MSP, "admin1", roleAdmin)
+	org2Admin := newTestIdentity(t, org2MSP, "admin1", roleAdmin)
+
+	// nobody can pause the contract until an operator org is set, then only the operator org can change it
+	n.fail(admin, nil, codeNotFound, "SetPaused", "true")
+	n.fail(n.org1, nil, codeNotFound, "GetOperatorOrg")
+	n.submit(admin, nil, "SetOperatorOrg", org1MSP)
+	n.fail(org2Admin, nil, codeForbidden, "SetOperatorOrg", org2MSP)
+	require.Equal(t, org1MSP, string(n.submit(n.org2, nil, "GetOperatorOrg").Response.Payload))
+	operatorKey, err := shim.CreateCompositeKey(typeOperatorOrg, nil)
+	require.NoError(t, err)
+	require.NotNil(t, n.ledger.StateValidationParameter(operatorKey))
+	result := n.invoke(n.org1, nil, "SetPaused", "true")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+	require.Contains(t, result.Response.Message, "not allowed to call SetPaused")
+
+	result = n.submit(n.org1, map[string]string{"asset_properties": testAssetProperties}, "CreateAsset", "asset1", "receivable")
+	recordKey, err := shim.CreateCompositeKey(typeAuditRecord, []string{result.TxID})
+	require.NoError(t, err)
+	var record AuditRecord
+	require.NoError(t, json.Unmarshal(n.ledger.State(recordKey), &record))
+	require.Equal(t, "CreateAsset", record.Function)
+	require.Equal(t, org1MSP, record.ClientOrg)
+	require.Equal(t, []string{"asset1", "receivable"}, record.Args)
+	require.NotContains(t, string(n.ledger.State(recordKey)), "a1b2c3", "transient payloads must not be audited")
+
+	// only the operator org can pause the contract
+	n.fail(org2Admin, nil, codeForbidden, "SetPaused", "true")
+	require.Equal(t, "false", string(n.submit(n.org2, nil, "IsPaused").Response.Payload))
+
+	// while paused, queries keep working and transactions changing the ledger are rejected
+	n.submit(admin, nil, "SetPaused", "true")
+	require.Equal(t, "true", string(n.submit(n.org2, nil, "IsPaused").Response.Payload))
+	n.submit(n.org1, nil, "ReadAsset", "asset1")
+	contractError := n.fail(n.org1, nil, codePaused, "ChangePublicDescription", "asset1", "overdue receivable")
+	require.Equal(t, "contract is paused by Org1MSP, ChangePublicDescription is not allowed", contractError.Message)
+
+	// failed transactions leave no audit record
+	result = n.invoke(n.org1, nil, "ChangePublicDescription", "asset1", "overdue receivable")
+	recordKey, err = shim.CreateCompositeKey(typeAuditRecord, []string{result.TxID})
+	require.NoError(t, err)
+	require.Nil(t, n.ledger.State(recordKey))
+
+	// only the org that paused the contract can resume it
+	contractError = n.fail(org2Admin, nil, codeForbidden, "SetPaused", "false")
+	require.Equal(t, "contract is paused by Org1MSP, a client from Org2MSP cannot resume it", contractError.Message)
+	require.Equal(t, "true", string(n.submit(n.org2, nil, "IsPaused").Response.Payload))
+
+	n.submit(admin, nil, "SetPaused", "false")
+	n.submit(n.org1, nil, "ChangePublicDescription", "asset1", "overdue receivable")
+
+	// resuming a contract that is not paused fails and leaves no audit record
+	n.fail(admin, nil, codeBadStatus, "SetPaused", "false")
+}
+
+// missing transient payloads are rejected before the transaction runs
+func TestRequiredTransientPayloads(t *testing.T) {
+	n := newTestNetwork(t)
+	contractError := n.fail(n.org1, map[string]string{"asset_properties": testAssetProperties}, codeInvalidArgument, "TransferAsset", "asset1", org2MSP)
+	require.Equal(t, "asset_price key not found in the transient map", contractError.Message)
+}
+
+func TestAssetOwnerWithinOrg(t *testing.T) {
+	n := newTestNetwork(t)
+	n.submit(n.org1, map[string]string{"asset_properties": testAssetProperties}, "CreateAsset", "asset1", "receivable")
+
+	seller := newTestIdentity(t, org1MSP, "trader1", roleTrader)
+	otherSeller := newTestIdentity(t, org1MSP, "trader2", roleIssuerOperator+","+roleTrader)
+	sellerID := string(n.submit(seller, nil, "GetClientOwnerID").Response.Payload)
+	n.submit(n.org1, nil, "AssignAssetOwner", "asset1", sellerID)
+	require.Equal(t, sellerID, n.readAsset("asset1").OwnerID)
+
+	// other clients of the owner org can no longer act on the asset
+	price := map[string]string{"asset_price": testAssetPrice}
+	result := n.invoke(otherSeller, price, "AgreeToSell", "asset1")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+	result = n.invoke(otherSeller, nil, "ChangePublicDescription", "asset1", "overdue receivable")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+	result = n.invoke(otherSeller, nil, "SplitAsset", "asset1", "400")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+
+	buyer := newTestIdentity(t, org2MSP, "trader1", roleTrader)
+	buyerID := string(n.submit(buyer, nil, "GetClientOwnerID").Response.Payload)
+	agreedPrice := `{"asset_id":"asset1","price":900,"trade_id":"trade1","buyer_owner_id":"` + buyerID + `"}`
+	n.submit(seller, map[string]string{"asset_price": agreedPrice}, "AgreeToSell", "asset1")
+	n.submit(buyer, map[string]string{"asset_price": agreedPrice}, "AgreeToBuy", "asset1")
+	transient := map[string]string{"asset_properties": testAssetProperties, "asset_price": agreedPrice}
+	result = n.invoke(otherSeller, transient, "TransferAsset", "asset1", org2MSP)
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+	result = n.submit(seller, transient, "TransferAsset", "asset1", org2MSP)
+	event, err := events.Unmarshal(result.Event.EventName, result.Event.Payload)
+	require.NoError(t, err)
+	require.Equal(t, buyerID, event.OwnerID)
+
+	// the asset is handed over to the buying client, split assets stay with it
+	result = n.invoke(n.org2, nil, "SplitAsset", "asset1", "400")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+	children := childIDs(t, n.submit(buyer, nil, "SplitAsset", "asset1", "400"))
+	require.Equal(t, buyerID, n.readAsset(children[0]).OwnerID)
+	require.Equal(t, buyerID, n.readAsset(children[1]).OwnerID)
+}
+
+// signProperties signs the SHA-256 of the canonical asset properties the way an issuer does off-chain
+func signProperties(t *testing.T, key *ecdsa.PrivateKey, properties string) string {
+	digest := sha256.Sum256([]byte(canonical(t, properties)))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+	der, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+func TestIssuerSignedProperties(t *testing.T) {
+	n := newTestNetwork(t)
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&issuerKey.PublicKey)
+	require.NoError(t, err)
+	n.submit(n.org1, nil, "RegisterIssuerKey", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER})))
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	result := n.invoke(n.org1, map[string]string{"asset_properties": testAssetProperties, "issuer_signature": signProperties(t, otherKey, testAssetProperties)},
+		"CreateAsset", "asset1", "receivable")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+
+	n.submit(n.org1, map[string]string{"asset_properties": testAssetProperties, "issuer_signature": signProperties(t, issuerKey, testAssetProperties)},
+		"CreateAsset", "asset1", "receivable")
+	result = n.submit(n.org2, map[string]string{"asset_properties": testAssetProperties}, "VerifyAssetProperties", "asset1")
+	require.Equal(t, "true", string(result.Response.Payload))
+
+	// split assets have new properties, they verify unsigned until the issuer attests them from the on-chain hash
+	children := childIDs(t, n.submit(n.org1, nil, "SplitAsset", "asset1", "400"))
+	childProperties := string(n.ledger.PrivateData("_implicit_org_Org1MSP", children[0]))
+	result = n.submit(n.org2, map[string]string{"asset_properties": childProperties}, "VerifyAssetProperties", children[0])
+	require.Equal(t, "true", string(result.Response.Payload))
+	result = n.submit(n.org2, map[string]string{"asset_properties": childProperties}, "VerifyAssetIssuerSignature", children[0])
+	var verification IssuerSignatureVerification
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &verification))
+	require.Equal(t, IssuerSignatureVerification{AssetID: children[0], IssuerOrg: org1MSP, Status: issuerSignatureUnsigned}, verification)
+	result = n.invoke(n.org2, nil, "AttestAssetProperties", children[0], signProperties(t, issuerKey, childProperties))
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+	n.submit(n.org1, nil, "AttestAssetProperties", children[0], signProperties(t, issuerKey, childProperties))
+	result = n.submit(n.org2, map[string]string{"asset_properties": childProperties}, "VerifyAssetProperties", children[0])
+	require.Equal(t, "true", string(result.Response.Payload))
+
+	// signatures record their key and keep verifying once the issuer registers a new one
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	newKeyDER, err := x509.MarshalPKIXPublicKey(&newKey.PublicKey)
+	require.NoError(t, err)
+	n.submit(n.org1, nil, "RegisterIssuerKey", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: newKeyDER})))
+	result = n.submit(n.org2, map[string]string{"asset_properties": childProperties}, "VerifyAssetIssuerSignature", children[0])
+	verification = IssuerSignatureVerification{}
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &verification))
+	oldKeyID := sha256.Sum256(publicKeyDER)
+	require.Equal(t, IssuerSignatureVerification{AssetID: children[0], IssuerOrg: org1MSP, Status: issuerSignatureSigned, KeyID: hex.EncodeToString(oldKeyID[:])}, verification)
+	n.fail(n.org1, nil, codeBadSignature, "AttestAssetProperties", children[1], signProperties(t, issuerKey, string(n.ledger.PrivateData("_implicit_org_Org1MSP", children[1]))))
+
+	// properties are reported unsigned whether or not their issuer has a key
+	result = n.submit(n.org2, map[string]string{"asset_properties": string(n.ledger.PrivateData("_implicit_org_Org1MSP", children[1]))},
+		"VerifyAssetProperties", children[1])
+	require.Equal(t, "true", string(result.Response.Payload))
+	org2Properties := strings.Replace(testAsset2Properties, org1MSP, org2MSP, 1)
+	n.submit(n.org2, map[string]string{"asset_properties": org2Properties}, "CreateAsset", "asset2", "receivable")
+	result = n.submit(n.org1, map[string]string{"asset_properties": org2Properties}, "VerifyAssetIssuerSignature", "asset2")
+	verification = IssuerSignatureVerification{}
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &verification))
+	require.Equal(t, issuerSignatureUnsigned, verification.Status)
+}
+
+func TestSelectiveDisclosureOfProperties(t *testing.T) {
+	n := newTestNetwork(t)
+	n.submit(n.org1, map[string]string{"asset_properties": testAssetProperties}, "CreateAsset", "asset1", "receivable")
+
+	// the owner discloses the issuer and maturity only
+	result := n.submit(n.org1, nil, "GetAssetPropertyProofs", "asset1", `["issuer","endDate"]`)
+	var proofs []*merkle.Proof
+	require.NoError(t, json.Unmarshal(result.Response.Payload, &proofs))
+	require.Len(t, proofs, 2)
+	require.Equal(t, `"Org1MSP"`, proofs[0].Value)
+	require.Equal(t, `"2021-12-31T00:00:00Z"`, proofs[1].Value)
+	require.NotContains(t, string(result.Response.Payload), "a1b2c3")
+	result = n.invoke(n.org2, nil, "GetAssetPropertyProofs", "asset1", `["issuer"]`)
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+
+	result = n.submit(n.org2, map[string]string{"property_proofs": mustMarshal(t, proofs)}, "VerifyAssetPropertyProofs", "asset1")
+	require.Equal(t, "true", string(result.Response.Payload))
+	root, err := hex.DecodeString(n.readAsset("asset1").PropertiesRoot)
+	require.NoError(t, err)
+	require.NoError(t, merkle.VerifyAll(root, proofs))
+
+	proofs[0].Value = `"Org2MSP"`
+	result = n.invoke(n.org2, map[string]string{"property_proofs": mustMarshal(t, proofs)}, "VerifyAssetPropertyProofs", "asset1")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+}
+
+func TestOrgEncryptionKey(t *testing.T) {
+	n := newTestNetwork(t)
+	encryptionKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&encryptionKey.PublicKey)
+	require.NoError(t, err)
+	publicKeyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER}))
+	n.submit(n.org1, nil, "RegisterOrgEncryptionKey", publicKeyPEM)
+	result := n.submit(n.org2, nil, "GetOrgEncryptionKey", org1MSP)
+	require.Equal(t, publicKeyPEM, string(result.Response.Payload))
+
+	// the key can only be replaced with the endorsement of its org
+	keyKey, err := n.ledger.NewStub(ledgertest.Transaction{}).CreateCompositeKey(typeOrgEncryptionKey, []string{org1MSP})
+	require.NoError(t, err)
+	require.NotNil(t, n.ledger.StateValidationParameter(keyKey))
+}
+
+func mustMarshal(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestEncryptedPropertiesAtRest(t *testing.T) {
+	n := newTestNetwork(t)
+	sellerKey := string(bytes.Repeat([]byte{1}, 32))
+	n.submit(n.org1, map[string]string{"asset_properties": testAssetProperties, "properties_key": sellerKey}, "CreateAsset", "asset1", "receivable")
+
+	stored := string(n.ledger.PrivateData("_implicit_org_Org1MSP", "asset1"))
+	require.Contains(t, stored, "encrypted_asset_properties")
+	require.NotContains(t, stored, "a1b2c3")
+	result := n.invoke(n.org1, nil, "GetAssetPrivateProperties", "asset1")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+	result = n.invoke(n.org1, map[string]string{"properties_key": string(bytes.Repeat([]byte{2}, 32))}, "GetAssetPrivateProperties", "asset1")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+	result = n.submit(n.org1, map[string]string{"properties_key": sellerKey}, "GetAssetPrivateProperties", "asset1")
+	require.Equal(t, canonical(t, testAssetProperties), string(result.Response.Payload))
+
+	// buyers still verify the plaintext against the on-chain commitment
+	result = n.submit(n.org2, map[string]string{"asset_properties": testAssetProperties}, "VerifyAssetProperties", "asset1")
+	require.Equal(t, "true", string(result.Response.Payload))
+
+	// split assets are encrypted under the same key
+	children := childIDs(t, n.submit(n.org1, map[string]string{"properties_key": sellerKey}, "SplitAsset", "asset1", "400"))
+	require.Contains(t, string(n.ledger.PrivateData("_implicit_org_Org1MSP", children[1])), "encrypted_asset_properties")
+	result = n.submit(n.org1, map[string]string{"properties_key": sellerKey}, "GetAssetPrivateProperties", children[1])
+	childProperties := string(result.Response.Payload)
+	require.Contains(t, childProperties, `"amount":600`)
+
+	// the buyer receives the plaintext and encrypts it under its own key
+	price := `{"asset_id":"` + children[1] + `","price":500,"trade_id":"trade2"}`
+	n.submit(n.org1, map[string]string{"asset_price": price}, "AgreeToSell", children[1])
+	n.submit(n.org2, map[string]string{"asset_price": price}, "AgreeToBuy", children[1])
+	n.submit(n.org1, map[string]string{"asset_properties": childProperties, "asset_price": price}, "TransferAsset", children[1], org2MSP)
+	require.Equal(t, childProperties, string(n.ledger.PrivateData("_implicit_org_Org2MSP", children[1])))
+	buyerKey := string(bytes.Repeat([]byte{3}, 32))
+	n.submit(n.org2, map[string]string{"properties_key": buyerKey}, "EncryptAssetProperties", children[1])
+	require.Contains(t, string(n.ledger.PrivateData("_implicit_org_Org2MSP", children[1])), "encrypted_asset_properties")
+	result = n.submit(n.org2, map[string]string{"properties_key": buyerKey}, "GetAssetPrivateProperties", children[1])
+	require.Equal(t, childProperties, string(result.Response.Payload))
+}
@@ -0,0 +1,190 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/guozhe001/supply-finance-chaincode-go/contracterror"
+	"github.com/guozhe001/supply-finance-chaincode-go/merkle"
+)
+
+// propertiesObjectType is the objectType of asset properties
+const propertiesObjectType = "asset_properties"
+
+// fieldError reports why a field of a transient payload is invalid
+type fieldError = contracterror.FieldError
+
+// validator collects the field errors of a payload, so that clients can fix them all at once
+type validator struct {
+	payload string
+	fields  []fieldError
+}
+
+func newValidator(payload string) *validator {
+	return &validator{payload: payload}
+}
+
+// check records a field error unless valid
+func (v *validator) check(valid bool, field string, format string, args ...interface{}) {
+	if !valid {
+		v.fields = append(v.fields, fieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+// err returns an invalid argument error listing the field errors, or nil if the payload is valid
+func (v *validator) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	messages := make([]string, len(v.fields))
+	for i, f := range v.fields {
+		if f.Field == "" {
+			messages[i] = f.Message
+		} else {
+			messages[i] = f.Field + ": " + f.Message
+		}
+	}
+	contractError := errInvalidPayload.new(v.payload, strings.Join(messages, "; "))
+	contractError.Fields = v.fields
+	return contractError
+}
+
+// decodePayload strictly decodes a JSON payload, misspelled or unknown fields are errors. Decoding errors quote
+// parts of the payload, which is private, so the client only gets the field or a generic message and the
+// decoding error is logged.
+func decodePayload(ctx TransactionContextInterface, payload string, data []byte, value interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(value)
+	if err == nil {
+		return nil
+	}
+	ctx.Logger().Debug("failed to decode payload", "payload", payload, "err", err)
+	v := newValidator(payload)
+	if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+		v.check(false, typeErr.Field, "must be a JSON %s", typeErr.Type.Kind())
+	} else {
+		v.check(false, "", "must be valid JSON without unknown fields")
+	}
+	return v.err()
+}
+
+// validateAssetProperties checks the properties of a new asset issued by issuerOrg
+func validateAssetProperties(ctx TransactionContextInterface, immutablePropertiesJSON []byte, assetID string, issuerOrg string) (*AssetProperties, error) {
+	var assetProperties AssetProperties
+	err := decodePayload(ctx, "asset_properties", immutablePropertiesJSON, &assetProperties)
+	if err != nil {
+		return nil, err
+	}
+
+	v := newValidator("asset_properties")
+	v.check(assetProperties.ObjectType == propertiesObjectType, "objectType", "must be %s", propertiesObjectType)
+	// 资产的属性ID和资产ID相同
+	v.check(assetProperties.ID == assetID, "assetID", "must match asset ID %s", assetID)
+	// 资产的发行方就是创建资产的组织，拆分出的资产沿用原资产的发行方
+	v.check(assetProperties.Issuer != "", "issuer", "is required")
+	v.check(assetProperties.Issuer == "" || assetProperties.Issuer == issuerOrg, "issuer", "must be the issuing org %s", issuerOrg)
+	v.check(assetProperties.Amount > 0, "amount", "must be positive")
+	v.check(!assetProperties.CreateDate.IsZero(), "createDate", "is required")
+	v.check(!assetProperties.EndDate.IsZero(), "endDate", "is required")
+	v.check(assetProperties.CreateDate.IsZero() || assetProperties.EndDate.IsZero() ||
+		assetProperties.EndDate.After(assetProperties.CreateDate), "endDate", "must be after createDate")
+	// the salt hides the properties behind their on-chain hash and commitment
+	v.check(assetProperties.Salt != "", "salt", "is required")
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return &assetProperties, nil
+}
+
+// validatePrice checks a bid or ask price for an asset
+func validatePrice(ctx TransactionContextInterface, priceJSON []byte, assetID string) (*Agreement, error) {
+	var agreement Agreement
+	err := decodePayload(ctx, "asset_price", priceJSON, &agreement)
+	if err != nil {
+		return nil, err
+	}
+
+	v := newValidator("asset_price")
+	v.check(agreement.ID == assetID, "asset_id", "must match asset ID %s", assetID)
+	v.check(agreement.Price > 0, "price", "must be positive")
+	v.check(agreement.TradeID != "", "trade_id", "is required")
+	v.check(agreement.BuyerOwnerID == "" || isOwnerID(agreement.BuyerOwnerID), "buyer_owner_id", "must be an owner ID returned by GetClientOwnerID")
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return &agreement, nil
+}
+
+// validatePropertyProofs checks the shape of disclosed property proofs, their hashes are verified against the properties root
+func validatePropertyProofs(ctx TransactionContextInterface, proofsJSON []byte) ([]*merkle.Proof, error) {
+	var proofs []*merkle.Proof
+	err := decodePayload(ctx, transientPropertyProofs, proofsJSON, &proofs)
+	if err != nil {
+		return nil, err
+	}
+
+	v := newValidator(transientPropertyProofs)
+	v.check(len(proofs) > 0, "", "no property proofs passed")
+	for i, proof := range proofs {
+		field := fmt.Sprintf("[%d]", i)
+		if proof == nil {
+			v.check(false, field, "is required")
+			continue
+		}
+		v.check(proof.Field != "", field+".field", "is required")
+		v.check(proof.Value != "", field+".value", "is required")
+		v.check(isHex(proof.Salt), field+".salt", "must be hex encoded")
+		v.check(proof.LeafCount > 0, field+".leafCount", "must be positive")
+		v.check(proof.Index >= 0 && proof.Index < proof.LeafCount, field+".index", "must be less than leafCount")
+		for j, sibling := range proof.Siblings {
+			v.check(isHex(sibling), fmt.Sprintf("%s.siblings[%d]", field, j), "must be hex encoded")
+		}
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return proofs, nil
+}
+
+// validateEventRecipients checks the MSP IDs an event payload is sealed to
+func validateEventRecipients(ctx TransactionContextInterface, recipientsJSON []byte) ([]string, error) {
+	var recipients []string
+	err := decodePayload(ctx, transientEventRecipients, recipientsJSON, &recipients)
+	if err != nil {
+		return nil, err
+	}
+
+	v := newValidator(transientEventRecipients)
+	seen := make(map[string]bool)
+	for i, recipient := range recipients {
+		field := fmt.Sprintf("[%d]", i)
+		v.check(recipient != "", field, "is required")
+		v.check(recipient == "" || !seen[recipient], field, "duplicate recipient %s", recipient)
+		seen[recipient] = true
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return recipients, nil
+}
+
+// isOwnerID reports whether s has the form of an owner ID, the hex encoded SHA-256 of a client ID
+func isOwnerID(s string) bool {
+	return len(s) == 64 && isHex(s) && strings.ToLower(s) == s
+}
+
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/guozhe001/supply-finance-chaincode-go/ledgertest"
+	"github.com/guozhe001/supply-finance-chaincode-go/logging"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/stretchr/testify/require"
+)
+
+// newValidationContext returns the context of a transaction validating payloads
+func newValidationContext(t *testing.T) TransactionContextInterface {
+	identity, err := ledgertest.NewIdentity(org1MSP, "user1")
+	require.NoError(t, err)
+	return newTestContext(t, ledgertest.NewLedger("mychannel"), ledgertest.Transaction{Identity: identity})
+}
+
+func TestValidateAssetProperties(t *testing.T) {
+	ctx := newValidationContext(t)
+	_, err := validateAssetProperties(ctx, []byte(testAssetProperties), "asset1", org1MSP)
+	require.NoError(t, err)
+
+	// every invalid field is reported at once
+	_, err = validateAssetProperties(ctx, []byte(`{"objectType":"asset_properties","assetID":"asset2","amount":0,`+
+		`"createDate":"2021-12-31T00:00:00Z","endDate":"2021-01-01T00:00:00Z"}`), "asset1", org1MSP)
+	require.Error(t, err)
+	fields := make(map[string]bool)
+	for _, f := range err.(*ContractError).Fields {
+		fields[f.Field] = true
+	}
+	require.Equal(t, map[string]bool{"assetID": true, "issuer": true, "amount": true, "endDate": true, "salt": true}, fields)
+
+	_, err = validateAssetProperties(ctx, []byte(testAssetProperties), "asset1", org2MSP)
+	require.Equal(t, "invalid asset_properties: issuer: must be the issuing org Org2MSP", err.(*ContractError).Message)
+
+	// decoding errors quote the private payload, the client gets a generic message and the detail is logged
+	var logs bytes.Buffer
+	contractLogger.SetOutput(&logs)
+	contractLogger.SetLevel(logging.LevelDebug)
+	defer contractLogger.SetLevel(logging.LevelFromEnv())
+	defer contractLogger.SetOutput(os.Stderr)
+	_, err = validateAssetProperties(ctx, []byte(`{"objectType":"asset_properties","ammount":1000}`), "asset1", org1MSP)
+	require.Equal(t, "invalid asset_properties: must be valid JSON without unknown fields", err.(*ContractError).Message)
+	require.Contains(t, logs.String(), `unknown field \"ammount\"`)
+	_, err = validateAssetProperties(ctx, []byte(`{"salt":"a1b2c3"`), "asset1", org1MSP)
+	require.Equal(t, "invalid asset_properties: must be valid JSON without unknown fields", err.(*ContractError).Message)
+	_, err = validateAssetProperties(ctx, []byte(`{"amount":"1000"}`), "asset1", org1MSP)
+	require.Equal(t, "invalid asset_properties: amount: must be a JSON int", err.(*ContractError).Message)
+}
+
+func TestValidatePrice(t *testing.T) {
+	ctx := newValidationContext(t)
+	agreement, err := validatePrice(ctx, []byte(testAssetPrice), "asset1")
+	require.NoError(t, err)
+	require.Equal(t, 900, agreement.Price)
+
+	_, err = validatePrice(ctx, []byte(`{"asset_id":"asset2","price":-1,"buyer_owner_id":"user1"}`), "asset1")
+	require.Equal(t, "invalid asset_price: asset_id: must match asset ID asset1; price: must be positive; "+
+		"trade_id: is required; buyer_owner_id: must be an owner ID returned by GetClientOwnerID", err.(*ContractError).Message)
+}
+
+func TestValidateTransientPayloads(t *testing.T) {
+	n := newTestNetwork(t)
+	result := n.invoke(n.org1, map[string]string{"asset_properties": testAsset2Properties}, "CreateAsset", "asset1", "receivable")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+	require.Contains(t, result.Response.Message, "assetID: must match asset ID asset1")
+
+	n.submit(n.org1, map[string]string{"asset_properties": testAssetProperties}, "CreateAsset", "asset1", "receivable")
+	result = n.invoke(n.org1, map[string]string{"asset_price": `{"asset_id":"asset1","price":0,"trade_id":"trade1"}`}, "AgreeToSell", "asset1")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+	require.Contains(t, result.Response.Message, "price: must be positive")
+
+	// split assets must keep a positive amount
+	result = n.invoke(n.org1, nil, "SplitAsset", "asset1", "0")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+	require.Contains(t, result.Response.Message, "amount: must be positive")
+
+	result = n.invoke(n.org2, map[string]string{"property_proofs": `[{"field":"issuer","salt":"xyz","index":2,"leafCount":1}]`},
+		"VerifyAssetPropertyProofs", "asset1")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+	require.Contains(t, result.Response.Message, "[0].value: is required; [0].salt: must be hex encoded; [0].index: must be less than leafCount")
+
+	result = n.invoke(n.org1, map[string]string{"asset_price": testAssetPrice, "event_recipients": `["Org2MSP","Org2MSP"]`}, "AgreeToSell", "asset1")
+	require.Equal(t, int32(shim.ERROR), result.Response.Status)
+	require.Contains(t, result.Response.Message, "[1]: duplicate recipient Org2MSP")
+}
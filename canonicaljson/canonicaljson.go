@@ -0,0 +1,253 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package canonicaljson produces the canonical form of JSON documents following the JSON Canonicalization
+// Scheme of RFC 8785, so that parties hashing or signing the same document get the same bytes whatever
+// the key order, whitespace or number formatting of their JSON encoder.
+//
+// Object members are sorted by the UTF-16 code units of their names, insignificant whitespace is removed,
+// strings use the minimal escaping of ECMAScript JSON.stringify and numbers are serialized as ECMAScript
+// doubles. Documents with duplicate member names, invalid UTF-8, numbers outside the range of a double
+// or integers that a double cannot hold exactly are rejected.
+package canonicaljson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Transform returns the canonical form of a JSON document
+func Transform(data []byte) ([]byte, error) {
+	if !utf8.Valid(data) {
+		return nil, errors.New("invalid UTF-8 in JSON document")
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var buf bytes.Buffer
+	if err := transformValue(dec, &buf); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after JSON document")
+	}
+	return buf.Bytes(), nil
+}
+
+// Marshal returns the canonical JSON encoding of v
+func Marshal(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return Transform(data)
+}
+
+func transformValue(dec *json.Decoder, buf *bytes.Buffer) error {
+	token, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("invalid JSON document: %v", err)
+	}
+
+	switch value := token.(type) {
+	case json.Delim:
+		switch value {
+		case '{':
+			return transformObject(dec, buf)
+		case '[':
+			return transformArray(dec, buf)
+		}
+		return fmt.Errorf("unexpected %v in JSON document", value)
+	case string:
+		writeString(buf, value)
+	case json.Number:
+		number, err := formatNumber(value)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(number)
+	case bool:
+		buf.WriteString(strconv.FormatBool(value))
+	case nil:
+		buf.WriteString("null")
+	default:
+		return fmt.Errorf("unexpected token %v in JSON document", token)
+	}
+	return nil
+}
+
+func transformObject(dec *json.Decoder, buf *bytes.Buffer) error {
+	type member struct {
+		name  string
+		value []byte
+	}
+	var members []member
+	names := make(map[string]bool)
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("invalid JSON document: %v", err)
+		}
+		name, ok := token.(string)
+		if !ok {
+			return fmt.Errorf("unexpected object member name %v", token)
+		}
+		if names[name] {
+			return fmt.Errorf("duplicate object member %q", name)
+		}
+		names[name] = true
+
+		var value bytes.Buffer
+		if err := transformValue(dec, &value); err != nil {
+			return err
+		}
+		members = append(members, member{name: name, value: value.Bytes()})
+	}
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("invalid JSON document: %v", err)
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return lessUTF16(members[i].name, members[j].name)
+	})
+	buf.WriteByte('{')
+	for i, m := range members {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeString(buf, m.name)
+		buf.WriteByte(':')
+		buf.Write(m.value)
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func transformArray(dec *json.Decoder, buf *bytes.Buffer) error {
+	buf.WriteByte('[')
+	for i := 0; dec.More(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := transformValue(dec, buf); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("invalid JSON document: %v", err)
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+// lessUTF16 orders strings by their UTF-16 code units, as RFC 8785 sorts object members
+func lessUTF16(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
+
+// writeString writes a JSON string with the escaping of ECMAScript JSON.stringify
+func writeString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// formatNumber serializes a number the way ECMAScript Number.prototype.toString does. Integer literals
+// must come out as the same integer, a double silently rounds those above 2^53 to a different amount.
+func formatNumber(number json.Number) (string, error) {
+	f, err := strconv.ParseFloat(string(number), 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", fmt.Errorf("number %s is not representable as a double", number)
+	}
+	if f == 0 {
+		return "0", nil
+	}
+
+	sign := ""
+	if f < 0 {
+		sign = "-"
+		f = -f
+	}
+	// shortest digits that round trip, as d.ddde±x
+	mantissa, exponent := splitExponent(strconv.FormatFloat(f, 'e', -1, 64))
+	digits := strings.Replace(mantissa, ".", "", 1)
+	k := len(digits)
+	n := exponent + 1
+
+	// JSON integers have no leading zeros, so the literal matches the digits of an exact double
+	if literal := strings.TrimPrefix(string(number), "-"); !strings.ContainsAny(literal, ".eE") {
+		if k > n || literal != digits+strings.Repeat("0", n-k) {
+			return "", fmt.Errorf("integer %s is not exactly representable as a double", number)
+		}
+	}
+
+	switch {
+	case k <= n && n <= 21:
+		return sign + digits + strings.Repeat("0", n-k), nil
+	case 0 < n && n <= 21:
+		return sign + digits[:n] + "." + digits[n:], nil
+	case -6 < n && n <= 0:
+		return sign + "0." + strings.Repeat("0", -n) + digits, nil
+	}
+	exponentSign := "+"
+	if n-1 < 0 {
+		exponentSign = "-"
+	}
+	result := digits[:1]
+	if k > 1 {
+		result += "." + digits[1:]
+	}
+	return sign + result + "e" + exponentSign + strconv.Itoa(abs(n-1)), nil
+}
+
+func splitExponent(s string) (string, int) {
+	i := strings.IndexByte(s, 'e')
+	exponent, _ := strconv.Atoi(s[i+1:])
+	return s[:i], exponent
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,75 @@
+package canonicaljson
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransform(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{` { "b" : 1, "a" : [ true, null, "x" ] } `, `{"a":[true,null,"x"],"b":1}`},
+		{`{"price":900,"asset_id":"asset1","trade_id":"trade1"}`, `{"asset_id":"asset1","price":900,"trade_id":"trade1"}`},
+		{`{"nested":{"z":{},"y":[]}}`, `{"nested":{"y":[],"z":{}}}`},
+		// UTF-16 code unit order puts the surrogate pair of U+1F600 before U+FB01
+		{`{"ﬁ":1,"😀":2,"é":3,"e":4}`, "{\"e\":4,\"é\":3,\"\U0001F600\":2,\"ﬁ\":1}"},
+		{`"A\u000f\n\/<>& "`, "\"A\\u000f\\n/<>& \""},
+	}
+	for _, c := range cases {
+		output, err := Transform([]byte(c.input))
+		require.NoError(t, err, c.input)
+		require.Equal(t, c.expected, string(output), c.input)
+	}
+}
+
+func TestTransformNumbers(t *testing.T) {
+	cases := map[string]string{
+		"0":                      "0",
+		"-0":                     "0",
+		"1000":                   "1000",
+		"1.0":                    "1",
+		"1E3":                    "1000",
+		"-12.5":                  "-12.5",
+		"0.000001":               "0.000001",
+		"0.0000001":              "1e-7",
+		"123456789012345680000":  "123456789012345680000",
+		"1234567890123456800000": "1.2345678901234568e+21",
+		"9007199254740992":       "9007199254740992",
+		"-9007199254740993.0":    "-9007199254740992",
+		"1e-10":                  "1e-10",
+		"5e-324":                 "5e-324",
+		"1.7976931348623157e308": "1.7976931348623157e+308",
+	}
+	for input, expected := range cases {
+		output, err := Transform([]byte(input))
+		require.NoError(t, err, input)
+		require.Equal(t, expected, string(output), input)
+	}
+}
+
+func TestTransformRejectsInvalidDocuments(t *testing.T) {
+	for _, input := range []string{
+		`{"a":1,"a":2}`,
+		`{"a":1} {}`,
+		`{"a":`,
+		`1e400`,
+		`9007199254740993`,
+		`{"amount":-18014398509481985}`,
+		"\"\xff\"",
+	} {
+		_, err := Transform([]byte(input))
+		require.Error(t, err, input)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	output, err := Marshal(struct {
+		B string `json:"b"`
+		A string `json:"a"`
+	}{B: "<&>", A: "x"})
+	require.NoError(t, err)
+	require.Equal(t, `{"a":"x","b":"<&>"}`, string(output))
+}
@@ -0,0 +1,10 @@
+package chaincode
+
+import "github.com/guozhe001/supply-finance-chaincode-go/contracterror"
+
+// 练习合约的错误目录，与资产转移合约使用相同的错误码和JSON格式，其他错误都作为内部错误返回
+var (
+	errAssetNotFound     = contracterror.Message{Code: contracterror.NotFound, En: "the asset %s does not exist", Zh: "资产%s不存在"}
+	errAssetExists       = contracterror.Message{Code: contracterror.AlreadyExists, En: "the asset %s already exists", Zh: "资产%s已存在"}
+	errAttributeMismatch = contracterror.Message{Code: contracterror.Forbidden, En: "client attribute %s is not %s", Zh: "客户端属性%[1]s的值不是%[2]s"}
+)
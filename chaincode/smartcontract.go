@@ -1,15 +1,26 @@
 package chaincode
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/golang/protobuf/proto"
+	"github.com/guozhe001/supply-finance-chaincode-go/contracterror"
+	"github.com/guozhe001/supply-finance-chaincode-go/logging"
+	"github.com/guozhe001/supply-finance-chaincode-go/middleware"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 	"github.com/hyperledger/fabric-protos-go/peer"
-	"log"
-	"unsafe"
+	"os"
 )
 
+// privateLogKeys 不记录到日志中的键：客户端的证书和身份信息
+var privateLogKeys = []string{"creator", "id", "subject", "issuer", "value"}
+
+// logger 练习合约的日志，字节数组只记录长度，客户端的身份信息被隐去，不会把临时数据、私有数据和证书打印到节点日志中
+var logger = logging.New("practice", os.Stderr, logging.LevelFromEnv()).WithRedactor(logging.NewRedactor(privateLogKeys...))
+
 // SmartContract provides functions for managing an Asset
 type SmartContract struct {
 	contractapi.Contract
@@ -64,7 +75,7 @@ func (s *SmartContract) CreateAsset(ctx contractapi.TransactionContextInterface,
 		return err
 	}
 	if exists {
-		return fmt.Errorf("the asset %s already exists", id)
+		return errAssetExists.New(id)
 	}
 
 	asset := Asset{
@@ -89,7 +100,7 @@ func (s *SmartContract) ReadAsset(ctx contractapi.TransactionContextInterface, i
 		return nil, fmt.Errorf("failed to read from world state: %v", err)
 	}
 	if assetJSON == nil {
-		return nil, fmt.Errorf("the asset %s does not exist", id)
+		return nil, errAssetNotFound.New(id)
 	}
 
 	var asset Asset
@@ -108,7 +119,7 @@ func (s *SmartContract) UpdateAsset(ctx contractapi.TransactionContextInterface,
 		return err
 	}
 	if !exists {
-		return fmt.Errorf("the asset %s does not exist", id)
+		return errAssetNotFound.New(id)
 	}
 
 	// overwriting original asset with new asset
@@ -134,7 +145,7 @@ func (s *SmartContract) DeleteAsset(ctx contractapi.TransactionContextInterface,
 		return err
 	}
 	if !exists {
-		return fmt.Errorf("the asset %s does not exist", id)
+		return errAssetNotFound.New(id)
 	}
 
 	return ctx.GetStub().DelState(id)
@@ -201,25 +212,27 @@ func (s *SmartContract) SomeStubMethod(ctx contractapi.TransactionContextInterfa
 	// 2021/01/25 08:06:32 stub.GetArgs(),i=0, arg=Practice_SmartContract:SomeStubMethod
 	//2021/01/25 08:06:32 stub.GetArgs(),i=1, arg=asset1
 	for i, arg := range stub.GetArgs() {
-		log.Printf("stub.GetArgs(),i=%d, arg=%s", i, byteToString(arg))
+		logger.Debug("stub.GetArgs()", "i", i, "arg", string(arg))
 	}
 	for i, arg := range stub.GetStringArgs() {
-		log.Printf("stub.GetStringArgs(),i=%d, arg=%s", i, arg)
+		logger.Debug("stub.GetStringArgs()", "i", i, "arg", arg)
 	}
 	binding, err := stub.GetBinding()
 	if err != nil {
 		return err
 	}
-	log.Printf("stub.GetBinding()=%s", byteToString(binding))
-	for k, v := range stub.GetDecorations() {
-		log.Printf("stub.GetDecorations(), k=%s, v=%s", k, byteToString(v))
-	}
+	logger.Debug("stub.GetBinding()", "binding", binding)
+	logger.Debug("stub.GetDecorations()", "decorations", stub.GetDecorations())
 	// stub.GetCreator()返回的是证书，如过是组织s2.supply.com的管理员发起的交易，则此处获得的是：Admin@s2.supply.com-cert.pem
-	creator, err := stub.GetCreator()
+	// 证书包含客户端的身份信息，只记录组织和客户端ID的哈希
+	if _, err := stub.GetCreator(); err != nil {
+		return err
+	}
+	mspID, clientID, err := clientLogIdentity(ctx)
 	if err != nil {
 		return err
 	}
-	log.Printf("stub.GetCreator()=%s", byteToString(creator))
+	logger.Debug("stub.GetCreator()", "mspID", mspID, "clientID", clientID)
 	// 已经签名的提议，包含以下内容：
 	// 1.通道名称
 	// 2.链码名称
@@ -254,15 +267,15 @@ func (s *SmartContract) SomeStubMethod(ctx contractapi.TransactionContextInterfa
 	if err != nil {
 		return err
 	}
-	log.Printf("stub.GetSignedProposal()=%#v", proposal)
+	// 提议中包含临时数据，只记录长度
 	bytes := proposal.GetProposalBytes()
-	log.Printf("stub.GetSignedProposal().GetProposalBytes()=%s", byteToString(bytes))
+	logger.Debug("stub.GetSignedProposal().GetProposalBytes()", "proposalBytes", bytes)
 	p := &peer.Proposal{}
 	err = proto.Unmarshal(bytes, p)
 	if err != nil {
 		return err
 	}
-	log.Printf("stub.GetSignedProposal().GetProposalBytes(),proto.Unmarshal=%#v", p)
+	logger.Debug("stub.GetSignedProposal().GetProposalBytes(),proto.Unmarshal", "header", p.GetHeader(), "payload", p.GetPayload())
 	//headerBytes:= p.GetHeader()
 	//header := &peer.ChaincodeHeaderExtension{}
 	//err = proto.Unmarshal(headerBytes, header)
@@ -277,7 +290,7 @@ func (s *SmartContract) SomeStubMethod(ctx contractapi.TransactionContextInterfa
 	//	return err
 	//}
 	//log.Printf("stub.GetSignedProposal().GetProposalBytes()-Proposal-GetPayload()=%#v", payload)
-	log.Printf("stub.GetSignedProposal().GetSignature()=%s", byteToString(proposal.GetSignature()))
+	logger.Debug("stub.GetSignedProposal().GetSignature()", "signature", proposal.GetSignature())
 
 	// 设置一个Event
 	if err := stub.SetEvent("hello event", []byte("hello")); err != nil {
@@ -301,60 +314,58 @@ func (s *SmartContract) SomeStubMethod(ctx contractapi.TransactionContextInterfa
 		if err != nil {
 			return err
 		}
-		log.Printf("stub.GetHistoryForKey(%s), next=%#v", assetID, next)
+		logger.Debug("stub.GetHistoryForKey()", "assetID", assetID, "txID", next.GetTxId(), "value", next.GetValue(), "isDelete", next.GetIsDelete())
 	}
 
 	return nil
 }
 
-func byteToString(data []byte) string {
-	str := (*string)(unsafe.Pointer(&data))
-	return *str
-}
-
 func (s *SmartContract) ContractPractice(ctx contractapi.TransactionContextInterface) {
 	// s.GetName()是当前智能合约的名称，一个链码包中有多个智能合约，每个智能合约的名称必须不同，因此最好每个智能合约都实现这个方法来定义自己的名称
-	log.Printf("s.GetName()=%s", s.GetName())
-	log.Printf("s.GetInfo()=%#v", s.GetInfo())
-	log.Printf("s.GetTransactionContextHandler()=%#v", s.GetTransactionContextHandler())
+	logger.Debug("s.GetName()", "name", s.GetName())
+	logger.Debug("s.GetInfo()", "info", s.GetInfo())
+	logger.Debug("s.GetTransactionContextHandler()", "handler", fmt.Sprintf("%T", s.GetTransactionContextHandler()))
 }
 
 // ClientIdentityPractice ClientIdentity接口提供的方法练习
 func (s *SmartContract) ClientIdentityPractice(ctx contractapi.TransactionContextInterface) error {
-	log.Println("ClientIdentityPractice==================start=====================")
+	logger.Debug("ClientIdentityPractice start")
 	clientIdentity := ctx.GetClientIdentity()
-	id, err := clientIdentity.GetID()
-	if err != nil {
-		return err
-	}
-	log.Printf("clientIdentity.GetID()=%s", id)
-	mspid, err := clientIdentity.GetMSPID()
-	if err != nil {
-		return err
-	}
-	log.Printf("clientIdentity.GetMSPID()=%s", mspid)
-	certificate, err := clientIdentity.GetX509Certificate()
+	mspID, clientID, err := clientLogIdentity(ctx)
 	if err != nil {
 		return err
 	}
-	log.Printf("clientIdentity.GetX509Certificate()=%#v", certificate)
-	value, found, err := clientIdentity.GetAttributeValue("test")
+	logger.Debug("clientIdentity.GetMSPID()", "mspID", mspID, "clientID", clientID)
+	_, found, err := clientIdentity.GetAttributeValue("test")
 	if err != nil {
 		return err
 	}
-	if found {
-		log.Printf("clientIdentity.GetAttributeValue(\"test\")=%s", value)
-	}
+	logger.Debug("clientIdentity.GetAttributeValue(\"test\")", "found", found)
 
 	if err := clientIdentity.AssertAttributeValue("test", "hello"); err != nil {
-		log.Printf("clientIdentity.AssertAttributeValue(\"test\", \"hello\") error!")
-		return err
+		logger.Debug("clientIdentity.AssertAttributeValue(\"test\", \"hello\") error!")
+		return errAttributeMismatch.New("test", "hello")
 	}
 
-	log.Println("ClientIdentityPractice===================end======================")
+	logger.Debug("ClientIdentityPractice end")
 	return nil
 }
 
+// clientLogIdentity 返回记录到日志中的客户端身份：组织和客户端ID的SHA-256，不记录证书的主题和颁发者
+func clientLogIdentity(ctx contractapi.TransactionContextInterface) (string, string, error) {
+	clientIdentity := ctx.GetClientIdentity()
+	mspID, err := clientIdentity.GetMSPID()
+	if err != nil {
+		return "", "", err
+	}
+	id, err := clientIdentity.GetID()
+	if err != nil {
+		return "", "", err
+	}
+	hash := sha256.Sum256([]byte(id))
+	return mspID, hex.EncodeToString(hash[:]), nil
+}
+
 // GetUnknownTransaction returns the current set unknownTransaction, may be nil
 func (s *SmartContract) GetUnknownTransaction() interface{} {
 	return s.UnknownTransaction
@@ -362,7 +373,7 @@ func (s *SmartContract) GetUnknownTransaction() interface{} {
 
 // Default 如果不指定方法名称时指定的默认方法
 func (s *SmartContract) UnknownTransaction(ctx contractapi.TransactionContextInterface) string {
-	log.Printf("hello, i'm Default func！")
+	logger.Debug("hello, i'm Default func！")
 	return "Bye!"
 }
 
@@ -371,8 +382,8 @@ func (s *SmartContract) GetBeforeTransaction() interface{} {
 	return s.BeforeTransaction
 }
 
-func (s *SmartContract) BeforeTransaction(ctx contractapi.TransactionContextInterface) {
-	log.Printf("i'm BeforeTransaction")
+func (s *SmartContract) BeforeTransaction(ctx contractapi.TransactionContextInterface) error {
+	return Pipeline.Before(ctx)
 }
 
 // GetAfterTransaction returns the current set afterTransaction, may be nil
@@ -380,12 +391,31 @@ func (s *SmartContract) GetAfterTransaction() interface{} {
 	return s.AfterTransaction
 }
 
-func (s *SmartContract) AfterTransaction(ctx contractapi.TransactionContextInterface) {
-	log.Printf("i'm AfterTransaction")
+func (s *SmartContract) AfterTransaction(ctx contractapi.TransactionContextInterface, result interface{}) error {
+	return Pipeline.After(ctx, result)
 }
 
+// Pipeline 合约的中间件，记录每个交易的调用，错误以contracterror.Error的JSON返回；
+// 链码需要用middleware.Chaincode包装才会执行错误处理
+var Pipeline = middleware.New(contracterror.Structured, middleware.Middleware{
+	Name: "logging",
+	Before: func(ctx contractapi.TransactionContextInterface, function string) error {
+		logger.Debug("i'm BeforeTransaction", "function", function)
+		return nil
+	},
+	After: func(ctx contractapi.TransactionContextInterface, function string, result interface{}) error {
+		logger.Debug("i'm AfterTransaction", "function", function)
+		return nil
+	},
+	// 内部错误不返回给客户端，只记录在日志中
+	Error: func(stub shim.ChaincodeStubInterface, function string, err error) error {
+		logger.Warning("transaction failed", "txID", stub.GetTxID(), "function", function, "err", err)
+		return err
+	},
+})
+
 func (s *SmartContract) IgnoredMe(ctx contractapi.TransactionContextInterface) {
-	log.Printf("Ignored Me!")
+	logger.Debug("Ignored Me!")
 }
 
 func (s *SmartContract) GetIgnoredFunctions() []string {
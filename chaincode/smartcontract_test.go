@@ -1,13 +1,18 @@
 package chaincode
 
 import (
+	"bytes"
 	"encoding/json"
+	"github.com/guozhe001/supply-finance-chaincode-go/ledgertest"
+	"github.com/guozhe001/supply-finance-chaincode-go/logging"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
 	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
 	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-chaincode-go/shimtest"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 	"github.com/stretchr/testify/require"
 	"log"
+	"os"
 	"testing"
 )
 
@@ -99,7 +104,7 @@ func printAsset(t *testing.T, state []byte) {
 func getArgs(t *testing.T, stub *shimtest.MockStub) {
 	args := stub.GetArgs()
 	for _, arg := range args {
-		log.Printf("stub.GetArgs(), %s", byteToString(arg))
+		log.Printf("stub.GetArgs(), %s", string(arg))
 	}
 
 	stringArgs := stub.GetStringArgs()
@@ -179,7 +184,7 @@ func setStateValidationParameter(t *testing.T, stub *shimtest.MockStub) {
 	// GetStateValidationParameter获取基于状态的背书策略
 	parameter, err := stub.GetStateValidationParameter(AssetId)
 	require.NoError(t, err)
-	str := byteToString(parameter)
+	str := string(parameter)
 	// 打印出来的StateValidationParameter有特殊字符，所以使用包含传入的字符的方式断言
 	log.Printf("ID=%s, StateValidationParameter=%s", AssetId, str)
 	require.Contains(t, str, TestMSP)
@@ -225,7 +230,7 @@ func getPrivateData(t *testing.T, stub *shimtest.MockStub) {
 	require.NoError(t, stub.SetPrivateDataValidationParameter(TestCollection, key, policy))
 	parameter, err := stub.GetPrivateDataValidationParameter(TestCollection, key)
 	require.NoError(t, err)
-	str := byteToString(parameter)
+	str := string(parameter)
 	// 打印出来的StateValidationParameter有特殊字符，所以使用包含传入的字符的方式断言
 	log.Printf("ID=%s, StateValidationParameter=%s", AssetId, str)
 	require.Contains(t, str, TestMSP)
@@ -294,13 +299,13 @@ func contractTest(t *testing.T, ccc *contractapi.ContractChaincode, stub *shimte
 	stub.MockTransactionStart("contract_test")
 	// 如果调用一个不存在的方法，如果实现了GetUnknownTransaction接口，则会执行此接口返回的方法；否则不执行，并且也不会报错，但是如果有before方法是会执行的
 	response := stub.MockInvoke("uuid_002", [][]byte{[]byte("Unknow")})
-	log.Printf("response=%#v, response.Status=%d, response.Payload=%s", response, response.Status, byteToString(response.Payload))
+	log.Printf("response=%#v, response.Status=%d, response.Payload=%s", response, response.Status, string(response.Payload))
 	// 调用一个被忽略的方法, 虽然IgnoredMe方法在智能合约中存在，但是因为合约满足IgnoreContractInterface接口然后把这个方法加入到了忽略列表中，所以最后还是调用的默认方法
 	response = stub.MockInvoke("uuid_002", [][]byte{[]byte("IgnoredMe")})
-	log.Printf("response=%#v, response.Status=%d, response.Payload=%s", response, response.Status, byteToString(response.Payload))
+	log.Printf("response=%#v, response.Status=%d, response.Payload=%s", response, response.Status, string(response.Payload))
 	// 指定某个指定合约，调用一个不存在的方法，冒号前面的部分是智能合约名称，后面是方法名称
 	response = stub.MockInvoke("uuid_002", [][]byte{[]byte("TestSmartContract:Unknow")})
-	log.Printf("response=%#v, response.Status=%d, response.Payload=%s", response, response.Status, byteToString(response.Payload))
+	log.Printf("response=%#v, response.Status=%d, response.Payload=%s", response, response.Status, string(response.Payload))
 	//invoke := ccc.Invoke(stub)
 	//log.Printf("response=%v", invoke)
 	stub.MockTransactionEnd("uuid_001")
@@ -333,3 +338,78 @@ func (t *TestSmartContract) UnknownTransaction(ctx contractapi.TransactionContex
 	log.Printf("hello, i'm Default func in TestSmartContract！")
 	return "i'm TestSmartContract, Bye!"
 }
+
+// ledgertest.Stub实现了MockStub未实现的方法，例如GetHistoryForKey和GetStateByRangeWithPagination
+func TestWithLedger(t *testing.T) {
+	assetChaincode, err := contractapi.NewChaincode(&SmartContract{})
+	require.NoError(t, err)
+	identity, err := ledgertest.NewIdentity(TestMSP, "user1")
+	require.NoError(t, err)
+	ledger := ledgertest.NewLedger("mychannel")
+	invoke := func(function string, args ...string) []byte {
+		result := ledger.Invoke(assetChaincode, ledgertest.Transaction{Identity: identity, Function: "Practice_SmartContract:" + function, Args: args})
+		require.Equal(t, int32(shim.OK), result.Response.Status, result.Response.Message)
+		return result.Response.Payload
+	}
+
+	invoke("InitLedger")
+	invoke("TransferAsset", AssetId, "Jin Soo")
+
+	stub := ledger.NewStub(ledgertest.Transaction{Identity: identity})
+	page, metadata, err := stub.GetStateByRangeWithPagination("", "", 4, "")
+	require.NoError(t, err)
+	require.NoError(t, page.Close())
+	require.Equal(t, int32(4), metadata.FetchedRecordsCount)
+	require.Equal(t, "asset5", metadata.Bookmark)
+	_, metadata, err = stub.GetStateByRangeWithPagination("", "", 4, metadata.Bookmark)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), metadata.FetchedRecordsCount)
+	require.Empty(t, metadata.Bookmark)
+
+	history, err := stub.GetHistoryForKey(AssetId)
+	require.NoError(t, err)
+	latest, err := history.Next()
+	require.NoError(t, err)
+	var asset Asset
+	require.NoError(t, json.Unmarshal(latest.Value, &asset))
+	require.Equal(t, "Jin Soo", asset.Owner)
+	require.True(t, history.HasNext())
+}
+
+// 日志中只有客户端的组织和客户端ID的哈希，没有证书、主题和属性值
+func TestLogsNoClientIdentity(t *testing.T) {
+	var buffer bytes.Buffer
+	logger.SetOutput(&buffer)
+	logger.SetLevel(logging.LevelDebug)
+	defer logger.SetLevel(logging.LevelFromEnv())
+	defer logger.SetOutput(os.Stderr)
+
+	assetChaincode, err := contractapi.NewChaincode(&SmartContract{})
+	require.NoError(t, err)
+	ca, err := ledgertest.NewCA(TestMSP)
+	require.NoError(t, err)
+	identity, err := ca.NewIdentity(ledgertest.IdentityOptions{CommonName: "secret-user", Attributes: map[string]string{"test": "hello"}})
+	require.NoError(t, err)
+	ledger := ledgertest.NewLedger("mychannel")
+	for _, function := range []string{"InitLedger", "ClientIdentityPractice", "SomeStubMethod"} {
+		args := []string{}
+		if function == "SomeStubMethod" {
+			args = append(args, AssetId)
+		}
+		result := ledger.Invoke(assetChaincode, ledgertest.Transaction{Identity: identity, Function: "Practice_SmartContract:" + function, Args: args})
+		require.Equal(t, int32(shim.OK), result.Response.Status, result.Response.Message)
+	}
+
+	clientIdentity, err := cid.New(ledger.NewStub(ledgertest.Transaction{Identity: identity}))
+	require.NoError(t, err)
+	ctx := new(contractapi.TransactionContext)
+	ctx.SetClientIdentity(clientIdentity)
+	mspID, clientID, err := clientLogIdentity(ctx)
+	require.NoError(t, err)
+
+	logs := buffer.String()
+	require.Contains(t, logs, mspID)
+	require.Contains(t, logs, clientID)
+	require.NotContains(t, logs, "secret-user")
+	require.NotContains(t, logs, "CERTIFICATE")
+}
@@ -1,41 +1,30 @@
 package main
 
-import (
-	"github.com/hyperledger/fabric-contract-api-go/contractapi"
-	"log"
-)
-
 // ClientIdentityPractice ClientIdentity接口提供的方法练习
-func (s *SmartContract) ClientIdentityPractice(ctx contractapi.TransactionContextInterface) error {
-	log.Println("ClientIdentityPractice==================start=====================")
+func (s *SmartContract) ClientIdentityPractice(ctx TransactionContextInterface) error {
+	logger := ctx.Logger()
+	logger.Debug("ClientIdentityPractice start")
 	clientIdentity := ctx.GetClientIdentity()
-	id, err := clientIdentity.GetID()
+	// 客户端ID和证书包含客户端的身份信息，只记录客户端ID的哈希
+	clientID, err := getClientOwnerID(ctx)
 	if err != nil {
 		return err
 	}
-	log.Printf("clientIdentity.GetID()=%s", id)
 	mspid, err := clientIdentity.GetMSPID()
 	if err != nil {
 		return err
 	}
-	log.Printf("clientIdentity.GetMSPID()=%s", mspid)
-	certificate, err := clientIdentity.GetX509Certificate()
+	logger.Debug("clientIdentity.GetMSPID()", "mspID", mspid, "clientID", clientID)
+	_, found, err := clientIdentity.GetAttributeValue("test")
 	if err != nil {
 		return err
 	}
-	log.Printf("clientIdentity.GetX509Certificate()=%#v", certificate)
-	value, found, err := clientIdentity.GetAttributeValue("test")
-	if err != nil {
-		return err
-	}
-	if found {
-		log.Printf("clientIdentity.GetAttributeValue(\"test\")=%s", value)
-	}
+	logger.Debug("clientIdentity.GetAttributeValue(\"test\")", "found", found)
 	if err := clientIdentity.AssertAttributeValue("test", "hello"); err != nil {
-		log.Printf("clientIdentity.AssertAttributeValue(\"test\", \"hello\") error!")
+		logger.Debug("clientIdentity.AssertAttributeValue(\"test\", \"hello\") error!")
 		return err
 	}
 
-	log.Println("ClientIdentityPractice===================end======================")
+	logger.Debug("ClientIdentityPractice end")
 	return nil
 }
@@ -0,0 +1,112 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package contracterror defines the structured errors every contract of the chaincode fails with, so
+// that clients branch on a stable code instead of parsing free text. Errors are returned to clients as
+// JSON in the message of the response:
+//
+//	{"code":"NOT_FOUND","function":"ReadAsset","message":"asset asset1 does not exist","messages":{"en":"asset asset1 does not exist","zh":"资产asset1不存在"}}
+//
+// Contracts keep a catalog of Messages and add the Structured middleware to their pipeline. Errors that
+// are not from a catalog are internal, their text is only logged.
+package contracterror
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/guozhe001/supply-finance-chaincode-go/middleware"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// Code identifies the kind of error a transaction failed with, clients branch on it.
+// Codes are part of the contracts' API and must not change.
+type Code string
+
+const (
+	NotFound        Code = "NOT_FOUND"        // the asset, price, key or record does not exist
+	AlreadyExists   Code = "ALREADY_EXISTS"   // the asset or record exists already
+	NotOwner        Code = "NOT_OWNER"        // the client does not own the asset
+	BadStatus       Code = "BAD_STATUS"       // the asset's or contract's status does not allow the transaction
+	HashMismatch    Code = "HASH_MISMATCH"    // the passed payload does not match its on-chain hash
+	BadSignature    Code = "BAD_SIGNATURE"    // a signature is malformed or does not verify
+	Expired         Code = "EXPIRED"          // the delegation the client relies on expired
+	Forbidden       Code = "FORBIDDEN"        // the client's role or org may not call the transaction
+	InvalidArgument Code = "INVALID_ARGUMENT" // an argument or transient payload is missing or invalid
+	Conflict        Code = "CONFLICT"         // the request conflicts with an earlier one
+	Paused          Code = "PAUSED"           // the contract is paused
+	Internal        Code = "INTERNAL"         // any other error, such as a failure to read the ledger
+)
+
+// Message is an entry of an error catalog, its messages take the same arguments in every language
+type Message struct {
+	Code Code
+	En   string
+	Zh   string
+}
+
+// New returns the error of the catalog entry formatted with args
+func (m Message) New(args ...interface{}) *Error {
+	message := fmt.Sprintf(m.En, args...)
+	return &Error{
+		Code:     m.Code,
+		Message:  message,
+		Messages: map[string]string{"en": message, "zh": fmt.Sprintf(m.Zh, args...)},
+	}
+}
+
+// internal is the error clients get for any error that is not from a catalog
+var internal = Message{Code: Internal, En: "internal error", Zh: "交易失败：内部错误"}
+
+// FieldError reports why a field of a payload is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is the error transactions fail with
+type Error struct {
+	Code     Code              `json:"code"`
+	Function string            `json:"function,omitempty"`
+	Message  string            `json:"message"`
+	Messages map[string]string `json:"messages"`
+	// Fields lists the invalid fields of a payload
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// Error returns the JSON of the error, which the contract API passes to the client unchanged
+func (e *Error) Error() string {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(e); err != nil {
+		return e.Message
+	}
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
+
+// Parse returns the contract error in an error message. Errors wrapped with fmt.Errorf embed the JSON of
+// the original error, which is what clients branch on; any other message is an internal error.
+func Parse(message string) *Error {
+	if i := strings.Index(message, `{"code":`); i >= 0 {
+		var contractError Error
+		if err := json.NewDecoder(strings.NewReader(message[i:])).Decode(&contractError); err == nil && contractError.Code != "" {
+			return &contractError
+		}
+	}
+	return internal.New()
+}
+
+// Structured returns every error of a contract as an Error naming the failed function. It should be the
+// first middleware of a pipeline, so that the error hooks of the others see the original error.
+var Structured = middleware.Middleware{
+	Name: "errors",
+	Error: func(_ shim.ChaincodeStubInterface, function string, err error) error {
+		contractError := Parse(err.Error())
+		contractError.Function = function
+		return contractError
+	},
+}
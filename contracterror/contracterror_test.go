@@ -0,0 +1,35 @@
+package contracterror
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errAssetNotFound = Message{Code: NotFound, En: "asset %s does not exist", Zh: "资产%s不存在"}
+
+func TestParse(t *testing.T) {
+	contractError := Parse(errAssetNotFound.New("asset1").Error())
+	require.Equal(t, NotFound, contractError.Code)
+	require.Equal(t, "asset asset1 does not exist", contractError.Message)
+	require.Equal(t, map[string]string{"en": "asset asset1 does not exist", "zh": "资产asset1不存在"}, contractError.Messages)
+
+	// wrapped errors keep the code of the original error
+	contractError = Parse(fmt.Errorf("failed to get asset: %v", errAssetNotFound.New("asset<1>")).Error())
+	require.Equal(t, NotFound, contractError.Code)
+	require.Equal(t, "asset asset<1> does not exist", contractError.Message)
+
+	// the text of any other error is not returned to clients
+	contractError = Parse("failed to read asset:\n  connection refused")
+	require.Equal(t, Internal, contractError.Code)
+	require.Equal(t, "internal error", contractError.Message)
+}
+
+func TestStructured(t *testing.T) {
+	err := Structured.Error(nil, "ReadAsset", errAssetNotFound.New("asset1"))
+	require.Equal(t, `{"code":"NOT_FOUND","function":"ReadAsset","message":"asset asset1 does not exist","messages":{"en":"asset asset1 does not exist","zh":"资产asset1不存在"}}`, err.Error())
+	err = Structured.Error(nil, "ReadAsset", errors.New("failed to read from world state"))
+	require.Equal(t, Internal, err.(*Error).Code)
+}
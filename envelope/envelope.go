@@ -0,0 +1,273 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package envelope encrypts event payloads to the registered public key of a recipient org,
+// so that private details such as an agreed price can travel on the public event stream.
+//
+// An envelope is sealed with ECIES over P-256: an ephemeral key pair is derived, the shared
+// secret with the recipient key is hashed into an AES-256-GCM key, and the payload is
+// encrypted with the event identity as additional data. Opening an envelope checks that it
+// was sealed to the given key and that it belongs to the event it was found in.
+package envelope
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Version is the version of the envelope format
+const Version = 1
+
+// Envelope is a payload encrypted to a single recipient org
+type Envelope struct {
+	Version      int    `json:"version"`
+	Recipient    string `json:"recipient"`
+	KeyID        string `json:"keyID"`
+	EphemeralKey string `json:"ephemeralKey"`
+	Nonce        string `json:"nonce"`
+	Ciphertext   string `json:"ciphertext"`
+}
+
+// AdditionalData binds an envelope to the event carrying it, so it cannot be replayed in another event
+func AdditionalData(eventType string, txID string, assetID string) []byte {
+	return []byte(fmt.Sprintf("%d\x00%s\x00%s\x00%s", Version, eventType, txID, assetID))
+}
+
+// KeyID returns the identifier of a public key, the hex encoded SHA-256 of its PKIX encoding
+func KeyID(pub *ecdsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %v", err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Seal encrypts payload to the recipient's public key. Randomness is read from rand; chaincode passes
+// a DeterministicReader so that every endorsing peer produces the same envelope.
+func Seal(rand io.Reader, recipient string, pub *ecdsa.PublicKey, payload []byte, additionalData []byte) (*Envelope, error) {
+	if pub == nil || pub.Curve != elliptic.P256() {
+		return nil, errors.New("recipient key must be a P-256 public key")
+	}
+	keyID, err := KeyID(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	curve := elliptic.P256()
+	scalar, err := randomScalar(rand, curve)
+	if err != nil {
+		return nil, err
+	}
+	ephemeralX, ephemeralY := curve.ScalarBaseMult(scalar)
+	ephemeralKey := elliptic.Marshal(curve, ephemeralX, ephemeralY)
+
+	sharedX, _ := curve.ScalarMult(pub.X, pub.Y, scalar)
+	aead, err := newAEAD(curve, sharedX, ephemeralKey, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand, nonce); err != nil {
+		return nil, fmt.Errorf("failed to read nonce: %v", err)
+	}
+
+	return &Envelope{
+		Version:      Version,
+		Recipient:    recipient,
+		KeyID:        keyID,
+		EphemeralKey: base64.StdEncoding.EncodeToString(ephemeralKey),
+		Nonce:        base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext:   base64.StdEncoding.EncodeToString(aead.Seal(nil, nonce, payload, additionalData)),
+	}, nil
+}
+
+// Open verifies and decrypts an envelope with the recipient's private key. It fails if the envelope was
+// sealed to another key, was tampered with, or was not sealed with the same additional data.
+func Open(priv *ecdsa.PrivateKey, envelope *Envelope, additionalData []byte) ([]byte, error) {
+	if envelope.Version != Version {
+		return nil, fmt.Errorf("unsupported envelope version %d", envelope.Version)
+	}
+	if priv == nil || priv.Curve != elliptic.P256() {
+		return nil, errors.New("recipient key must be a P-256 private key")
+	}
+	keyID, err := KeyID(&priv.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if keyID != envelope.KeyID {
+		return nil, fmt.Errorf("envelope for %s was sealed to key %s, not %s", envelope.Recipient, envelope.KeyID, keyID)
+	}
+
+	ephemeralKey, err := base64.StdEncoding.DecodeString(envelope.EphemeralKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ephemeral key: %v", err)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(envelope.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode nonce: %v", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(envelope.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ciphertext: %v", err)
+	}
+
+	curve := elliptic.P256()
+	ephemeralX, ephemeralY := elliptic.Unmarshal(curve, ephemeralKey)
+	if ephemeralX == nil {
+		return nil, errors.New("ephemeral key is not a valid P-256 point")
+	}
+	sharedX, _ := curve.ScalarMult(ephemeralX, ephemeralY, leftPad(priv.D.Bytes(), (curve.Params().BitSize+7)/8))
+	aead, err := newAEAD(curve, sharedX, ephemeralKey, keyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce length %d", len(nonce))
+	}
+
+	payload, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt envelope for %s: %v", envelope.Recipient, err)
+	}
+	return payload, nil
+}
+
+// ParsePublicKeyPEM parses a P-256 public key from a PEM encoded PUBLIC KEY or CERTIFICATE block
+func ParsePublicKeyPEM(pemBytes []byte) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err == nil {
+			key = cert.PublicKey
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %s", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", block.Type, err)
+	}
+
+	pub, ok := key.(*ecdsa.PublicKey)
+	if !ok || pub.Curve != elliptic.P256() {
+		return nil, errors.New("key is not a P-256 public key")
+	}
+	return pub, nil
+}
+
+// ParsePrivateKeyPEM parses a P-256 private key from a PEM encoded EC PRIVATE KEY or PKCS#8 PRIVATE KEY block
+func ParsePrivateKeyPEM(pemBytes []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %s", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", block.Type, err)
+	}
+
+	priv, ok := key.(*ecdsa.PrivateKey)
+	if !ok || priv.Curve != elliptic.P256() {
+		return nil, errors.New("key is not a P-256 private key")
+	}
+	return priv, nil
+}
+
+// DeterministicReader returns an endless stream of pseudo random bytes expanded from seed with SHA-256
+// in counter mode. The stream is only as unpredictable as the seed, which must contain secret entropy.
+func DeterministicReader(seed []byte) io.Reader {
+	return &deterministicReader{seed: append([]byte(nil), seed...)}
+}
+
+type deterministicReader struct {
+	seed    []byte
+	counter uint64
+	buffer  bytes.Buffer
+}
+
+func (r *deterministicReader) Read(p []byte) (int, error) {
+	for r.buffer.Len() < len(p) {
+		var counter [8]byte
+		binary.BigEndian.PutUint64(counter[:], r.counter)
+		block := sha256.New()
+		block.Write(r.seed)
+		block.Write(counter[:])
+		r.buffer.Write(block.Sum(nil))
+		r.counter++
+	}
+	return r.buffer.Read(p)
+}
+
+// randomScalar reads a scalar in [1, N-1] from rand
+func randomScalar(rand io.Reader, curve elliptic.Curve) ([]byte, error) {
+	params := curve.Params()
+	buf := make([]byte, params.BitSize/8+8)
+	if _, err := io.ReadFull(rand, buf); err != nil {
+		return nil, fmt.Errorf("failed to read ephemeral key: %v", err)
+	}
+	k := new(big.Int).SetBytes(buf)
+	n := new(big.Int).Sub(params.N, big.NewInt(1))
+	k.Mod(k, n)
+	k.Add(k, big.NewInt(1))
+
+	return leftPad(k.Bytes(), (params.BitSize+7)/8), nil
+}
+
+// newAEAD derives the AES-256-GCM key from the ECDH shared secret and the public values of the exchange
+func newAEAD(curve elliptic.Curve, sharedX *big.Int, ephemeralKey []byte, keyID string) (cipher.AEAD, error) {
+	kdf := sha256.New()
+	kdf.Write(leftPad(sharedX.Bytes(), (curve.Params().BitSize+7)/8))
+	kdf.Write(ephemeralKey)
+	kdf.Write([]byte(keyID))
+
+	block, err := aes.NewCipher(kdf.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// leftPad returns b left padded with zeros to size bytes
+func leftPad(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
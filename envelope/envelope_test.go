@@ -0,0 +1,70 @@
+package envelope
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealOpen(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	payload := []byte(`{"asset_id":"asset1","price":100,"trade_id":"t1"}`)
+	aad := AdditionalData("AssetListed", "tx1", "asset1")
+
+	sealed, err := Seal(DeterministicReader([]byte("entropy")), "Org2MSP", &priv.PublicKey, payload, aad)
+	require.NoError(t, err)
+	require.NotContains(t, sealed.Ciphertext, "price")
+
+	// every endorser derives the same envelope from the same seed
+	again, err := Seal(DeterministicReader([]byte("entropy")), "Org2MSP", &priv.PublicKey, payload, aad)
+	require.NoError(t, err)
+	require.Equal(t, sealed, again)
+
+	opened, err := Open(priv, sealed, aad)
+	require.NoError(t, err)
+	require.Equal(t, payload, opened)
+
+	_, err = Open(other, sealed, aad)
+	require.Error(t, err)
+	_, err = Open(priv, sealed, AdditionalData("AssetListed", "tx2", "asset1"))
+	require.Error(t, err)
+
+	ciphertext, err := base64.StdEncoding.DecodeString(sealed.Ciphertext)
+	require.NoError(t, err)
+	ciphertext[0] ^= 0xff
+	tampered := *sealed
+	tampered.Ciphertext = base64.StdEncoding.EncodeToString(ciphertext)
+	_, err = Open(priv, &tampered, aad)
+	require.Error(t, err)
+}
+
+func TestParseKeysPEM(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	pubDER, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	require.NoError(t, err)
+	pub, err := ParsePublicKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+	require.NoError(t, err)
+	require.Equal(t, priv.PublicKey.X, pub.X)
+	require.Equal(t, priv.PublicKey.Y, pub.Y)
+
+	privDER, err := x509.MarshalECPrivateKey(priv)
+	require.NoError(t, err)
+	parsed, err := ParsePrivateKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privDER}))
+	require.NoError(t, err)
+	require.Equal(t, priv.D, parsed.D)
+
+	_, err = ParsePublicKeyPEM([]byte("not a key"))
+	require.Error(t, err)
+}
@@ -0,0 +1,129 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package events defines the chaincode events emitted by the supply finance contract.
+// Every business transaction emits exactly one event whose name is the event type and
+// whose payload is a JSON encoded AssetEvent. Payloads only carry public asset data,
+// never private properties or prices, so off-chain systems can consume them freely.
+package events
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/guozhe001/supply-finance-chaincode-go/envelope"
+)
+
+// Version is the version of the event payload schema. It is increased whenever a field
+// changes meaning or is removed; adding optional fields does not change the version.
+const Version = 1
+
+// Event types, also used as the chaincode event name
+const (
+	AssetCreated             = "AssetCreated"
+	AssetSplit               = "AssetSplit"
+	AssetListed              = "AssetListed"
+	AssetBid                 = "AssetBid"
+	AssetTransferred         = "AssetTransferred"
+	AssetDescriptionChanged  = "AssetDescriptionChanged"
+	AssetOwnerAssigned       = "AssetOwnerAssigned"
+	AssetPledgeOffered       = "AssetPledgeOffered"
+	AssetPledged             = "AssetPledged"
+	AssetGuaranteeOffered    = "AssetGuaranteeOffered"
+	AssetGuaranteeAccepted   = "AssetGuaranteeAccepted"
+	AssetGuaranteed          = "AssetGuaranteed"
+	AssetReleased            = "AssetReleased"
+	AssetAttested            = "AssetAttested"
+	AssetPropertiesEncrypted = "AssetPropertiesEncrypted"
+)
+
+// Types lists every event type the contract emits
+var Types = []string{
+	AssetCreated,
+	AssetSplit,
+	AssetListed,
+	AssetBid,
+	AssetTransferred,
+	AssetDescriptionChanged,
+	AssetOwnerAssigned,
+	AssetPledgeOffered,
+	AssetPledged,
+	AssetGuaranteeOffered,
+	AssetGuaranteeAccepted,
+	AssetGuaranteed,
+	AssetReleased,
+	AssetAttested,
+	AssetPropertiesEncrypted,
+}
+
+// AssetEvent is the payload of every asset event
+type AssetEvent struct {
+	Version   int       `json:"version"`
+	Type      string    `json:"type"`
+	TxID      string    `json:"txID"`
+	Timestamp time.Time `json:"timestamp"`
+	ActingMSP string    `json:"actingMSP"`
+	// OnBehalfOf is the owner org when the acting org acts through a delegation
+	OnBehalfOf        string   `json:"onBehalfOf,omitempty"`
+	AssetID           string   `json:"assetID"`
+	OwnerOrg          string   `json:"ownerOrg"`
+	OwnerID           string   `json:"ownerID,omitempty"`
+	FinancierOrg      string   `json:"financierOrg,omitempty"`
+	GuarantorOrgs     []string `json:"guarantorOrgs,omitempty"`
+	PreviousOwnerOrg  string   `json:"previousOwnerOrg,omitempty"`
+	Status            string   `json:"status"`
+	ParentID          string   `json:"parentID,omitempty"`
+	IssuerOrg         string   `json:"issuerOrg,omitempty"`
+	PublicDescription string   `json:"publicDescription,omitempty"`
+	ChildIDs          []string `json:"childIDs,omitempty"`
+	// Envelopes carry private details, such as the agreed price, encrypted to individual counterparty orgs
+	Envelopes []envelope.Envelope `json:"envelopes,omitempty"`
+}
+
+// IsKnownType reports whether eventType is one of the event types emitted by the contract
+func IsKnownType(eventType string) bool {
+	for _, t := range Types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Unmarshal parses the payload of a chaincode event with the given name.
+// It fails for unknown event names, payloads of a newer schema version and payloads whose type
+// does not match the event name.
+func Unmarshal(eventName string, payload []byte) (*AssetEvent, error) {
+	if !IsKnownType(eventName) {
+		return nil, fmt.Errorf("unknown event %s", eventName)
+	}
+	var event AssetEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s event: %v", eventName, err)
+	}
+	if event.Version > Version {
+		return nil, fmt.Errorf("unsupported %s event version %d, latest known version is %d", eventName, event.Version, Version)
+	}
+	if event.Type != eventName {
+		return nil, fmt.Errorf("event %s carries a payload of type %s", eventName, event.Type)
+	}
+	return &event, nil
+}
+
+// AdditionalData returns the additional data that binds the envelopes of the event to it
+func (e *AssetEvent) AdditionalData() []byte {
+	return envelope.AdditionalData(e.Type, e.TxID, e.AssetID)
+}
+
+// OpenEnvelope decrypts and verifies the private payload the event carries for the recipient org
+func (e *AssetEvent) OpenEnvelope(recipient string, priv *ecdsa.PrivateKey) ([]byte, error) {
+	for i := range e.Envelopes {
+		if e.Envelopes[i].Recipient == recipient {
+			return envelope.Open(priv, &e.Envelopes[i], e.AdditionalData())
+		}
+	}
+	return nil, fmt.Errorf("%s event %s carries no envelope for %s", e.Type, e.TxID, recipient)
+}
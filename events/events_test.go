@@ -0,0 +1,66 @@
+package events
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/guozhe001/supply-finance-chaincode-go/envelope"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnmarshal(t *testing.T) {
+	event := AssetEvent{
+		Version:   Version,
+		Type:      AssetTransferred,
+		TxID:      "tx1",
+		Timestamp: time.Date(2021, 1, 25, 8, 6, 32, 0, time.UTC),
+		ActingMSP: "Org1MSP",
+		AssetID:   "asset1",
+		OwnerOrg:  "Org2MSP",
+		Status:    "enable",
+	}
+	payload, err := json.Marshal(event)
+	require.NoError(t, err)
+
+	parsed, err := Unmarshal(AssetTransferred, payload)
+	require.NoError(t, err)
+	require.Equal(t, event, *parsed)
+
+	_, err = Unmarshal(AssetCreated, payload)
+	require.Error(t, err)
+	_, err = Unmarshal("hello event", payload)
+	require.Error(t, err)
+
+	event.Version = Version + 1
+	payload, err = json.Marshal(event)
+	require.NoError(t, err)
+	_, err = Unmarshal(AssetTransferred, payload)
+	require.Error(t, err)
+}
+
+func TestOpenEnvelope(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	event := AssetEvent{Version: Version, Type: AssetListed, TxID: "tx1", AssetID: "asset1"}
+	price := []byte(`{"asset_id":"asset1","price":100,"trade_id":"t1"}`)
+	sealed, err := envelope.Seal(rand.Reader, "Org2MSP", &priv.PublicKey, price, event.AdditionalData())
+	require.NoError(t, err)
+	event.Envelopes = append(event.Envelopes, *sealed)
+
+	opened, err := event.OpenEnvelope("Org2MSP", priv)
+	require.NoError(t, err)
+	require.Equal(t, price, opened)
+
+	_, err = event.OpenEnvelope("Org3MSP", priv)
+	require.Error(t, err)
+
+	// an envelope copied into another event does not open
+	event.TxID = "tx2"
+	_, err = event.OpenEnvelope("Org2MSP", priv)
+	require.Error(t, err)
+}
@@ -1,4 +1,5 @@
 module github.com/guozhe001/supply-finance-chaincode-go
+
 go 1.14
 
 require (
@@ -6,5 +7,6 @@ require (
 	github.com/hyperledger/fabric-chaincode-go v0.0.0-20201119163726-f8ef75b17719
 	github.com/hyperledger/fabric-contract-api-go v1.1.0
 	github.com/hyperledger/fabric-protos-go v0.0.0-20200424173316-dd554ba3746e
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/stretchr/testify v1.5.1
 )
@@ -0,0 +1,170 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package indexer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// ChaincodeEvent is a chaincode event of a valid transaction together with its position in the ledger
+type ChaincodeEvent struct {
+	BlockNumber uint64
+	TxIndex     int
+	TxID        string
+	ChaincodeID string
+	EventName   string
+	Payload     []byte
+}
+
+// EventsFromBlock extracts the chaincode events of the named chaincode from the valid transactions of a block.
+// Transactions the committing peer marked invalid are skipped, their events never took effect.
+func EventsFromBlock(block *common.Block, chaincodeName string) ([]ChaincodeEvent, error) {
+	if block.GetHeader() == nil || block.GetData() == nil {
+		return nil, errors.New("block has no header or data")
+	}
+
+	var txFilter []byte
+	if metadata := block.GetMetadata().GetMetadata(); len(metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		txFilter = metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+
+	var chaincodeEvents []ChaincodeEvent
+	for txIndex, envelopeBytes := range block.GetData().GetData() {
+		if txIndex < len(txFilter) && peer.TxValidationCode(txFilter[txIndex]) != peer.TxValidationCode_VALID {
+			continue
+		}
+
+		event, txID, err := chaincodeEventFromEnvelope(envelopeBytes)
+		if err != nil {
+			return nil, fmt.Errorf("block %d tx %d: %v", block.GetHeader().GetNumber(), txIndex, err)
+		}
+		if event == nil || event.GetEventName() == "" || event.GetChaincodeId() != chaincodeName {
+			continue
+		}
+
+		chaincodeEvents = append(chaincodeEvents, ChaincodeEvent{
+			BlockNumber: block.GetHeader().GetNumber(),
+			TxIndex:     txIndex,
+			TxID:        txID,
+			ChaincodeID: event.GetChaincodeId(),
+			EventName:   event.GetEventName(),
+			Payload:     event.GetPayload(),
+		})
+	}
+	return chaincodeEvents, nil
+}
+
+// chaincodeEventFromEnvelope unpacks the chaincode event of an endorser transaction, if any
+func chaincodeEventFromEnvelope(envelopeBytes []byte) (*peer.ChaincodeEvent, string, error) {
+	envelope := &common.Envelope{}
+	if err := proto.Unmarshal(envelopeBytes, envelope); err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal envelope: %v", err)
+	}
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(envelope.GetPayload(), payload); err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal payload: %v", err)
+	}
+	channelHeader := &common.ChannelHeader{}
+	if err := proto.Unmarshal(payload.GetHeader().GetChannelHeader(), channelHeader); err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal channel header: %v", err)
+	}
+	if common.HeaderType(channelHeader.GetType()) != common.HeaderType_ENDORSER_TRANSACTION {
+		return nil, channelHeader.GetTxId(), nil
+	}
+
+	transaction := &peer.Transaction{}
+	if err := proto.Unmarshal(payload.GetData(), transaction); err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal transaction: %v", err)
+	}
+	for _, action := range transaction.GetActions() {
+		actionPayload := &peer.ChaincodeActionPayload{}
+		if err := proto.Unmarshal(action.GetPayload(), actionPayload); err != nil {
+			return nil, "", fmt.Errorf("failed to unmarshal chaincode action payload: %v", err)
+		}
+		responsePayload := &peer.ProposalResponsePayload{}
+		if err := proto.Unmarshal(actionPayload.GetAction().GetProposalResponsePayload(), responsePayload); err != nil {
+			return nil, "", fmt.Errorf("failed to unmarshal proposal response payload: %v", err)
+		}
+		chaincodeAction := &peer.ChaincodeAction{}
+		if err := proto.Unmarshal(responsePayload.GetExtension(), chaincodeAction); err != nil {
+			return nil, "", fmt.Errorf("failed to unmarshal chaincode action: %v", err)
+		}
+		if len(chaincodeAction.GetEvents()) == 0 {
+			continue
+		}
+		event := &peer.ChaincodeEvent{}
+		if err := proto.Unmarshal(chaincodeAction.GetEvents(), event); err != nil {
+			return nil, "", fmt.Errorf("failed to unmarshal chaincode event: %v", err)
+		}
+		return event, channelHeader.GetTxId(), nil
+	}
+	return nil, channelHeader.GetTxId(), nil
+}
+
+// ReadBlocks reads a stream of blocks, each a marshaled common.Block prefixed with its length as an
+// unsigned varint. A single block saved by `peer channel fetch` is read by ReadBlock instead.
+func ReadBlocks(r io.Reader) ([]*common.Block, error) {
+	reader := bufio.NewReader(r)
+	var blocks []*common.Block
+	for {
+		size, err := binary.ReadUvarint(reader)
+		if err == io.EOF {
+			return blocks, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read block length: %v", err)
+		}
+		blockBytes := make([]byte, size)
+		if _, err := io.ReadFull(reader, blockBytes); err != nil {
+			return nil, fmt.Errorf("failed to read block: %v", err)
+		}
+		block := &common.Block{}
+		if err := proto.Unmarshal(blockBytes, block); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+}
+
+// ReadBlock reads a single marshaled common.Block, as written by `peer channel fetch`
+func ReadBlock(r io.Reader) (*common.Block, error) {
+	blockBytes, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block: %v", err)
+	}
+	block := &common.Block{}
+	if err := proto.Unmarshal(blockBytes, block); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal block: %v", err)
+	}
+	return block, nil
+}
+
+// WriteBlocks writes blocks in the format read by ReadBlocks, e.g. to record fixtures
+func WriteBlocks(w io.Writer, blocks ...*common.Block) error {
+	for _, block := range blocks {
+		blockBytes, err := proto.Marshal(block)
+		if err != nil {
+			return fmt.Errorf("failed to marshal block: %v", err)
+		}
+		size := make([]byte, binary.MaxVarintLen64)
+		n := binary.PutUvarint(size, uint64(len(blockBytes)))
+		if _, err := w.Write(size[:n]); err != nil {
+			return err
+		}
+		if _, err := w.Write(blockBytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
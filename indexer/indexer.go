@@ -0,0 +1,332 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package indexer keeps an off-chain mirror of the supply finance assets in an embedded SQLite store.
+//
+// It consumes the events the contract emits, either as delivered by a chaincode event listener or
+// extracted from blocks, and maintains the public state, status and split lineage of every asset.
+// Events are applied at most once: duplicates are recognised by transaction ID, an event older than
+// the last one applied to an asset never overwrites it, and the position of the newest event is kept
+// as a checkpoint so that a restarted consumer can resume from it.
+package indexer
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/guozhe001/supply-finance-chaincode-go/events"
+	"github.com/hyperledger/fabric-protos-go/common"
+
+	// register the sqlite3 database/sql driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS assets (
+	asset_id           TEXT PRIMARY KEY,
+	owner_org          TEXT NOT NULL,
+	status             TEXT NOT NULL,
+	parent_id          TEXT NOT NULL DEFAULT '',
+	issuer_org         TEXT NOT NULL DEFAULT '',
+	public_description TEXT NOT NULL DEFAULT '',
+	block_number       INTEGER NOT NULL,
+	tx_index           INTEGER NOT NULL,
+	tx_id              TEXT NOT NULL,
+	updated_at         TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS assets_owner_org ON assets (owner_org);
+CREATE INDEX IF NOT EXISTS assets_status ON assets (status);
+CREATE TABLE IF NOT EXISTS lineage (
+	parent_id TEXT NOT NULL,
+	child_id  TEXT NOT NULL,
+	PRIMARY KEY (parent_id, child_id)
+);
+CREATE INDEX IF NOT EXISTS lineage_child_id ON lineage (child_id);
+CREATE TABLE IF NOT EXISTS events (
+	tx_id        TEXT PRIMARY KEY,
+	block_number INTEGER NOT NULL,
+	tx_index     INTEGER NOT NULL,
+	event_name   TEXT NOT NULL,
+	payload      BLOB NOT NULL
+);
+CREATE TABLE IF NOT EXISTS checkpoint (
+	id           INTEGER PRIMARY KEY CHECK (id = 1),
+	block_number INTEGER NOT NULL,
+	tx_index     INTEGER NOT NULL
+);
+`
+
+// Position is the place of a transaction in the ledger
+type Position struct {
+	BlockNumber uint64
+	TxIndex     int
+}
+
+// Asset is the mirrored public state of an asset
+type Asset struct {
+	ID                string
+	OwnerOrg          string
+	Status            string
+	ParentID          string
+	IssuerOrg         string
+	PublicDescription string
+	Position          Position
+	TxID              string
+	UpdatedAt         time.Time
+}
+
+// Indexer applies contract events to the SQLite mirror
+type Indexer struct {
+	db            *sql.DB
+	chaincodeName string
+}
+
+// Open opens or creates the SQLite store at path and indexes the events of the named chaincode.
+// Use ":memory:" for a throw-away store.
+func Open(path string, chaincodeName string) (*Indexer, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	// SQLite allows a single writer, and every connection to ":memory:" is a separate database
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create schema: %v", err)
+	}
+	return &Indexer{db: db, chaincodeName: chaincodeName}, nil
+}
+
+// Close closes the store
+func (ix *Indexer) Close() error {
+	return ix.db.Close()
+}
+
+// Checkpoint returns the position of the newest event applied, and false if no event was applied yet.
+// A restarted consumer resumes delivery from the checkpoint block; events it sees again are skipped.
+func (ix *Indexer) Checkpoint() (Position, bool, error) {
+	var position Position
+	err := ix.db.QueryRow(`SELECT block_number, tx_index FROM checkpoint WHERE id = 1`).Scan(&position.BlockNumber, &position.TxIndex)
+	if err == sql.ErrNoRows {
+		return Position{}, false, nil
+	}
+	if err != nil {
+		return Position{}, false, fmt.Errorf("failed to read checkpoint: %v", err)
+	}
+	return position, true, nil
+}
+
+// HandleBlock applies the events of a block and returns how many were applied
+func (ix *Indexer) HandleBlock(block *common.Block) (int, error) {
+	chaincodeEvents, err := EventsFromBlock(block, ix.chaincodeName)
+	if err != nil {
+		return 0, err
+	}
+	applied := 0
+	for _, event := range chaincodeEvents {
+		ok, err := ix.HandleEvent(event)
+		if err != nil {
+			return applied, err
+		}
+		if ok {
+			applied++
+		}
+	}
+	return applied, nil
+}
+
+// HandleEvent applies a single chaincode event and reports whether it was new.
+// Events of other chaincodes and event names the contract does not emit are ignored.
+func (ix *Indexer) HandleEvent(chaincodeEvent ChaincodeEvent) (bool, error) {
+	if chaincodeEvent.ChaincodeID != ix.chaincodeName || !events.IsKnownType(chaincodeEvent.EventName) {
+		return false, nil
+	}
+	event, err := events.Unmarshal(chaincodeEvent.EventName, chaincodeEvent.Payload)
+	if err != nil {
+		return false, err
+	}
+	position := Position{BlockNumber: chaincodeEvent.BlockNumber, TxIndex: chaincodeEvent.TxIndex}
+
+	tx, err := ix.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT OR IGNORE INTO events (tx_id, block_number, tx_index, event_name, payload) VALUES (?, ?, ?, ?, ?)`,
+		chaincodeEvent.TxID, position.BlockNumber, position.TxIndex, chaincodeEvent.EventName, chaincodeEvent.Payload)
+	if err != nil {
+		return false, fmt.Errorf("failed to record event %s: %v", chaincodeEvent.TxID, err)
+	}
+	if inserted, err := result.RowsAffected(); err != nil || inserted == 0 {
+		// duplicate delivery of an event already applied
+		return false, err
+	}
+
+	if err := applyEvent(tx, event, position); err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(`INSERT INTO checkpoint (id, block_number, tx_index) VALUES (1, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET block_number = excluded.block_number, tx_index = excluded.tx_index
+		WHERE excluded.block_number > checkpoint.block_number
+		   OR (excluded.block_number = checkpoint.block_number AND excluded.tx_index > checkpoint.tx_index)`,
+		position.BlockNumber, position.TxIndex)
+	if err != nil {
+		return false, fmt.Errorf("failed to update checkpoint: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit event %s: %v", chaincodeEvent.TxID, err)
+	}
+	return true, nil
+}
+
+// applyEvent mirrors the public state carried by an event. An event older than the one last applied to
+// an asset leaves the asset untouched, so events delivered out of order cannot roll state back.
+func applyEvent(tx *sql.Tx, event *events.AssetEvent, position Position) error {
+	err := upsertAsset(tx, Asset{
+		ID:                event.AssetID,
+		OwnerOrg:          event.OwnerOrg,
+		Status:            event.Status,
+		ParentID:          event.ParentID,
+		IssuerOrg:         event.IssuerOrg,
+		PublicDescription: event.PublicDescription,
+		Position:          position,
+		TxID:              event.TxID,
+		UpdatedAt:         event.Timestamp,
+	})
+	if err != nil {
+		return err
+	}
+	if event.ParentID != "" {
+		if err := insertLineage(tx, event.ParentID, event.AssetID); err != nil {
+			return err
+		}
+	}
+
+	// A split emits a single event for the original asset, its children are created with the same owner and issuer
+	for _, childID := range event.ChildIDs {
+		err := upsertAsset(tx, Asset{
+			ID:        childID,
+			OwnerOrg:  event.OwnerOrg,
+			Status:    "enable",
+			ParentID:  event.AssetID,
+			IssuerOrg: event.IssuerOrg,
+			Position:  position,
+			TxID:      event.TxID,
+			UpdatedAt: event.Timestamp,
+		})
+		if err != nil {
+			return err
+		}
+		if err := insertLineage(tx, event.AssetID, childID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func upsertAsset(tx *sql.Tx, asset Asset) error {
+	_, err := tx.Exec(`INSERT INTO assets (asset_id, owner_org, status, parent_id, issuer_org, public_description, block_number, tx_index, tx_id, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (asset_id) DO UPDATE SET
+			owner_org = excluded.owner_org,
+			status = excluded.status,
+			parent_id = excluded.parent_id,
+			issuer_org = excluded.issuer_org,
+			public_description = excluded.public_description,
+			block_number = excluded.block_number,
+			tx_index = excluded.tx_index,
+			tx_id = excluded.tx_id,
+			updated_at = excluded.updated_at
+		WHERE excluded.block_number > assets.block_number
+		   OR (excluded.block_number = assets.block_number AND excluded.tx_index > assets.tx_index)`,
+		asset.ID, asset.OwnerOrg, asset.Status, asset.ParentID, asset.IssuerOrg, asset.PublicDescription,
+		asset.Position.BlockNumber, asset.Position.TxIndex, asset.TxID, asset.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to upsert asset %s: %v", asset.ID, err)
+	}
+	return nil
+}
+
+func insertLineage(tx *sql.Tx, parentID string, childID string) error {
+	_, err := tx.Exec(`INSERT OR IGNORE INTO lineage (parent_id, child_id) VALUES (?, ?)`, parentID, childID)
+	if err != nil {
+		return fmt.Errorf("failed to record lineage %s -> %s: %v", parentID, childID, err)
+	}
+	return nil
+}
+
+const assetColumns = `asset_id, owner_org, status, parent_id, issuer_org, public_description, block_number, tx_index, tx_id, updated_at`
+
+// Asset returns the mirrored asset, or nil if no event for it was applied
+func (ix *Indexer) Asset(assetID string) (*Asset, error) {
+	assets, err := ix.queryAssets(`SELECT `+assetColumns+` FROM assets WHERE asset_id = ?`, assetID)
+	if err != nil || len(assets) == 0 {
+		return nil, err
+	}
+	return assets[0], nil
+}
+
+// AssetsByOwner returns the assets currently owned by an org
+func (ix *Indexer) AssetsByOwner(ownerOrg string) ([]*Asset, error) {
+	return ix.queryAssets(`SELECT `+assetColumns+` FROM assets WHERE owner_org = ? ORDER BY asset_id`, ownerOrg)
+}
+
+// AssetsByStatus returns the assets with the given status
+func (ix *Indexer) AssetsByStatus(status string) ([]*Asset, error) {
+	return ix.queryAssets(`SELECT `+assetColumns+` FROM assets WHERE status = ? ORDER BY asset_id`, status)
+}
+
+// Children returns the assets split directly from an asset
+func (ix *Indexer) Children(parentID string) ([]*Asset, error) {
+	return ix.queryAssets(`SELECT `+assetColumns+` FROM assets
+		WHERE asset_id IN (SELECT child_id FROM lineage WHERE parent_id = ?) ORDER BY asset_id`, parentID)
+}
+
+// Ancestors returns the IDs of the assets an asset was split from, nearest first
+func (ix *Indexer) Ancestors(assetID string) ([]string, error) {
+	rows, err := ix.db.Query(`WITH RECURSIVE ancestors (asset_id, depth) AS (
+			SELECT parent_id, 1 FROM lineage WHERE child_id = ?
+			UNION
+			SELECT lineage.parent_id, ancestors.depth + 1 FROM lineage JOIN ancestors ON lineage.child_id = ancestors.asset_id
+		)
+		SELECT asset_id FROM ancestors ORDER BY depth`, assetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ancestors of %s: %v", assetID, err)
+	}
+	defer rows.Close()
+
+	var ancestors []string
+	for rows.Next() {
+		var ancestor string
+		if err := rows.Scan(&ancestor); err != nil {
+			return nil, err
+		}
+		ancestors = append(ancestors, ancestor)
+	}
+	return ancestors, rows.Err()
+}
+
+func (ix *Indexer) queryAssets(query string, args ...interface{}) ([]*Asset, error) {
+	rows, err := ix.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query assets: %v", err)
+	}
+	defer rows.Close()
+
+	var assets []*Asset
+	for rows.Next() {
+		var asset Asset
+		err := rows.Scan(&asset.ID, &asset.OwnerOrg, &asset.Status, &asset.ParentID, &asset.IssuerOrg, &asset.PublicDescription,
+			&asset.Position.BlockNumber, &asset.Position.TxIndex, &asset.TxID, &asset.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, &asset)
+	}
+	return assets, rows.Err()
+}
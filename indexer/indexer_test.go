@@ -0,0 +1,237 @@
+package indexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/guozhe001/supply-finance-chaincode-go/events"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite the recorded block fixtures in testdata")
+
+const (
+	chaincodeName = "secured_supply"
+	blocksFixture = "testdata/blocks.bin"
+)
+
+// testTx is a transaction of a fixture block
+type testTx struct {
+	txID      string
+	chaincode string
+	event     *events.AssetEvent
+	invalid   bool
+}
+
+func newTestEvent(eventType string, txID string, assetID string, ownerOrg string, status string) *events.AssetEvent {
+	return &events.AssetEvent{
+		Version:   events.Version,
+		Type:      eventType,
+		TxID:      txID,
+		Timestamp: time.Date(2021, 1, 25, 8, 0, 0, 0, time.UTC),
+		ActingMSP: ownerOrg,
+		AssetID:   assetID,
+		OwnerOrg:  ownerOrg,
+		Status:    status,
+		IssuerOrg: "Org1MSP",
+	}
+}
+
+// newTestBlock builds a block of endorser transactions the way the orderer and committing peer would
+func newTestBlock(t *testing.T, number uint64, txs ...testTx) *common.Block {
+	block := &common.Block{
+		Header:   &common.BlockHeader{Number: number},
+		Data:     &common.BlockData{},
+		Metadata: &common.BlockMetadata{Metadata: make([][]byte, len(common.BlockMetadataIndex_name))},
+	}
+	txFilter := make([]byte, len(txs))
+	for i, tx := range txs {
+		if tx.invalid {
+			txFilter[i] = byte(peer.TxValidationCode_MVCC_READ_CONFLICT)
+		}
+
+		payload, err := json.Marshal(tx.event)
+		require.NoError(t, err)
+		chaincodeEvent := marshalProto(t, &peer.ChaincodeEvent{ChaincodeId: tx.chaincode, TxId: tx.txID, EventName: tx.event.Type, Payload: payload})
+		chaincodeAction := marshalProto(t, &peer.ChaincodeAction{Events: chaincodeEvent})
+		responsePayload := marshalProto(t, &peer.ProposalResponsePayload{Extension: chaincodeAction})
+		actionPayload := marshalProto(t, &peer.ChaincodeActionPayload{Action: &peer.ChaincodeEndorsedAction{ProposalResponsePayload: responsePayload}})
+		transaction := marshalProto(t, &peer.Transaction{Actions: []*peer.TransactionAction{{Payload: actionPayload}}})
+		channelHeader := marshalProto(t, &common.ChannelHeader{Type: int32(common.HeaderType_ENDORSER_TRANSACTION), TxId: tx.txID})
+		envelopePayload := marshalProto(t, &common.Payload{Header: &common.Header{ChannelHeader: channelHeader}, Data: transaction})
+		block.Data.Data = append(block.Data.Data, marshalProto(t, &common.Envelope{Payload: envelopePayload}))
+	}
+	block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = txFilter
+	return block
+}
+
+func marshalProto(t *testing.T, message proto.Message) []byte {
+	bytes, err := proto.Marshal(message)
+	require.NoError(t, err)
+	return bytes
+}
+
+// fixtureBlocks is the scenario recorded in testdata: asset1 is created, listed, transferred and split
+func fixtureBlocks(t *testing.T) []*common.Block {
+	invalidChange := newTestEvent(events.AssetDescriptionChanged, "tx-invalid", "asset1", "Org1MSP", "enable")
+	invalidChange.PublicDescription = "never committed"
+	transferred := newTestEvent(events.AssetTransferred, "tx-transfer", "asset1", "Org2MSP", "enable")
+	transferred.PreviousOwnerOrg = "Org1MSP"
+	split := newTestEvent(events.AssetSplit, "tx-split", "asset1", "Org2MSP", "delete")
+	split.ChildIDs = []string{"asset11", "asset12"}
+
+	return []*common.Block{
+		newTestBlock(t, 1,
+			testTx{txID: "tx-create", chaincode: chaincodeName, event: newTestEvent(events.AssetCreated, "tx-create", "asset1", "Org1MSP", "enable")},
+			testTx{txID: "tx-invalid", chaincode: chaincodeName, event: invalidChange, invalid: true},
+		),
+		newTestBlock(t, 2,
+			testTx{txID: "tx-list", chaincode: chaincodeName, event: newTestEvent(events.AssetListed, "tx-list", "asset1", "Org1MSP", "enable")},
+			testTx{txID: "tx-other", chaincode: "other", event: newTestEvent(events.AssetCreated, "tx-other", "asset9", "Org3MSP", "enable")},
+		),
+		newTestBlock(t, 3,
+			testTx{txID: "tx-transfer", chaincode: chaincodeName, event: transferred},
+		),
+		newTestBlock(t, 4,
+			testTx{txID: "tx-split", chaincode: chaincodeName, event: split},
+		),
+	}
+}
+
+func readFixture(t *testing.T) []*common.Block {
+	if *update {
+		var buffer bytes.Buffer
+		require.NoError(t, WriteBlocks(&buffer, fixtureBlocks(t)...))
+		require.NoError(t, ioutil.WriteFile(blocksFixture, buffer.Bytes(), 0644))
+	}
+	file, err := os.Open(blocksFixture)
+	require.NoError(t, err)
+	defer file.Close()
+	blocks, err := ReadBlocks(file)
+	require.NoError(t, err)
+	require.Len(t, blocks, 4)
+	return blocks
+}
+
+func TestRecordedBlocks(t *testing.T) {
+	blocks := readFixture(t)
+	ix, err := Open(":memory:", chaincodeName)
+	require.NoError(t, err)
+	defer ix.Close()
+
+	applied := 0
+	for _, block := range blocks {
+		n, err := ix.HandleBlock(block)
+		require.NoError(t, err)
+		applied += n
+	}
+	require.Equal(t, 4, applied)
+
+	asset, err := ix.Asset("asset1")
+	require.NoError(t, err)
+	require.Equal(t, "Org2MSP", asset.OwnerOrg)
+	require.Equal(t, "delete", asset.Status)
+	require.Equal(t, Position{BlockNumber: 4}, asset.Position)
+	require.NotEqual(t, "never committed", asset.PublicDescription)
+
+	other, err := ix.Asset("asset9")
+	require.NoError(t, err)
+	require.Nil(t, other)
+
+	children, err := ix.Children("asset1")
+	require.NoError(t, err)
+	require.Len(t, children, 2)
+	require.Equal(t, "asset11", children[0].ID)
+	require.Equal(t, "Org2MSP", children[0].OwnerOrg)
+
+	owned, err := ix.AssetsByOwner("Org2MSP")
+	require.NoError(t, err)
+	require.Len(t, owned, 3)
+	enabled, err := ix.AssetsByStatus("enable")
+	require.NoError(t, err)
+	require.Len(t, enabled, 2)
+
+	ancestors, err := ix.Ancestors("asset12")
+	require.NoError(t, err)
+	require.Equal(t, []string{"asset1"}, ancestors)
+
+	checkpoint, ok, err := ix.Checkpoint()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, Position{BlockNumber: 4}, checkpoint)
+
+	// redelivered blocks are duplicates
+	for _, block := range blocks {
+		n, err := ix.HandleBlock(block)
+		require.NoError(t, err)
+		require.Zero(t, n)
+	}
+}
+
+func TestResumeFromCheckpoint(t *testing.T) {
+	blocks := readFixture(t)
+	dir, err := ioutil.TempDir("", "indexer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "assets.db")
+
+	ix, err := Open(path, chaincodeName)
+	require.NoError(t, err)
+	for _, block := range blocks[:2] {
+		_, err := ix.HandleBlock(block)
+		require.NoError(t, err)
+	}
+	require.NoError(t, ix.Close())
+
+	ix, err = Open(path, chaincodeName)
+	require.NoError(t, err)
+	defer ix.Close()
+	checkpoint, ok, err := ix.Checkpoint()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(2), checkpoint.BlockNumber)
+
+	// delivery restarts at the checkpoint block, which is partly seen already
+	applied := 0
+	for _, block := range blocks[checkpoint.BlockNumber-1:] {
+		n, err := ix.HandleBlock(block)
+		require.NoError(t, err)
+		applied += n
+	}
+	require.Equal(t, 2, applied)
+
+	asset, err := ix.Asset("asset1")
+	require.NoError(t, err)
+	require.Equal(t, "delete", asset.Status)
+}
+
+func TestOutOfOrderEvents(t *testing.T) {
+	blocks := readFixture(t)
+	ix, err := Open(":memory:", chaincodeName)
+	require.NoError(t, err)
+	defer ix.Close()
+
+	for _, i := range []int{0, 2, 1} {
+		_, err := ix.HandleBlock(blocks[i])
+		require.NoError(t, err)
+	}
+
+	// the listing in block 2 arrived after the transfer in block 3 and must not roll the owner back
+	asset, err := ix.Asset("asset1")
+	require.NoError(t, err)
+	require.Equal(t, "Org2MSP", asset.OwnerOrg)
+	require.Equal(t, "tx-transfer", asset.TxID)
+
+	checkpoint, _, err := ix.Checkpoint()
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), checkpoint.BlockNumber)
+}
@@ -0,0 +1,179 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package ledgertest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Node OU roles of the Fabric MSP, carried in the organizational unit of a certificate
+const (
+	RoleClient  = "client"
+	RolePeer    = "peer"
+	RoleAdmin   = "admin"
+	RoleOrderer = "orderer"
+)
+
+// attributesOID is the certificate extension in which Fabric CA stores the attributes of an identity,
+// it is the extension read by cid.GetAttributeValue
+var attributesOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+// CA is a certificate authority of an MSP that issues client identities for tests
+type CA struct {
+	MSPID          string
+	Certificate    *x509.Certificate
+	CertificatePEM []byte
+	PrivateKey     *ecdsa.PrivateKey
+}
+
+// IdentityOptions describe an identity issued by a CA
+type IdentityOptions struct {
+	// CommonName defaults to "user1"
+	CommonName string
+	// Role is the node OU of the identity, it defaults to RoleClient
+	Role string
+	// Attributes are added to the certificate the same way Fabric CA does. The hf.EnrollmentID and
+	// hf.Type attributes default to the common name and the role.
+	Attributes map[string]string
+	// NotBefore and NotAfter default to an hour ago and a day from now
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// NewCA creates a self-signed ECDSA root CA of the given MSP
+func NewCA(mspID string) (*CA, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: "ca." + mspID, Organization: []string{mspID}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA certificate: %v", err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %v", err)
+	}
+
+	return &CA{
+		MSPID:          mspID,
+		Certificate:    certificate,
+		CertificatePEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		PrivateKey:     privateKey,
+	}, nil
+}
+
+// NewIdentity issues an ECDSA identity of the CA's MSP
+func (ca *CA) NewIdentity(options IdentityOptions) (*Identity, error) {
+	commonName := options.CommonName
+	if commonName == "" {
+		commonName = "user1"
+	}
+	role := options.Role
+	if role == "" {
+		role = RoleClient
+	}
+	notBefore, notAfter := options.NotBefore, options.NotAfter
+	if notBefore.IsZero() {
+		notBefore = time.Now().Add(-time.Hour)
+	}
+	if notAfter.IsZero() {
+		notAfter = time.Now().Add(24 * time.Hour)
+	}
+
+	attributes := map[string]string{"hf.EnrollmentID": commonName, "hf.Type": role}
+	for name, value := range options.Attributes {
+		attributes[name] = value
+	}
+	attributesJSON, err := json.Marshal(map[string]interface{}{"attrs": attributes})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal attributes: %v", err)
+	}
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName:         commonName,
+			Organization:       []string{ca.MSPID},
+			OrganizationalUnit: []string{role},
+		},
+		NotBefore:       notBefore,
+		NotAfter:        notAfter,
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtraExtensions: []pkix.Extension{{Id: attributesOID, Value: attributesJSON}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Certificate, &privateKey.PublicKey, ca.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %v", err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %v", err)
+	}
+
+	return &Identity{
+		MSPID:          ca.MSPID,
+		Role:           role,
+		Attributes:     attributes,
+		Certificate:    certificate,
+		CertificatePEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		PrivateKey:     privateKey,
+	}, nil
+}
+
+// Verify checks that an identity was issued by the CA
+func (ca *CA) Verify(identity *Identity) error {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Certificate)
+	_, err := identity.Certificate.Verify(x509.VerifyOptions{
+		Roots:       roots,
+		CurrentTime: identity.Certificate.NotBefore,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("identity %s was not issued by %s: %v", identity.Certificate.Subject.CommonName, ca.MSPID, err)
+	}
+	return nil
+}
+
+func newSerialNumber() (*big.Int, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+	return serialNumber, nil
+}
@@ -0,0 +1,44 @@
+package ledgertest
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCAIssuesIdentitiesWithAttributes(t *testing.T) {
+	ca, err := NewCA("Org1MSP")
+	require.NoError(t, err)
+	identity, err := ca.NewIdentity(IdentityOptions{
+		CommonName: "trader1",
+		Attributes: map[string]string{"role": "trader"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, ca.Verify(identity))
+
+	other, err := NewCA("Org1MSP")
+	require.NoError(t, err)
+	require.Error(t, other.Verify(identity))
+
+	clientIdentity, err := cid.New(NewLedger("mychannel").NewStub(Transaction{Identity: identity}))
+	require.NoError(t, err)
+	mspID, err := clientIdentity.GetMSPID()
+	require.NoError(t, err)
+	require.Equal(t, "Org1MSP", mspID)
+	id, err := clientIdentity.GetID()
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
+	require.NoError(t, clientIdentity.AssertAttributeValue("role", "trader"))
+	require.NoError(t, clientIdentity.AssertAttributeValue("hf.EnrollmentID", "trader1"))
+	require.NoError(t, clientIdentity.AssertAttributeValue("hf.Type", RoleClient))
+	_, found, err := clientIdentity.GetAttributeValue("missing")
+	require.NoError(t, err)
+	require.False(t, found)
+
+	admin, err := ca.NewIdentity(IdentityOptions{CommonName: "admin", Role: RoleAdmin})
+	require.NoError(t, err)
+	isAdmin, err := cid.HasOUValue(NewLedger("mychannel").NewStub(Transaction{Identity: admin}), RoleAdmin)
+	require.NoError(t, err)
+	require.True(t, isAdmin)
+}
@@ -0,0 +1,43 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package ledgertest
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/msp"
+)
+
+// Identity is a client identity of an MSP that submits transactions
+type Identity struct {
+	MSPID          string
+	Role           string
+	Attributes     map[string]string
+	Certificate    *x509.Certificate
+	CertificatePEM []byte
+	PrivateKey     *ecdsa.PrivateKey
+}
+
+// NewIdentity creates a client identity of the given MSP, issued by a new CA of that MSP.
+// Use a CA directly for roles, attributes or several identities of the same MSP.
+func NewIdentity(mspID string, commonName string) (*Identity, error) {
+	ca, err := NewCA(mspID)
+	if err != nil {
+		return nil, err
+	}
+	return ca.NewIdentity(IdentityOptions{CommonName: commonName})
+}
+
+// Creator returns the serialized identity that the stub reports as the transaction creator
+func (id *Identity) Creator() ([]byte, error) {
+	creator, err := proto.Marshal(&msp.SerializedIdentity{Mspid: id.MSPID, IdBytes: id.CertificatePEM})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal serialized identity: %v", err)
+	}
+	return creator, nil
+}
@@ -0,0 +1,59 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package ledgertest
+
+import (
+	"errors"
+
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+)
+
+// stateIterator implements shim.StateQueryIteratorInterface over a snapshot of results
+type stateIterator struct {
+	results []*queryresult.KV
+	closed  bool
+}
+
+func (it *stateIterator) HasNext() bool {
+	return !it.closed && len(it.results) > 0
+}
+
+func (it *stateIterator) Next() (*queryresult.KV, error) {
+	if !it.HasNext() {
+		return nil, errors.New("no more results")
+	}
+	next := it.results[0]
+	it.results = it.results[1:]
+	return next, nil
+}
+
+func (it *stateIterator) Close() error {
+	it.closed = true
+	return nil
+}
+
+// historyIterator implements shim.HistoryQueryIteratorInterface over a snapshot of modifications
+type historyIterator struct {
+	results []*queryresult.KeyModification
+	closed  bool
+}
+
+func (it *historyIterator) HasNext() bool {
+	return !it.closed && len(it.results) > 0
+}
+
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+	if !it.HasNext() {
+		return nil, errors.New("no more results")
+	}
+	next := it.results[0]
+	it.results = it.results[1:]
+	return next, nil
+}
+
+func (it *historyIterator) Close() error {
+	it.closed = true
+	return nil
+}
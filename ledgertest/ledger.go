@@ -0,0 +1,302 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package ledgertest provides an in-memory ledger and a full shim.ChaincodeStubInterface for contract tests.
+//
+// Unlike shimtest.MockStub, the stub supports private data collections and their hashes, key history,
+// transient data, state-based endorsement parameters, rich queries and pagination, and reports a
+// configurable client identity and peer MSP. Each transaction runs against the committed state only,
+// like on a real peer: writes are buffered and become visible once the transaction is committed.
+package ledgertest
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// implicitCollectionPrefix is the name prefix of the implicit private data collection of an org
+const implicitCollectionPrefix = "_implicit_org_"
+
+// peerMSPIDEnv is the environment variable shim.GetMSPID reads the peer's MSP from
+const peerMSPIDEnv = "CORE_PEER_LOCALMSPID"
+
+// Ledger is the committed state of a channel for a single chaincode namespace
+type Ledger struct {
+	channelID   string
+	state       map[string][]byte
+	stateEP     map[string][]byte
+	history     map[string][]*queryresult.KeyModification
+	private     map[string]map[string][]byte
+	privateHash map[string]map[string][]byte
+	privateEP   map[string]map[string][]byte
+	collections map[string][]string
+	events      []*CommittedEvent
+	blockNumber uint64
+	clock       time.Time
+	txCount     int
+}
+
+// CommittedEvent is a chaincode event of a committed transaction
+type CommittedEvent struct {
+	BlockNumber uint64
+	TxID        string
+	Event       *peer.ChaincodeEvent
+}
+
+// Transaction describes a transaction proposal
+type Transaction struct {
+	// Identity is the client submitting the transaction
+	Identity *Identity
+	// PeerMSPID is the MSP of the endorsing peer, it defaults to the MSP of the client
+	PeerMSPID string
+	Function  string
+	Args      []string
+	Transient map[string][]byte
+}
+
+// Result is the outcome of a transaction
+type Result struct {
+	TxID      string
+	Response  peer.Response
+	Event     *peer.ChaincodeEvent
+	Committed bool
+	// Stub is the stub the transaction ran against, holding its read and write sets
+	Stub *Stub
+}
+
+// NewLedger creates an empty ledger for the given channel
+func NewLedger(channelID string) *Ledger {
+	return &Ledger{
+		channelID:   channelID,
+		state:       make(map[string][]byte),
+		stateEP:     make(map[string][]byte),
+		history:     make(map[string][]*queryresult.KeyModification),
+		private:     make(map[string]map[string][]byte),
+		privateHash: make(map[string]map[string][]byte),
+		privateEP:   make(map[string]map[string][]byte),
+		collections: make(map[string][]string),
+		clock:       time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// AddCollection defines an explicit private data collection and the MSPs of the peers that are members of it.
+// Every org is implicitly a member of its own implicit collection.
+func (l *Ledger) AddCollection(name string, memberMSPIDs ...string) {
+	l.collections[name] = memberMSPIDs
+}
+
+// IsMember reports whether peers of the MSP store the private data of the collection
+func (l *Ledger) IsMember(collection string, mspID string) bool {
+	if strings.HasPrefix(collection, implicitCollectionPrefix) {
+		return collection == implicitCollectionPrefix+mspID
+	}
+	for _, member := range l.collections[collection] {
+		if member == mspID {
+			return true
+		}
+	}
+	return false
+}
+
+// SetClock sets the timestamp of the next transaction. Every transaction advances the clock by a second.
+func (l *Ledger) SetClock(t time.Time) {
+	l.clock = t
+}
+
+// Clock returns the timestamp of the next transaction
+func (l *Ledger) Clock() time.Time {
+	return l.clock
+}
+
+// State returns the committed value of a public key
+func (l *Ledger) State(key string) []byte {
+	return l.state[key]
+}
+
+// StateValidationParameter returns the committed state-based endorsement policy of a public key
+func (l *Ledger) StateValidationParameter(key string) []byte {
+	return l.stateEP[key]
+}
+
+// PrivateData returns the committed value of a private key
+func (l *Ledger) PrivateData(collection string, key string) []byte {
+	return l.private[collection][key]
+}
+
+// PrivateDataHash returns the hash of the committed value of a private key
+func (l *Ledger) PrivateDataHash(collection string, key string) []byte {
+	return l.privateHash[collection][key]
+}
+
+// Events returns the events of all committed transactions, oldest first
+func (l *Ledger) Events() []*CommittedEvent {
+	return l.events
+}
+
+// BlockNumber returns the number of the last committed block. Every committed transaction is cut into its own block.
+func (l *Ledger) BlockNumber() uint64 {
+	return l.blockNumber
+}
+
+// PutState seeds the committed public state outside of any chaincode transaction
+func (l *Ledger) PutState(key string, value []byte) {
+	stub := l.NewStub(Transaction{})
+	stub.PutState(key, value)
+	l.Commit(stub)
+}
+
+// NewStub creates the stub of a new transaction against the committed state
+func (l *Ledger) NewStub(tx Transaction) *Stub {
+	txID, timestamp := l.nextTx()
+	return l.newStub(tx, txID, timestamp)
+}
+
+// nextTx allocates the ID and timestamp of a new transaction
+func (l *Ledger) nextTx() (string, *timestamp.Timestamp) {
+	l.txCount++
+	txID := sha256.Sum256([]byte(fmt.Sprintf("%s/%d", l.channelID, l.txCount)))
+	txTimestamp, _ := ptypes.TimestampProto(l.clock)
+	l.clock = l.clock.Add(time.Second)
+	return fmt.Sprintf("%x", txID), txTimestamp
+}
+
+// newStub creates a stub for a proposal. Every endorsing peer of a proposal gets its own stub with the same ID and timestamp.
+func (l *Ledger) newStub(tx Transaction, txID string, txTimestamp *timestamp.Timestamp) *Stub {
+	args := [][]byte{[]byte(tx.Function)}
+	for _, arg := range tx.Args {
+		args = append(args, []byte(arg))
+	}
+	peerMSPID := tx.PeerMSPID
+	if peerMSPID == "" && tx.Identity != nil {
+		peerMSPID = tx.Identity.MSPID
+	}
+
+	return &Stub{
+		ledger:        l,
+		txID:          txID,
+		timestamp:     txTimestamp,
+		args:          args,
+		transient:     tx.Transient,
+		identity:      tx.Identity,
+		peerMSPID:     peerMSPID,
+		writes:        make(map[string]*write),
+		privateWrites: make(map[string]map[string]*write),
+		stateEP:       make(map[string][]byte),
+		privateEP:     make(map[string]map[string][]byte),
+	}
+}
+
+// Invoke runs a transaction and commits its writes if the chaincode returned a successful response
+func (l *Ledger) Invoke(cc shim.Chaincode, tx Transaction) *Result {
+	result := l.Evaluate(cc, tx)
+	if result.Response.Status < shim.ERRORTHRESHOLD {
+		l.Commit(result.Stub)
+		result.Committed = true
+	}
+	return result
+}
+
+// Evaluate runs a transaction without committing it, like a query
+func (l *Ledger) Evaluate(cc shim.Chaincode, tx Transaction) *Result {
+	return execute(cc, l.NewStub(tx))
+}
+
+// execute runs the chaincode against a stub on behalf of the stub's peer
+func execute(cc shim.Chaincode, stub *Stub) *Result {
+	restore := setPeerMSPID(stub.peerMSPID)
+	defer restore()
+
+	response := cc.Invoke(stub)
+	return &Result{
+		TxID:     stub.txID,
+		Response: response,
+		Event:    stub.event,
+		Stub:     stub,
+	}
+}
+
+// Commit applies the write set of a transaction in a new block
+func (l *Ledger) Commit(stub *Stub) {
+	l.blockNumber++
+
+	for _, key := range sortedKeys(stub.writes) {
+		w := stub.writes[key]
+		if w.isDelete {
+			delete(l.state, key)
+			delete(l.stateEP, key)
+		} else {
+			l.state[key] = w.value
+		}
+		l.history[key] = append(l.history[key], &queryresult.KeyModification{
+			TxId:      stub.txID,
+			Value:     w.value,
+			Timestamp: stub.timestamp,
+			IsDelete:  w.isDelete,
+		})
+	}
+	for key, ep := range stub.stateEP {
+		l.stateEP[key] = ep
+	}
+
+	for collection, writes := range stub.privateWrites {
+		if l.private[collection] == nil {
+			l.private[collection] = make(map[string][]byte)
+			l.privateHash[collection] = make(map[string][]byte)
+		}
+		for key, w := range writes {
+			if w.isDelete {
+				delete(l.private[collection], key)
+				delete(l.privateHash[collection], key)
+				continue
+			}
+			hash := sha256.Sum256(w.value)
+			l.private[collection][key] = w.value
+			l.privateHash[collection][key] = hash[:]
+		}
+	}
+	for collection, eps := range stub.privateEP {
+		if l.privateEP[collection] == nil {
+			l.privateEP[collection] = make(map[string][]byte)
+		}
+		for key, ep := range eps {
+			l.privateEP[collection][key] = ep
+		}
+	}
+
+	if stub.event != nil {
+		l.events = append(l.events, &CommittedEvent{BlockNumber: l.blockNumber, TxID: stub.txID, Event: stub.event})
+	}
+}
+
+// setPeerMSPID sets the MSP that shim.GetMSPID reports for the duration of a transaction
+func setPeerMSPID(mspID string) func() {
+	previous, ok := os.LookupEnv(peerMSPIDEnv)
+	os.Setenv(peerMSPIDEnv, mspID)
+	return func() {
+		if ok {
+			os.Setenv(peerMSPIDEnv, previous)
+		} else {
+			os.Unsetenv(peerMSPIDEnv)
+		}
+	}
+}
+
+func sortedKeys(writes map[string]*write) []string {
+	keys := make([]string, 0, len(writes))
+	for key := range writes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,116 @@
+package ledgertest
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStubReadsCommittedState(t *testing.T) {
+	ledger := NewLedger("mychannel")
+	ledger.PutState("asset1", []byte(`{"ID":"asset1"}`))
+
+	stub := ledger.NewStub(Transaction{})
+	require.NoError(t, stub.PutState("asset2", []byte(`{"ID":"asset2"}`)))
+	require.NoError(t, stub.DelState("asset1"))
+	// writes are not visible before the transaction commits
+	value, err := stub.GetState("asset2")
+	require.NoError(t, err)
+	require.Nil(t, value)
+	value, err = stub.GetState("asset1")
+	require.NoError(t, err)
+	require.NotNil(t, value)
+
+	ledger.Commit(stub)
+	require.Nil(t, ledger.State("asset1"))
+	require.NotNil(t, ledger.State("asset2"))
+
+	history, err := ledger.NewStub(Transaction{}).GetHistoryForKey("asset1")
+	require.NoError(t, err)
+	latest, err := history.Next()
+	require.NoError(t, err)
+	require.True(t, latest.IsDelete)
+	first, err := history.Next()
+	require.NoError(t, err)
+	require.False(t, first.IsDelete)
+	require.False(t, history.HasNext())
+}
+
+func TestStubQueries(t *testing.T) {
+	ledger := NewLedger("mychannel")
+	stub := ledger.NewStub(Transaction{})
+	for _, id := range []string{"asset1", "asset2", "asset3"} {
+		require.NoError(t, stub.PutState(id, []byte(`{"objectType":"asset","ownerOrg":"Org1MSP","assetID":"`+id+`"}`)))
+		indexKey, err := stub.CreateCompositeKey("owner~asset", []string{"Org1MSP", id})
+		require.NoError(t, err)
+		require.NoError(t, stub.PutState(indexKey, []byte{0x00}))
+	}
+	ledger.Commit(stub)
+	stub = ledger.NewStub(Transaction{})
+
+	// simple range queries never return composite keys
+	page, metadata, err := stub.GetStateByRangeWithPagination("", "", 2, "")
+	require.NoError(t, err)
+	require.Equal(t, int32(2), metadata.FetchedRecordsCount)
+	require.Equal(t, "asset3", metadata.Bookmark)
+	first, err := page.Next()
+	require.NoError(t, err)
+	require.Equal(t, "asset1", first.Key)
+
+	page, metadata, err = stub.GetStateByRangeWithPagination("", "", 2, metadata.Bookmark)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), metadata.FetchedRecordsCount)
+	require.Empty(t, metadata.Bookmark)
+
+	indexed, err := stub.GetStateByPartialCompositeKey("owner~asset", []string{"Org1MSP"})
+	require.NoError(t, err)
+	entry, err := indexed.Next()
+	require.NoError(t, err)
+	objectType, attributes, err := stub.SplitCompositeKey(entry.Key)
+	require.NoError(t, err)
+	require.Equal(t, "owner~asset", objectType)
+	require.Equal(t, []string{"Org1MSP", "asset1"}, attributes)
+
+	rich, err := stub.GetQueryResult(`{"selector":{"objectType":"asset","assetID":{"$eq":"asset2"}}}`)
+	require.NoError(t, err)
+	match, err := rich.Next()
+	require.NoError(t, err)
+	require.Equal(t, "asset2", match.Key)
+	require.False(t, rich.HasNext())
+}
+
+func TestStubPrivateDataAndIdentity(t *testing.T) {
+	identity, err := NewIdentity("Org1MSP", "user1")
+	require.NoError(t, err)
+	ledger := NewLedger("mychannel")
+
+	stub := ledger.NewStub(Transaction{Identity: identity, Transient: map[string][]byte{"asset_properties": []byte("secret")}})
+	require.Equal(t, "Org1MSP", stub.PeerMSPID())
+	transient, err := stub.GetTransient()
+	require.NoError(t, err)
+	require.NoError(t, stub.PutPrivateData("_implicit_org_Org1MSP", "asset1", transient["asset_properties"]))
+	ledger.Commit(stub)
+
+	mspID, err := cid.GetMSPID(stub)
+	require.NoError(t, err)
+	require.Equal(t, "Org1MSP", mspID)
+
+	hash := sha256.Sum256([]byte("secret"))
+	stub = ledger.NewStub(Transaction{Identity: identity, PeerMSPID: "Org2MSP"})
+	onChainHash, err := stub.GetPrivateDataHash("_implicit_org_Org1MSP", "asset1")
+	require.NoError(t, err)
+	require.Equal(t, hash[:], onChainHash)
+	// a peer of another org does not hold the private data
+	_, err = stub.GetPrivateData("_implicit_org_Org1MSP", "asset1")
+	require.Error(t, err)
+
+	stub = ledger.NewStub(Transaction{Identity: identity})
+	value, err := stub.GetPrivateData("_implicit_org_Org1MSP", "asset1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("secret"), value)
+	require.NoError(t, stub.DelPrivateData("_implicit_org_Org1MSP", "asset1"))
+	ledger.Commit(stub)
+	require.Nil(t, ledger.PrivateDataHash("_implicit_org_Org1MSP", "asset1"))
+}
@@ -0,0 +1,217 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package ledgertest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// Network simulates the orgs of a channel. Every org has a client identity, an endorsing peer and its
+// implicit private data collection. Transactions are endorsed by running the chaincode on the peer of
+// each endorsing org, with that org as the peer MSP, so the contract's own client-org/peer-org checks
+// apply. Endorsements must agree and satisfy the state-based endorsement policy of every key written
+// before the transaction is committed.
+type Network struct {
+	Ledger    *Ledger
+	chaincode shim.Chaincode
+	cas       map[string]*CA
+	clients   map[string]*Identity
+	orgs      []string
+}
+
+// Proposal is a transaction proposal submitted to the network
+type Proposal struct {
+	// Org is the MSP of the submitting client
+	Org string
+	// Identity optionally replaces the default client of the org
+	Identity *Identity
+	// Endorsers are the MSPs of the peers asked to endorse, they default to the client's org
+	Endorsers []string
+	Function  string
+	Args      []string
+	Transient map[string][]byte
+}
+
+// NewNetwork creates a network of the given orgs running the chaincode on a new ledger
+func NewNetwork(cc shim.Chaincode, mspIDs ...string) (*Network, error) {
+	network := &Network{
+		Ledger:    NewLedger("mychannel"),
+		chaincode: cc,
+		cas:       make(map[string]*CA),
+		clients:   make(map[string]*Identity),
+	}
+	for _, mspID := range mspIDs {
+		ca, err := NewCA(mspID)
+		if err != nil {
+			return nil, err
+		}
+		client, err := ca.NewIdentity(IdentityOptions{})
+		if err != nil {
+			return nil, err
+		}
+		network.cas[mspID] = ca
+		network.clients[mspID] = client
+		network.orgs = append(network.orgs, mspID)
+	}
+	return network, nil
+}
+
+// Orgs returns the MSPs of the orgs of the network
+func (n *Network) Orgs() []string {
+	return n.orgs
+}
+
+// CA returns the certificate authority of an org, to issue identities with other roles or attributes
+func (n *Network) CA(mspID string) *CA {
+	return n.cas[mspID]
+}
+
+// Client returns the default client identity of an org
+func (n *Network) Client(mspID string) *Identity {
+	return n.clients[mspID]
+}
+
+// SetClient replaces the default client identity of the identity's org
+func (n *Network) SetClient(identity *Identity) {
+	n.clients[identity.MSPID] = identity
+}
+
+// Submit endorses a proposal on the peers of its endorsing orgs, validates it and commits it.
+// The result is returned even when the transaction fails, together with the reason.
+func (n *Network) Submit(p Proposal) (*Result, error) {
+	tx, endorsers, err := n.transaction(p)
+	if err != nil {
+		return nil, err
+	}
+
+	txID, txTimestamp := n.Ledger.nextTx()
+	var endorsed *Result
+	for _, endorser := range endorsers {
+		tx.PeerMSPID = endorser
+		result := execute(n.chaincode, n.Ledger.newStub(tx, txID, txTimestamp))
+		if result.Response.Status >= shim.ERRORTHRESHOLD {
+			return result, fmt.Errorf("endorsement by %s peer failed: %s", endorser, result.Response.Message)
+		}
+		if endorsed == nil {
+			endorsed = result
+			continue
+		}
+		if err := compareEndorsements(endorsed, result); err != nil {
+			return result, fmt.Errorf("endorsements of %s and %s peers do not match: %v", endorsers[0], endorser, err)
+		}
+	}
+
+	if err := n.validate(endorsed.Stub, endorsers); err != nil {
+		return endorsed, err
+	}
+	n.Ledger.Commit(endorsed.Stub)
+	endorsed.Committed = true
+	return endorsed, nil
+}
+
+// Evaluate runs a proposal on the peer of its first endorsing org without committing it, like a query
+func (n *Network) Evaluate(p Proposal) (*Result, error) {
+	tx, endorsers, err := n.transaction(p)
+	if err != nil {
+		return nil, err
+	}
+	tx.PeerMSPID = endorsers[0]
+	result := n.Ledger.Evaluate(n.chaincode, tx)
+	if result.Response.Status >= shim.ERRORTHRESHOLD {
+		return result, fmt.Errorf("evaluation by %s peer failed: %s", endorsers[0], result.Response.Message)
+	}
+	return result, nil
+}
+
+func (n *Network) transaction(p Proposal) (Transaction, []string, error) {
+	identity := p.Identity
+	if identity == nil {
+		identity = n.clients[p.Org]
+	}
+	if identity == nil {
+		return Transaction{}, nil, fmt.Errorf("unknown org %s", p.Org)
+	}
+	endorsers := p.Endorsers
+	if len(endorsers) == 0 {
+		endorsers = []string{identity.MSPID}
+	}
+	for _, endorser := range endorsers {
+		if _, ok := n.clients[endorser]; !ok {
+			return Transaction{}, nil, fmt.Errorf("unknown endorsing org %s", endorser)
+		}
+	}
+	return Transaction{Identity: identity, Function: p.Function, Args: p.Args, Transient: p.Transient}, endorsers, nil
+}
+
+// validate checks the endorsements against the state-based endorsement policies of the keys written,
+// as the committing peers do. Keys without a policy fall back to the chaincode policy, which any single
+// org satisfies in this network.
+func (n *Network) validate(stub *Stub, endorsers []string) error {
+	for _, key := range sortedKeys(stub.writes) {
+		policy := n.Ledger.StateValidationParameter(key)
+		if policy == nil {
+			continue
+		}
+		ok, err := SatisfiesPolicy(policy, endorsers)
+		if err != nil {
+			return fmt.Errorf("invalid endorsement policy of key %q: %v", key, err)
+		}
+		if !ok {
+			return fmt.Errorf("endorsement policy failure for key %q endorsed by %s", key, strings.Join(endorsers, ", "))
+		}
+	}
+	return nil
+}
+
+// compareEndorsements checks that two peers produced the same response, event and read-write set.
+// Private writes are compared by hash, as peers that are not members of a collection only see hashes.
+func compareEndorsements(a, b *Result) error {
+	if a.Response.Status != b.Response.Status || !bytes.Equal(a.Response.Payload, b.Response.Payload) {
+		return errors.New("responses differ")
+	}
+	if !proto.Equal(a.Stub.eventOrEmpty(), b.Stub.eventOrEmpty()) {
+		return errors.New("events differ")
+	}
+	if !sameWrites(a.Stub.writes, b.Stub.writes) {
+		return errors.New("public writes differ")
+	}
+	if len(a.Stub.privateWrites) != len(b.Stub.privateWrites) {
+		return errors.New("private writes differ")
+	}
+	for collection, writes := range a.Stub.privateWrites {
+		if !sameWrites(writes, b.Stub.privateWrites[collection]) {
+			return fmt.Errorf("private writes to %s differ", collection)
+		}
+	}
+	if len(a.Stub.stateEP) != len(b.Stub.stateEP) {
+		return errors.New("endorsement policies differ")
+	}
+	for key, ep := range a.Stub.stateEP {
+		if !bytes.Equal(ep, b.Stub.stateEP[key]) {
+			return fmt.Errorf("endorsement policies of key %q differ", key)
+		}
+	}
+	return nil
+}
+
+func sameWrites(a, b map[string]*write) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, w := range a {
+		other, ok := b[key]
+		if !ok || w.isDelete != other.isDelete || sha256.Sum256(w.value) != sha256.Sum256(other.value) {
+			return false
+		}
+	}
+	return true
+}
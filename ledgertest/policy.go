@@ -0,0 +1,68 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package ledgertest
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/msp"
+)
+
+// SatisfiesPolicy reports whether endorsements from peers of the given MSPs satisfy a marshaled
+// SignaturePolicyEnvelope, such as a state-based endorsement policy. Every peer signs as a member
+// and as a peer of its MSP.
+func SatisfiesPolicy(policy []byte, endorserMSPIDs []string) (bool, error) {
+	envelope := &common.SignaturePolicyEnvelope{}
+	if err := proto.Unmarshal(policy, envelope); err != nil {
+		return false, fmt.Errorf("failed to unmarshal signature policy: %v", err)
+	}
+
+	principals := make([]string, len(envelope.GetIdentities()))
+	for i, identity := range envelope.GetIdentities() {
+		if identity.GetPrincipalClassification() != msp.MSPPrincipal_ROLE {
+			return false, fmt.Errorf("unsupported principal classification %s", identity.GetPrincipalClassification())
+		}
+		role := &msp.MSPRole{}
+		if err := proto.Unmarshal(identity.GetPrincipal(), role); err != nil {
+			return false, fmt.Errorf("failed to unmarshal MSP role: %v", err)
+		}
+		if role.GetRole() != msp.MSPRole_MEMBER && role.GetRole() != msp.MSPRole_PEER {
+			return false, fmt.Errorf("unsupported MSP role %s", role.GetRole())
+		}
+		principals[i] = role.GetMspIdentifier()
+	}
+
+	endorsers := make(map[string]bool, len(endorserMSPIDs))
+	for _, mspID := range endorserMSPIDs {
+		endorsers[mspID] = true
+	}
+	return evaluateRule(envelope.GetRule(), principals, endorsers)
+}
+
+func evaluateRule(rule *common.SignaturePolicy, principals []string, endorsers map[string]bool) (bool, error) {
+	switch t := rule.GetType().(type) {
+	case *common.SignaturePolicy_SignedBy:
+		if int(t.SignedBy) >= len(principals) || t.SignedBy < 0 {
+			return false, fmt.Errorf("signature policy refers to unknown identity %d", t.SignedBy)
+		}
+		return endorsers[principals[t.SignedBy]], nil
+	case *common.SignaturePolicy_NOutOf_:
+		satisfied := int32(0)
+		for _, subRule := range t.NOutOf.GetRules() {
+			ok, err := evaluateRule(subRule, principals, endorsers)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				satisfied++
+			}
+		}
+		return satisfied >= t.NOutOf.GetN(), nil
+	default:
+		return false, fmt.Errorf("unsupported signature policy rule %T", t)
+	}
+}
@@ -0,0 +1,26 @@
+package ledgertest
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSatisfiesPolicy(t *testing.T) {
+	ep, err := statebased.NewStateEP(nil)
+	require.NoError(t, err)
+	require.NoError(t, ep.AddOrgs(statebased.RoleTypePeer, "Org1MSP", "Org2MSP"))
+	policy, err := ep.Policy()
+	require.NoError(t, err)
+
+	ok, err := SatisfiesPolicy(policy, []string{"Org1MSP", "Org2MSP"})
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = SatisfiesPolicy(policy, []string{"Org2MSP", "Org3MSP"})
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, err = SatisfiesPolicy([]byte("not a policy"), []string{"Org1MSP"})
+	require.Error(t, err)
+}
@@ -0,0 +1,63 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package ledgertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+)
+
+// richQuery evaluates the selector of a CouchDB query against JSON values. Only equality on top level
+// fields, either as a plain value or with $eq, is supported; sort, fields and use_index are ignored.
+func (l *Ledger) richQuery(values map[string][]byte, query string) ([]*queryresult.KV, error) {
+	var parsed struct {
+		Selector map[string]interface{} `json:"selector"`
+	}
+	if err := json.Unmarshal([]byte(query), &parsed); err != nil {
+		return nil, fmt.Errorf("invalid query %s: %v", query, err)
+	}
+	if parsed.Selector == nil {
+		return nil, fmt.Errorf("query %s has no selector", query)
+	}
+
+	conditions := make(map[string]interface{}, len(parsed.Selector))
+	for field, condition := range parsed.Selector {
+		if operators, ok := condition.(map[string]interface{}); ok {
+			value, ok := operators["$eq"]
+			if !ok || len(operators) != 1 {
+				return nil, fmt.Errorf("unsupported condition on %s in query %s", field, query)
+			}
+			condition = value
+		}
+		conditions[field] = condition
+	}
+
+	var results []*queryresult.KV
+	for key, value := range values {
+		var document map[string]interface{}
+		if err := json.Unmarshal(value, &document); err != nil {
+			continue
+		}
+		if matches(document, conditions) {
+			results = append(results, &queryresult.KV{Key: key, Value: value})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Key < results[j].Key })
+	return results, nil
+}
+
+func matches(document map[string]interface{}, conditions map[string]interface{}) bool {
+	for field, expected := range conditions {
+		actual, ok := document[field]
+		if !ok || !reflect.DeepEqual(actual, expected) {
+			return false
+		}
+	}
+	return true
+}
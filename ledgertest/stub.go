@@ -0,0 +1,437 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package ledgertest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+const (
+	// compositeKeyNamespace prefixes composite keys, which simple range queries never return
+	compositeKeyNamespace = "\x00"
+	// emptyKeySubstitute replaces an empty start key of a range query, like the shim does
+	emptyKeySubstitute = "\x01"
+	maxUnicodeRune     = string(utf8.MaxRune)
+)
+
+// write is a buffered update of a key
+type write struct {
+	value    []byte
+	isDelete bool
+}
+
+// Stub implements shim.ChaincodeStubInterface for a single transaction against a Ledger.
+// Reads see the committed state only, writes are buffered until the transaction is committed.
+type Stub struct {
+	ledger        *Ledger
+	txID          string
+	timestamp     *timestamp.Timestamp
+	args          [][]byte
+	transient     map[string][]byte
+	identity      *Identity
+	peerMSPID     string
+	writes        map[string]*write
+	privateWrites map[string]map[string]*write
+	stateEP       map[string][]byte
+	privateEP     map[string]map[string][]byte
+	event         *peer.ChaincodeEvent
+}
+
+var _ shim.ChaincodeStubInterface = (*Stub)(nil)
+
+// GetArgs returns the function name followed by its arguments
+func (s *Stub) GetArgs() [][]byte {
+	return s.args
+}
+
+// GetStringArgs returns the function name followed by its arguments as strings
+func (s *Stub) GetStringArgs() []string {
+	args := make([]string, 0, len(s.args))
+	for _, arg := range s.args {
+		args = append(args, string(arg))
+	}
+	return args
+}
+
+// GetFunctionAndParameters returns the function name and its arguments
+func (s *Stub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) == 0 {
+		return "", []string{}
+	}
+	return args[0], args[1:]
+}
+
+// GetArgsSlice returns the arguments concatenated
+func (s *Stub) GetArgsSlice() ([]byte, error) {
+	var res []byte
+	for _, arg := range s.args {
+		res = append(res, arg...)
+	}
+	return res, nil
+}
+
+// GetTxID returns the transaction ID
+func (s *Stub) GetTxID() string {
+	return s.txID
+}
+
+// GetChannelID returns the channel of the ledger
+func (s *Stub) GetChannelID() string {
+	return s.ledger.channelID
+}
+
+// InvokeChaincode is not supported, the ledger holds a single chaincode namespace
+func (s *Stub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) peer.Response {
+	return shim.Error("ledgertest does not support chaincode to chaincode invocation")
+}
+
+// GetState returns the committed value of a key
+func (s *Stub) GetState(key string) ([]byte, error) {
+	return s.ledger.state[key], nil
+}
+
+// PutState buffers a write of a key
+func (s *Stub) PutState(key string, value []byte) error {
+	if key == "" {
+		return errors.New("key must not be an empty string")
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	s.writes[key] = &write{value: value}
+	return nil
+}
+
+// DelState buffers a delete of a key
+func (s *Stub) DelState(key string) error {
+	if key == "" {
+		return errors.New("key must not be an empty string")
+	}
+	s.writes[key] = &write{isDelete: true}
+	return nil
+}
+
+// SetStateValidationParameter buffers the state-based endorsement policy of a key
+func (s *Stub) SetStateValidationParameter(key string, ep []byte) error {
+	s.stateEP[key] = ep
+	return nil
+}
+
+// GetStateValidationParameter returns the committed state-based endorsement policy of a key
+func (s *Stub) GetStateValidationParameter(key string) ([]byte, error) {
+	return s.ledger.stateEP[key], nil
+}
+
+// GetStateByRange returns the committed simple keys in [startKey, endKey)
+func (s *Stub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	if startKey == "" {
+		startKey = emptyKeySubstitute
+	}
+	return &stateIterator{results: s.ledger.rangeQuery(startKey, endKey)}, nil
+}
+
+// GetStateByRangeWithPagination returns a page of the committed simple keys in [startKey, endKey)
+func (s *Stub) GetStateByRangeWithPagination(startKey, endKey string, pageSize int32,
+	bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	if startKey == "" {
+		startKey = emptyKeySubstitute
+	}
+	results, metadata := paginate(s.ledger.rangeQuery(startKey, endKey), pageSize, bookmark)
+	return &stateIterator{results: results}, metadata, nil
+}
+
+// GetStateByPartialCompositeKey returns the committed composite keys starting with the given attributes
+func (s *Stub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	startKey, err := shim.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+	return &stateIterator{results: s.ledger.rangeQuery(startKey, startKey+maxUnicodeRune)}, nil
+}
+
+// GetStateByPartialCompositeKeyWithPagination returns a page of the committed composite keys starting with the given attributes
+func (s *Stub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32,
+	bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	startKey, err := shim.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	results, metadata := paginate(s.ledger.rangeQuery(startKey, startKey+maxUnicodeRune), pageSize, bookmark)
+	return &stateIterator{results: results}, metadata, nil
+}
+
+// CreateCompositeKey combines the object type and attributes into a composite key
+func (s *Stub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return shim.CreateCompositeKey(objectType, attributes)
+}
+
+// SplitCompositeKey splits a composite key into its object type and attributes
+func (s *Stub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	if !strings.HasPrefix(compositeKey, compositeKeyNamespace) {
+		return "", nil, fmt.Errorf("%q is not a composite key", compositeKey)
+	}
+	components := strings.Split(compositeKey[1:], compositeKeyNamespace)
+	if len(components) < 2 {
+		return "", nil, fmt.Errorf("%q is not a composite key", compositeKey)
+	}
+	return components[0], components[1 : len(components)-1], nil
+}
+
+// GetQueryResult runs a CouchDB selector query over the committed JSON values
+func (s *Stub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	results, err := s.ledger.richQuery(s.ledger.state, query)
+	if err != nil {
+		return nil, err
+	}
+	return &stateIterator{results: results}, nil
+}
+
+// GetQueryResultWithPagination runs a CouchDB selector query over the committed JSON values and returns a page of the results
+func (s *Stub) GetQueryResultWithPagination(query string, pageSize int32,
+	bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	results, err := s.ledger.richQuery(s.ledger.state, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	page, metadata := paginate(results, pageSize, bookmark)
+	return &stateIterator{results: page}, metadata, nil
+}
+
+// GetHistoryForKey returns the committed modifications of a key, newest first like Fabric 2.x
+func (s *Stub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	history := s.ledger.history[key]
+	results := make([]*queryresult.KeyModification, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		results = append(results, history[i])
+	}
+	return &historyIterator{results: results}, nil
+}
+
+// GetPrivateData returns the committed value of a private key. It fails if the endorsing peer is not a member of the collection.
+func (s *Stub) GetPrivateData(collection, key string) ([]byte, error) {
+	if err := s.checkMember(collection); err != nil {
+		return nil, err
+	}
+	return s.ledger.private[collection][key], nil
+}
+
+// GetPrivateDataHash returns the hash of the committed value of a private key, available on every peer
+func (s *Stub) GetPrivateDataHash(collection, key string) ([]byte, error) {
+	return s.ledger.privateHash[collection][key], nil
+}
+
+// PutPrivateData buffers a write of a private key
+func (s *Stub) PutPrivateData(collection string, key string, value []byte) error {
+	if collection == "" {
+		return errors.New("collection must not be an empty string")
+	}
+	if key == "" {
+		return errors.New("key must not be an empty string")
+	}
+	if len(value) == 0 {
+		return errors.New("value must not be empty")
+	}
+	s.privateWritesOf(collection)[key] = &write{value: value}
+	return nil
+}
+
+// DelPrivateData buffers a delete of a private key
+func (s *Stub) DelPrivateData(collection, key string) error {
+	if collection == "" {
+		return errors.New("collection must not be an empty string")
+	}
+	s.privateWritesOf(collection)[key] = &write{isDelete: true}
+	return nil
+}
+
+// SetPrivateDataValidationParameter buffers the key-level endorsement policy of a private key
+func (s *Stub) SetPrivateDataValidationParameter(collection, key string, ep []byte) error {
+	if s.privateEP[collection] == nil {
+		s.privateEP[collection] = make(map[string][]byte)
+	}
+	s.privateEP[collection][key] = ep
+	return nil
+}
+
+// GetPrivateDataValidationParameter returns the committed key-level endorsement policy of a private key
+func (s *Stub) GetPrivateDataValidationParameter(collection, key string) ([]byte, error) {
+	return s.ledger.privateEP[collection][key], nil
+}
+
+// GetPrivateDataByRange returns the committed private keys of a collection in [startKey, endKey)
+func (s *Stub) GetPrivateDataByRange(collection, startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	if err := s.checkMember(collection); err != nil {
+		return nil, err
+	}
+	if startKey == "" {
+		startKey = emptyKeySubstitute
+	}
+	return &stateIterator{results: rangeQuery(s.ledger.private[collection], startKey, endKey)}, nil
+}
+
+// GetPrivateDataByPartialCompositeKey returns the committed private composite keys starting with the given attributes
+func (s *Stub) GetPrivateDataByPartialCompositeKey(collection, objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	if err := s.checkMember(collection); err != nil {
+		return nil, err
+	}
+	startKey, err := shim.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+	return &stateIterator{results: rangeQuery(s.ledger.private[collection], startKey, startKey+maxUnicodeRune)}, nil
+}
+
+// GetPrivateDataQueryResult runs a CouchDB selector query over the committed private JSON values of a collection
+func (s *Stub) GetPrivateDataQueryResult(collection, query string) (shim.StateQueryIteratorInterface, error) {
+	if err := s.checkMember(collection); err != nil {
+		return nil, err
+	}
+	results, err := s.ledger.richQuery(s.ledger.private[collection], query)
+	if err != nil {
+		return nil, err
+	}
+	return &stateIterator{results: results}, nil
+}
+
+// GetCreator returns the serialized identity of the client
+func (s *Stub) GetCreator() ([]byte, error) {
+	if s.identity == nil {
+		return nil, errors.New("transaction has no client identity")
+	}
+	return s.identity.Creator()
+}
+
+// GetTransient returns the transient data of the proposal
+func (s *Stub) GetTransient() (map[string][]byte, error) {
+	if s.transient == nil {
+		return map[string][]byte{}, nil
+	}
+	return s.transient, nil
+}
+
+// GetBinding returns no binding, proposals are not signed
+func (s *Stub) GetBinding() ([]byte, error) {
+	return nil, nil
+}
+
+// GetDecorations returns no decorations
+func (s *Stub) GetDecorations() map[string][]byte {
+	return map[string][]byte{}
+}
+
+// GetSignedProposal returns an empty signed proposal, proposals are not signed
+func (s *Stub) GetSignedProposal() (*peer.SignedProposal, error) {
+	return &peer.SignedProposal{}, nil
+}
+
+// GetTxTimestamp returns the timestamp of the transaction
+func (s *Stub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return s.timestamp, nil
+}
+
+// SetEvent sets the event of the transaction, replacing any event set before
+func (s *Stub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return errors.New("event name can not be empty string")
+	}
+	s.event = &peer.ChaincodeEvent{TxId: s.txID, EventName: name, Payload: payload}
+	return nil
+}
+
+// PeerMSPID returns the MSP of the endorsing peer
+func (s *Stub) PeerMSPID() string {
+	return s.peerMSPID
+}
+
+// Writes returns the buffered public writes, a nil value marks a delete
+func (s *Stub) Writes() map[string][]byte {
+	writes := make(map[string][]byte, len(s.writes))
+	for key, w := range s.writes {
+		writes[key] = w.value
+	}
+	return writes
+}
+
+// PrivateWrites returns the buffered writes to a collection, a nil value marks a delete
+func (s *Stub) PrivateWrites(collection string) map[string][]byte {
+	writes := make(map[string][]byte, len(s.privateWrites[collection]))
+	for key, w := range s.privateWrites[collection] {
+		writes[key] = w.value
+	}
+	return writes
+}
+
+// StateValidationParameters returns the buffered state-based endorsement policies
+func (s *Stub) StateValidationParameters() map[string][]byte {
+	return s.stateEP
+}
+
+func (s *Stub) eventOrEmpty() *peer.ChaincodeEvent {
+	if s.event == nil {
+		return &peer.ChaincodeEvent{}
+	}
+	return s.event
+}
+
+func (s *Stub) privateWritesOf(collection string) map[string]*write {
+	if s.privateWrites[collection] == nil {
+		s.privateWrites[collection] = make(map[string]*write)
+	}
+	return s.privateWrites[collection]
+}
+
+func (s *Stub) checkMember(collection string) error {
+	if !s.ledger.IsMember(collection, s.peerMSPID) {
+		return fmt.Errorf("peer of org %s is not a member of collection %s", s.peerMSPID, collection)
+	}
+	return nil
+}
+
+func (l *Ledger) rangeQuery(startKey, endKey string) []*queryresult.KV {
+	return rangeQuery(l.state, startKey, endKey)
+}
+
+// rangeQuery returns the entries of values with keys in [startKey, endKey), sorted by key. An empty endKey is unbounded.
+func rangeQuery(values map[string][]byte, startKey, endKey string) []*queryresult.KV {
+	var results []*queryresult.KV
+	for key, value := range values {
+		if key < startKey || (endKey != "" && key >= endKey) {
+			continue
+		}
+		results = append(results, &queryresult.KV{Key: key, Value: value})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Key < results[j].Key })
+	return results
+}
+
+// paginate returns the page of sorted results starting at the bookmark key. The bookmark of the next page is the key
+// following the page, empty when there are no more results.
+func paginate(results []*queryresult.KV, pageSize int32, bookmark string) ([]*queryresult.KV, *peer.QueryResponseMetadata) {
+	start := 0
+	if bookmark != "" {
+		start = sort.Search(len(results), func(i int) bool { return results[i].Key >= bookmark })
+	}
+	end := len(results)
+	if pageSize > 0 && start+int(pageSize) < end {
+		end = start + int(pageSize)
+	}
+	page := results[start:end]
+
+	metadata := &peer.QueryResponseMetadata{FetchedRecordsCount: int32(len(page))}
+	if end < len(results) {
+		metadata.Bookmark = results[end].Key
+	}
+	return page, metadata
+}
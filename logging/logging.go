@@ -0,0 +1,198 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package logging is a leveled, structured logger for chaincode that keeps private data out of peer logs.
+//
+// Every entry is a JSON line with the time, level, logger name, message and key value pairs:
+//
+//	{"time":"2021-01-01T00:00:00Z","level":"INFO","logger":"asset_transfer","msg":"asset created","assetID":"asset1"}
+//
+// Values are redacted before they are written: byte slices, such as transient payloads and private data,
+// are only logged by length, values of keys registered as private are replaced, and a Redactor scrubs the
+// secrets of a transaction, such as its transient values, from messages and values.
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log entry
+type Level int
+
+// Levels, entries below the level of a logger are dropped
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarning
+	LevelError
+)
+
+var levelNames = map[Level]string{LevelDebug: "DEBUG", LevelInfo: "INFO", LevelWarning: "WARNING", LevelError: "ERROR"}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// ParseLevel parses a level name as used by the peer, such as DEBUG, INFO, WARN or WARNING, ERROR or CRITICAL
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "DEBUG":
+		return LevelDebug, nil
+	case "INFO":
+		return LevelInfo, nil
+	case "WARN", "WARNING":
+		return LevelWarning, nil
+	case "ERROR", "CRITICAL", "PANIC", "FATAL":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", name)
+}
+
+// LevelEnv is the environment variable the peer passes the chaincode logging level in
+const LevelEnv = "CORE_CHAINCODE_LOGGING_LEVEL"
+
+// LevelFromEnv returns the level set in LevelEnv, INFO if it is not set or unknown
+func LevelFromEnv() Level {
+	level, err := ParseLevel(os.Getenv(LevelEnv))
+	if err != nil {
+		return LevelInfo
+	}
+	return level
+}
+
+// Logger writes structured log entries at or above its level. Loggers derived with With and WithRedactor
+// share the output and level of their parent.
+type Logger struct {
+	name     string
+	out      *output
+	fields   []interface{}
+	redactor *Redactor
+}
+
+type output struct {
+	mu     sync.Mutex
+	writer io.Writer
+	level  Level
+	now    func() time.Time
+}
+
+// New returns a logger writing entries at or above level to out
+func New(name string, out io.Writer, level Level) *Logger {
+	return &Logger{name: name, out: &output{writer: out, level: level, now: time.Now}}
+}
+
+// SetOutput changes the writer of the logger and the loggers derived from it
+func (l *Logger) SetOutput(out io.Writer) {
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.writer = out
+}
+
+// SetLevel changes the level of the logger and the loggers derived from it
+func (l *Logger) SetLevel(level Level) {
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.level = level
+}
+
+// With returns a logger adding key value pairs to every entry
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	derived := *l
+	derived.fields = append(append([]interface{}{}, l.fields...), keyvals...)
+	return &derived
+}
+
+// WithRedactor returns a logger scrubbing the secrets of the redactor from every entry
+func (l *Logger) WithRedactor(redactor *Redactor) *Logger {
+	derived := *l
+	derived.redactor = redactor
+	return &derived
+}
+
+// Enabled reports whether entries of the level are written
+func (l *Logger) Enabled(level Level) bool {
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	return level >= l.out.level
+}
+
+// Debug logs a message with key value pairs at debug level
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(LevelDebug, msg, keyvals)
+}
+
+// Info logs a message with key value pairs at info level
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.log(LevelInfo, msg, keyvals)
+}
+
+// Warning logs a message with key value pairs at warning level
+func (l *Logger) Warning(msg string, keyvals ...interface{}) {
+	l.log(LevelWarning, msg, keyvals)
+}
+
+// Error logs a message with key value pairs at error level
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.log(LevelError, msg, keyvals)
+}
+
+func (l *Logger) log(level Level, msg string, keyvals []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	writeField(&buffer, "time", l.out.now().UTC().Format(time.RFC3339Nano))
+	buffer.WriteByte(',')
+	writeField(&buffer, "level", level.String())
+	buffer.WriteByte(',')
+	writeField(&buffer, "logger", l.name)
+	buffer.WriteByte(',')
+	writeField(&buffer, "msg", l.redactor.Scrub(msg))
+	for _, keyvals := range [][]interface{}{l.fields, keyvals} {
+		for i := 0; i < len(keyvals); i += 2 {
+			key, ok := keyvals[i].(string)
+			if !ok {
+				key = fmt.Sprint(keyvals[i])
+			}
+			value := interface{}("!MISSING")
+			if i+1 < len(keyvals) {
+				value = keyvals[i+1]
+			}
+			buffer.WriteByte(',')
+			writeField(&buffer, key, l.redactor.redact(key, value))
+		}
+	}
+	buffer.WriteString("}\n")
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	_, _ = l.out.writer.Write(buffer.Bytes())
+}
+
+func writeField(buffer *bytes.Buffer, key string, value interface{}) {
+	writeJSON(buffer, key)
+	buffer.WriteByte(':')
+	writeJSON(buffer, value)
+}
+
+func writeJSON(buffer *bytes.Buffer, value interface{}) {
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		_ = encoder.Encode(fmt.Sprint(value))
+	}
+	// Encode terminates values with a newline
+	buffer.Truncate(buffer.Len() - 1)
+}
@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLogger(level Level) (*Logger, *bytes.Buffer) {
+	var buffer bytes.Buffer
+	logger := New("test", &buffer, level)
+	logger.out.now = func() time.Time { return time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC) }
+	return logger, &buffer
+}
+
+func entries(t *testing.T, buffer *bytes.Buffer) []map[string]interface{} {
+	var result []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry), line)
+		result = append(result, entry)
+	}
+	return result
+}
+
+func TestLevels(t *testing.T) {
+	logger, buffer := newTestLogger(LevelInfo)
+	logger.Debug("dropped")
+	logger.Info("asset created", "assetID", "asset1", "amount", 1000)
+	logger.With("txID", "tx1").Error("transfer failed", "err", errors.New("not owner"))
+
+	require.Equal(t, `{"time":"2021-01-01T00:00:00Z","level":"INFO","logger":"test","msg":"asset created","assetID":"asset1","amount":1000}`+"\n"+
+		`{"time":"2021-01-01T00:00:00Z","level":"ERROR","logger":"test","msg":"transfer failed","txID":"tx1","err":"not owner"}`+"\n",
+		buffer.String())
+
+	level, err := ParseLevel("warn")
+	require.NoError(t, err)
+	require.Equal(t, LevelWarning, level)
+	_, err = ParseLevel("verbose")
+	require.Error(t, err)
+}
+
+func TestRedaction(t *testing.T) {
+	properties := []byte(`{"amount":1000,"salt":"a1b2c3"}`)
+	redactor := NewRedactor("price")
+	redactor.AddSecret(properties, []byte("a1b2c3"), []byte("10"))
+	logger, buffer := newTestLogger(LevelDebug)
+	logger = logger.WithRedactor(redactor)
+
+	logger.Debug("received "+string(properties),
+		"asset_properties", properties,
+		"transient", map[string][]byte{"asset_price": []byte(`{"price":10}`)},
+		"price", 10,
+		"err", errors.New("salt a1b2c3 does not match"),
+		"args", []string{"asset1", "a1b2c3"},
+		"count", 10,
+	)
+	entry := entries(t, buffer)[0]
+	require.Equal(t, "received [REDACTED]", entry["msg"])
+	require.Equal(t, "[31 bytes]", entry["asset_properties"])
+	require.Equal(t, map[string]interface{}{"asset_price": "[12 bytes]"}, entry["transient"])
+	require.Equal(t, Redacted, entry["price"])
+	require.Equal(t, "salt [REDACTED] does not match", entry["err"])
+	require.Equal(t, []interface{}{"asset1", "[REDACTED]"}, entry["args"])
+	// short secrets are not scrubbed
+	require.Equal(t, float64(10), entry["count"])
+
+	// secrets of a transaction do not leak into the redactor it was cloned from
+	clone := redactor.Clone()
+	clone.AddSecret([]byte("asset1"))
+	require.Equal(t, "[REDACTED]", clone.Scrub("asset1"))
+	require.Equal(t, "asset1", redactor.Scrub("asset1"))
+}
@@ -0,0 +1,111 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces private values in log entries
+const Redacted = "[REDACTED]"
+
+// minSecretLength is the length below which secrets are not scrubbed from text, as short values such as
+// a price of 10 would redact unrelated numbers and give the secret away
+const minSecretLength = 4
+
+// Redactor removes private values from log entries: values of private keys and the secrets of a
+// transaction, such as its transient values and the private data it reads
+type Redactor struct {
+	mu          sync.Mutex
+	privateKeys map[string]bool
+	secrets     []string
+}
+
+// NewRedactor returns a redactor replacing the values logged under the private keys
+func NewRedactor(privateKeys ...string) *Redactor {
+	r := &Redactor{privateKeys: make(map[string]bool, len(privateKeys))}
+	for _, key := range privateKeys {
+		r.privateKeys[key] = true
+	}
+	return r
+}
+
+// Clone returns a redactor with the private keys and secrets of r, secrets added to it are not added to r
+func (r *Redactor) Clone() *Redactor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Redactor{privateKeys: r.privateKeys, secrets: append([]string{}, r.secrets...)}
+}
+
+// AddSecret scrubs values from every later log entry
+func (r *Redactor) AddSecret(values ...[]byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, value := range values {
+		if len(value) >= minSecretLength {
+			r.secrets = append(r.secrets, string(value))
+		}
+	}
+	// longer secrets first, so that a secret containing another one is scrubbed whole
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+}
+
+// Scrub replaces the secrets in text
+func (r *Redactor) Scrub(text string) string {
+	if r == nil {
+		return text
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, secret := range r.secrets {
+		text = strings.Replace(text, secret, Redacted, -1)
+	}
+	return text
+}
+
+// redact returns the value logged for a key. Byte slices, which hold payloads and private data, are only
+// logged by length; other values are scrubbed once rendered.
+func (r *Redactor) redact(key string, value interface{}) interface{} {
+	if r != nil && r.privateKeys[key] {
+		return Redacted
+	}
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return lengthOf(v)
+	case map[string][]byte:
+		lengths := make(map[string]string, len(v))
+		for k, b := range v {
+			lengths[k] = lengthOf(b)
+		}
+		return lengths
+	case string:
+		return r.Scrub(v)
+	case error:
+		return r.Scrub(v.Error())
+	case fmt.Stringer:
+		return r.Scrub(v.String())
+	case bool, int, int32, int64, uint, uint32, uint64, float64:
+		return v
+	}
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return r.Scrub(fmt.Sprint(value))
+	}
+	scrubbed := r.Scrub(string(valueJSON))
+	if !json.Valid([]byte(scrubbed)) {
+		return Redacted
+	}
+	return json.RawMessage(scrubbed)
+}
+
+func lengthOf(b []byte) string {
+	return fmt.Sprintf("[%d bytes]", len(b))
+}
@@ -0,0 +1,203 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package merkle commits to the individual fields of a document with a Merkle tree, so that single
+// fields can be disclosed with an inclusion proof against the root without revealing the others.
+//
+// Every field is hidden by its own salt, derived from the document salt as HMAC-SHA256(salt, name),
+// so disclosing a field and its salt reveals nothing about the salts of the other fields.
+// Leaves and inner nodes are domain separated, and a level with an odd number of nodes promotes its
+// last node unchanged to the next level.
+package merkle
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+// Field is a named field of a document, Value being its canonical encoding
+type Field struct {
+	Name  string
+	Value []byte
+}
+
+// Proof discloses a single field and proves its inclusion in a tree
+type Proof struct {
+	Field string `json:"field"`
+	// Value is the encoding of the field that was committed to
+	Value string `json:"value"`
+	// Salt is the hex encoded salt of the field
+	Salt      string   `json:"salt"`
+	Index     int      `json:"index"`
+	LeafCount int      `json:"leafCount"`
+	Siblings  []string `json:"siblings"` // hex encoded, from the leaf up
+}
+
+// Tree is a Merkle tree over the fields of a document
+type Tree struct {
+	fields []Field
+	salts  [][]byte
+	levels [][][]byte
+}
+
+// FieldSalt derives the salt of a field from the document salt
+func FieldSalt(salt []byte, name string) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(name))
+	return mac.Sum(nil)
+}
+
+// LeafHash is the hash of a salted field
+func LeafHash(name string, fieldSalt []byte, value []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	writeLengthPrefixed(h, []byte(name))
+	writeLengthPrefixed(h, fieldSalt)
+	h.Write(value)
+	return h.Sum(nil)
+}
+
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+func writeLengthPrefixed(w interface{ Write([]byte) (int, error) }, b []byte) {
+	w.Write([]byte{byte(len(b) >> 8), byte(len(b))})
+	w.Write(b)
+}
+
+// New builds the tree of the fields of a document, in the order given, hidden by the document salt
+func New(salt []byte, fields []Field) (*Tree, error) {
+	if len(fields) == 0 {
+		return nil, errors.New("no fields to commit to")
+	}
+	tree := &Tree{fields: fields}
+	names := make(map[string]bool, len(fields))
+	leaves := make([][]byte, len(fields))
+	for i, field := range fields {
+		if names[field.Name] {
+			return nil, fmt.Errorf("duplicate field %s", field.Name)
+		}
+		names[field.Name] = true
+		fieldSalt := FieldSalt(salt, field.Name)
+		tree.salts = append(tree.salts, fieldSalt)
+		leaves[i] = LeafHash(field.Name, fieldSalt, field.Value)
+	}
+
+	tree.levels = [][][]byte{leaves}
+	for level := leaves; len(level) > 1; {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, nodeHash(level[i], level[i+1]))
+		}
+		tree.levels = append(tree.levels, next)
+		level = next
+	}
+	return tree, nil
+}
+
+// Root returns the root of the tree
+func (t *Tree) Root() []byte {
+	return t.levels[len(t.levels)-1][0]
+}
+
+// Prove returns the inclusion proof of a field
+func (t *Tree) Prove(name string) (*Proof, error) {
+	index := -1
+	for i, field := range t.fields {
+		if field.Name == name {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("unknown field %s", name)
+	}
+
+	proof := &Proof{
+		Field:     name,
+		Value:     string(t.fields[index].Value),
+		Salt:      hex.EncodeToString(t.salts[index]),
+		Index:     index,
+		LeafCount: len(t.fields),
+		Siblings:  []string{},
+	}
+	position := index
+	for _, level := range t.levels[:len(t.levels)-1] {
+		sibling := position ^ 1
+		if sibling < len(level) {
+			proof.Siblings = append(proof.Siblings, hex.EncodeToString(level[sibling]))
+		}
+		position /= 2
+	}
+	return proof, nil
+}
+
+// Verify checks that the proof discloses a field of the tree with the given root
+func (p *Proof) Verify(root []byte) error {
+	if p.LeafCount < 1 || p.Index < 0 || p.Index >= p.LeafCount {
+		return fmt.Errorf("invalid proof position %d of %d", p.Index, p.LeafCount)
+	}
+	fieldSalt, err := hex.DecodeString(p.Salt)
+	if err != nil {
+		return fmt.Errorf("invalid salt of field %s: %v", p.Field, err)
+	}
+
+	hash := LeafHash(p.Field, fieldSalt, []byte(p.Value))
+	position, width, used := p.Index, p.LeafCount, 0
+	for width > 1 {
+		sibling := position ^ 1
+		if sibling < width {
+			if used == len(p.Siblings) {
+				return fmt.Errorf("proof of field %s is too short", p.Field)
+			}
+			siblingHash, err := hex.DecodeString(p.Siblings[used])
+			if err != nil {
+				return fmt.Errorf("invalid sibling of field %s: %v", p.Field, err)
+			}
+			used++
+			if position%2 == 0 {
+				hash = nodeHash(hash, siblingHash)
+			} else {
+				hash = nodeHash(siblingHash, hash)
+			}
+		}
+		position /= 2
+		width = (width + 1) / 2
+	}
+	if used != len(p.Siblings) {
+		return fmt.Errorf("proof of field %s is too long", p.Field)
+	}
+	if !bytes.Equal(hash, root) {
+		return fmt.Errorf("field %s is not included in root %x", p.Field, root)
+	}
+	return nil
+}
+
+// VerifyAll checks every proof against the root
+func VerifyAll(root []byte, proofs []*Proof) error {
+	for _, proof := range proofs {
+		if err := proof.Verify(root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
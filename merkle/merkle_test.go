@@ -0,0 +1,63 @@
+package merkle
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testFields(n int) []Field {
+	fields := make([]Field, n)
+	for i := range fields {
+		fields[i] = Field{Name: fmt.Sprintf("field%d", i), Value: []byte(fmt.Sprintf(`"value%d"`, i))}
+	}
+	return fields
+}
+
+func TestProofsVerifyForEveryTreeShape(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		tree, err := New([]byte("salt"), testFields(n))
+		require.NoError(t, err)
+		for i := 0; i < n; i++ {
+			proof, err := tree.Prove(fmt.Sprintf("field%d", i))
+			require.NoError(t, err)
+			require.NoError(t, proof.Verify(tree.Root()), "field %d of %d", i, n)
+		}
+	}
+}
+
+func TestProofRejectsTampering(t *testing.T) {
+	tree, err := New([]byte("salt"), testFields(6))
+	require.NoError(t, err)
+	proof, err := tree.Prove("field2")
+	require.NoError(t, err)
+
+	tampered := *proof
+	tampered.Value = `"other"`
+	require.Error(t, tampered.Verify(tree.Root()))
+
+	tampered = *proof
+	tampered.Field = "field3"
+	require.Error(t, tampered.Verify(tree.Root()))
+
+	tampered = *proof
+	tampered.Index = 3
+	require.Error(t, tampered.Verify(tree.Root()))
+
+	tampered = *proof
+	tampered.Siblings = tampered.Siblings[:1]
+	require.Error(t, tampered.Verify(tree.Root()))
+
+	// the root depends on the document salt
+	other, err := New([]byte("other salt"), testFields(6))
+	require.NoError(t, err)
+	require.NotEqual(t, tree.Root(), other.Root())
+	require.Error(t, proof.Verify(other.Root()))
+	require.NoError(t, VerifyAll(tree.Root(), []*Proof{proof}))
+
+	_, err = tree.Prove("missing")
+	require.Error(t, err)
+	_, err = New(nil, append(testFields(2), testFields(1)...))
+	require.Error(t, err)
+}
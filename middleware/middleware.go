@@ -0,0 +1,185 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package middleware runs a chain of middlewares around the transactions of a contract, such as
+// authorization, input validation, pause checks, audit trails and error normalization.
+//
+// A Pipeline holds the middlewares every transaction of a contract runs and those registered for
+// individual functions. Its Before and After methods are returned by the contract's
+// GetBeforeTransaction and GetAfterTransaction. The contract API only runs the after transaction
+// hook when the transaction succeeded, so error hooks are run by wrapping the chaincode in a Chaincode.
+package middleware
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Before runs before a transaction, an error rejects the transaction
+type Before func(ctx contractapi.TransactionContextInterface, function string) error
+
+// After runs after a transaction succeeded with its result, an error fails the transaction
+type After func(ctx contractapi.TransactionContextInterface, function string, result interface{}) error
+
+// ErrorHandler rewrites the error a transaction failed with. It runs once the contract API has discarded the
+// transaction context, the stub of the transaction identifies it.
+type ErrorHandler func(stub shim.ChaincodeStubInterface, function string, err error) error
+
+// Middleware hooks into transactions, any of its hooks may be nil
+type Middleware struct {
+	Name   string
+	Before Before
+	After  After
+	Error  ErrorHandler
+}
+
+// Pipeline is the chain of middlewares of a contract. Before hooks run in the order the middlewares
+// were added, after and error hooks in the reverse order, the middlewares every transaction runs
+// wrapping those of the function.
+type Pipeline struct {
+	all       []Middleware
+	functions map[string][]Middleware
+}
+
+// New returns a pipeline running the given middlewares around every transaction
+func New(all ...Middleware) *Pipeline {
+	return &Pipeline{all: all, functions: make(map[string][]Middleware)}
+}
+
+// Use registers middlewares for a function, after those of every transaction
+func (p *Pipeline) Use(function string, middlewares ...Middleware) *Pipeline {
+	p.functions[function] = append(p.functions[function], middlewares...)
+	return p
+}
+
+// Middlewares returns the middlewares a function runs, in order
+func (p *Pipeline) Middlewares(function string) []Middleware {
+	middlewares := make([]Middleware, 0, len(p.all)+len(p.functions[function]))
+	middlewares = append(middlewares, p.all...)
+	return append(middlewares, p.functions[function]...)
+}
+
+// Functions returns the functions with middlewares of their own
+func (p *Pipeline) Functions() []string {
+	functions := make([]string, 0, len(p.functions))
+	for function := range p.functions {
+		functions = append(functions, function)
+	}
+	return functions
+}
+
+// Before runs the before hooks of the called function, the first error stops the chain
+func (p *Pipeline) Before(ctx contractapi.TransactionContextInterface) error {
+	function := Function(ctx.GetStub())
+	for _, m := range p.Middlewares(function) {
+		if m.Before == nil {
+			continue
+		}
+		if err := m.Before(ctx, function); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// After runs the after hooks of the called function, the first error stops the chain
+func (p *Pipeline) After(ctx contractapi.TransactionContextInterface, result interface{}) error {
+	function := Function(ctx.GetStub())
+	middlewares := p.Middlewares(function)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		if middlewares[i].After == nil {
+			continue
+		}
+		if err := middlewares[i].After(ctx, function, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HandleError runs the error hooks of a function on the error it failed with
+func (p *Pipeline) HandleError(stub shim.ChaincodeStubInterface, function string, err error) error {
+	middlewares := p.Middlewares(function)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		if middlewares[i].Error != nil {
+			err = middlewares[i].Error(stub, function, err)
+		}
+	}
+	return err
+}
+
+// NormalizeErrors returns errors on a single line, prefixed with the function that failed
+var NormalizeErrors = Middleware{
+	Name: "errors",
+	Error: func(stub shim.ChaincodeStubInterface, function string, err error) error {
+		message := strings.Join(strings.Fields(err.Error()), " ")
+		if prefix := function + ": "; !strings.HasPrefix(message, prefix) {
+			message = prefix + message
+		}
+		return errors.New(message)
+	},
+}
+
+// Function returns the called function without the contract name prefix
+func Function(stub shim.ChaincodeStubInterface) string {
+	_, function := splitFunction(stub)
+	return function
+}
+
+func splitFunction(stub shim.ChaincodeStubInterface) (contract string, function string) {
+	function, _ = stub.GetFunctionAndParameters()
+	if i := strings.LastIndex(function, ":"); i >= 0 {
+		return function[:i], function[i+1:]
+	}
+	return "", function
+}
+
+// Chaincode runs the error hooks of the contracts' pipelines on failed transactions
+type Chaincode struct {
+	*contractapi.ContractChaincode
+	pipelines map[string]*Pipeline
+}
+
+// NewChaincode wraps a contract chaincode, pipelines are added to it with Handle
+func NewChaincode(cc *contractapi.ContractChaincode) *Chaincode {
+	return &Chaincode{ContractChaincode: cc, pipelines: make(map[string]*Pipeline)}
+}
+
+// Handle runs the error hooks of a pipeline on the failed transactions of a contract
+func (c *Chaincode) Handle(contract contractapi.ContractInterface, pipeline *Pipeline) *Chaincode {
+	// contracts are named like the contract API does
+	name := contract.GetName()
+	if name == "" {
+		name = reflect.TypeOf(contract).Elem().Name()
+	}
+	c.pipelines[name] = pipeline
+	return c
+}
+
+// Invoke runs the transaction and the error hooks of its contract when it fails
+func (c *Chaincode) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
+	response := c.ContractChaincode.Invoke(stub)
+	if response.Status < shim.ERRORTHRESHOLD {
+		return response
+	}
+	contract, function := splitFunction(stub)
+	if contract == "" {
+		contract = c.DefaultContract
+	}
+	pipeline, ok := c.pipelines[contract]
+	if !ok {
+		return response
+	}
+	return shim.Error(pipeline.HandleError(stub, function, errors.New(response.Message)).Error())
+}
+
+// Start starts the wrapped chaincode
+func (c *Chaincode) Start() error {
+	return shim.Start(c)
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder returns a middleware appending the hooks it runs to calls
+func recorder(name string, calls *[]string) Middleware {
+	return Middleware{
+		Name: name,
+		Before: func(ctx contractapi.TransactionContextInterface, function string) error {
+			*calls = append(*calls, "before "+name+" "+function)
+			return nil
+		},
+		After: func(ctx contractapi.TransactionContextInterface, function string, result interface{}) error {
+			*calls = append(*calls, "after "+name+" "+function)
+			return nil
+		},
+	}
+}
+
+// functionStub is a stub of a call to function
+type functionStub struct {
+	shim.ChaincodeStubInterface
+	function string
+}
+
+func (s *functionStub) GetFunctionAndParameters() (string, []string) {
+	return s.function, nil
+}
+
+func newContext(function string) *contractapi.TransactionContext {
+	ctx := new(contractapi.TransactionContext)
+	ctx.SetStub(&functionStub{function: function})
+	return ctx
+}
+
+func TestPipelineOrder(t *testing.T) {
+	var calls []string
+	pipeline := New(recorder("a", &calls), recorder("b", &calls)).Use("Transfer", recorder("c", &calls))
+
+	ctx := newContext("Asset:Transfer")
+	require.NoError(t, pipeline.Before(ctx))
+	require.NoError(t, pipeline.After(ctx, nil))
+	require.Equal(t, []string{
+		"before a Transfer", "before b Transfer", "before c Transfer",
+		"after c Transfer", "after b Transfer", "after a Transfer",
+	}, calls)
+
+	// middlewares of a function do not run for the other functions
+	calls = nil
+	require.NoError(t, pipeline.Before(newContext("Read")))
+	require.Equal(t, []string{"before a Read", "before b Read"}, calls)
+	require.Equal(t, []string{"Transfer"}, pipeline.Functions())
+}
+
+func TestPipelineBeforeStopsOnError(t *testing.T) {
+	var calls []string
+	reject := Middleware{Name: "reject", Before: func(ctx contractapi.TransactionContextInterface, function string) error {
+		return errors.New("rejected")
+	}}
+	pipeline := New(reject, recorder("a", &calls))
+	require.EqualError(t, pipeline.Before(newContext("Transfer")), "rejected")
+	require.Empty(t, calls)
+}
+
+func TestNormalizeErrors(t *testing.T) {
+	pipeline := New(NormalizeErrors)
+	stub := &functionStub{function: "Transfer"}
+	err := pipeline.HandleError(stub, "Transfer", errors.New("failed to transfer:\n  asset not found"))
+	require.EqualError(t, err, "Transfer: failed to transfer: asset not found")
+	// errors already prefixed are not prefixed twice
+	require.EqualError(t, pipeline.HandleError(stub, "Transfer", err), err.Error())
+}
+
+type testContract struct {
+	contractapi.Contract
+}
+
+func (c *testContract) Fail(ctx contractapi.TransactionContextInterface) error {
+	return errors.New("something\nwent wrong")
+}
+
+func (c *testContract) Succeed(ctx contractapi.TransactionContextInterface) error {
+	return nil
+}
+
+func TestChaincodeHandlesErrors(t *testing.T) {
+	contract := new(testContract)
+	ccc, err := contractapi.NewChaincode(contract)
+	require.NoError(t, err)
+	stub := shimtest.NewMockStub("middleware", NewChaincode(ccc).Handle(contract, New(NormalizeErrors)))
+
+	response := stub.MockInvoke("tx1", [][]byte{[]byte("Fail")})
+	require.Equal(t, int32(shim.ERROR), response.Status)
+	require.Equal(t, "Fail: something went wrong", response.Message)
+	response = stub.MockInvoke("tx2", [][]byte{[]byte("testContract:Fail")})
+	require.Equal(t, "Fail: something went wrong", response.Message)
+	response = stub.MockInvoke("tx3", [][]byte{[]byte("Succeed")})
+	require.Equal(t, int32(shim.OK), response.Status)
+}